@@ -0,0 +1,199 @@
+// Command geofence-mmdb builds MaxMind DB files for the geofence service.
+//
+// Usage:
+//
+//	geofence-mmdb compile -o corrections.mmdb [flags] records.csv [more.json ...]
+//	geofence-mmdb diff [flags] old.mmdb new.mmdb
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/TomasB/geofence/internal/mmdb"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const usage = `usage: geofence-mmdb <command> [flags]
+
+commands:
+  compile   compile CSV or JSON network records into a GeoIP2-Country MMDB
+  diff      report the networks whose country changed between two MMDBs
+
+Run "geofence-mmdb <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "compile":
+		err = runCompile(os.Args[2:])
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "geofence-mmdb %s: %v\n", os.Args[1], err)
+		}
+		os.Exit(1)
+	}
+}
+
+// runCompile implements the compile command.
+func runCompile(args []string) error {
+	fs := flag.NewFlagSet("compile", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geofence-mmdb compile -o output.mmdb [flags] input...\n\n"+
+			"Inputs are CSV (network,country[,continent,registered_country,...] or a header row)\n"+
+			"or JSON arrays of records, read in order; later records override overlapping\n"+
+			"earlier ones.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "", "output MMDB path (required); replaced atomically")
+	format := fs.String("format", "", "input format: csv or json (default: from the file extension)")
+	databaseType := fs.String("type", mmdb.DefaultDatabaseType, "database_type written to the metadata")
+	description := fs.String("description", "", "English description written to the metadata")
+	buildEpoch := fs.Int64("build-epoch", 0, "build time as Unix seconds (default: now)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("an output path and at least one input are required")
+	}
+
+	var records []mmdb.Record
+	for _, path := range fs.Args() {
+		r, err := mmdb.ReadFile(path, *format)
+		if err != nil {
+			return err
+		}
+		records = append(records, r...)
+	}
+
+	meta := mmdb.Metadata{DatabaseType: *databaseType}
+	if *description != "" {
+		meta.Description = map[string]string{"en": *description}
+	}
+	if *buildEpoch != 0 {
+		meta.BuildEpoch = time.Unix(*buildEpoch, 0)
+	}
+
+	written, err := mmdb.WriteFile(*output, records, meta)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("compiled %d records into %s (%s, %d nodes)\n",
+		len(records), *output, written.DatabaseType, written.NodeCount)
+	return nil
+}
+
+// runDiff implements the diff command.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geofence-mmdb diff [flags] old.mmdb new.mmdb\n\n"+
+			"Writes the networks whose country changed as JSON or CSV and prints a\n"+
+			"per-country summary of addresses gained and lost.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "", "report path (default: stdout, with the summary on stderr)")
+	format := fs.String("format", "json", "report format: json or csv")
+	countries := fs.String("countries", "", "comma-separated country codes; only report changes into or out of them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected the old and the new MMDB")
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown report format %q", *format)
+	}
+
+	oldDB, err := maxminddb.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer oldDB.Close()
+	newDB, err := maxminddb.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer newDB.Close()
+
+	var filter []string
+	for _, c := range strings.Split(*countries, ",") {
+		if c = strings.ToUpper(strings.TrimSpace(c)); c != "" {
+			filter = append(filter, c)
+		}
+	}
+
+	report, err := mmdb.Diff(oldDB, newDB, filter)
+	if err != nil {
+		return err
+	}
+
+	out, summaryOut := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out, summaryOut = f, os.Stdout
+	}
+	if *format == "csv" {
+		err = writeDiffCSV(out, report.Changes)
+	} else {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	fmt.Fprintf(summaryOut, "%d changed networks between %s (%d) and %s (%d)\n",
+		len(report.Changes), fs.Arg(0), oldDB.Metadata.BuildEpoch, fs.Arg(1), newDB.Metadata.BuildEpoch)
+	if len(report.Summary) > 0 {
+		tw := tabwriter.NewWriter(summaryOut, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "COUNTRY\tGAINED IPV4\tLOST IPV4\tGAINED IPV6\tLOST IPV6\t")
+		for _, s := range report.Summary {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t\n", s.Country, s.GainedIPv4, s.LostIPv4, s.GainedIPv6, s.LostIPv6)
+		}
+		tw.Flush()
+	}
+	return nil
+}
+
+// writeDiffCSV writes the changes with a header row.
+func writeDiffCSV(out io.Writer, changes []mmdb.Change) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"network", "old_country", "new_country", "prefix_length"})
+	for _, c := range changes {
+		w.Write([]string{c.Network, c.OldCountry, c.NewCountry, strconv.Itoa(c.PrefixLength)})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -8,13 +8,20 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/TomasB/geofence/internal/data"
+	cacheHandler "github.com/TomasB/geofence/internal/handler/cache"
 	"github.com/TomasB/geofence/internal/handler/check"
+	"github.com/TomasB/geofence/internal/handler/database"
 	grpcHandler "github.com/TomasB/geofence/internal/handler/grpc"
 	"github.com/TomasB/geofence/internal/handler/health"
+	"github.com/TomasB/geofence/internal/policy"
 	geofencev1 "github.com/TomasB/geofence/pkg/geofence/v1"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
@@ -55,42 +62,315 @@ func main() {
 	router.Use(ginLogger(logger))
 	router.Use(gin.Recovery())
 
-	// Load MaxMind MMDB
-	mmdbPath := os.Getenv("MMDB_PATH")
-	if mmdbPath == "" {
-		slog.Error("MMDB_PATH environment variable is required")
+	// MMDB_PATH lists the country databases in order of precedence; entries
+	// ending in .csv are CSV range files. CSV_PATH names a single CSV file.
+	paths := splitList(os.Getenv("MMDB_PATH"))
+	csvPath := os.Getenv("CSV_PATH")
+	switch {
+	case len(paths) > 0 && csvPath != "":
+		slog.Error("MMDB_PATH and CSV_PATH are mutually exclusive")
+		os.Exit(1)
+	case len(paths) == 0 && csvPath == "":
+		slog.Error("MMDB_PATH or CSV_PATH environment variable is required")
+		os.Exit(1)
+	case csvPath != "":
+		paths = []string{csvPath}
+	}
+
+	// Several sources are consulted in order of precedence, or queried
+	// together for a majority vote
+	consensus := false
+	switch mode := os.Getenv("MMDB_SOURCE_MODE"); mode {
+	case "", "precedence":
+	case "consensus":
+		consensus = true
+		if len(paths) < 2 {
+			slog.Error("MMDB_SOURCE_MODE=consensus requires MMDB_PATH to list several sources")
+			os.Exit(1)
+		}
+	default:
+		slog.Error("invalid MMDB_SOURCE_MODE", "value", mode)
 		os.Exit(1)
 	}
 
-	lookup, err := data.NewMmdbReader(mmdbPath)
+	watchMode, err := data.ParseWatchMode(os.Getenv("MMDB_WATCH_MODE"))
 	if err != nil {
-		slog.Error("failed to open MMDB", "path", mmdbPath, "error", err)
+		slog.Error("invalid MMDB_WATCH_MODE", "error", err)
 		os.Exit(1)
 	}
-	defer lookup.Close()
 
-	slog.Info("MMDB loaded", "path", mmdbPath)
+	loadMode, err := data.ParseLoadMode(os.Getenv("MMDB_LOAD_MODE"))
+	if err != nil {
+		slog.Error("invalid MMDB_LOAD_MODE", "error", err)
+		os.Exit(1)
+	}
 
-	// Register health endpoints
-	healthHandler := health.NewHandler(func() error {
-		readyIP := net.ParseIP("8.8.8.8")
-		if readyIP == nil {
-			return errors.New("ready check IP is invalid")
+	pollInterval := data.DefaultPollInterval
+	if v := os.Getenv("MMDB_POLL_INTERVAL"); v != "" {
+		pollInterval, err = time.ParseDuration(v)
+		if err != nil || pollInterval <= 0 {
+			slog.Error("invalid MMDB_POLL_INTERVAL", "value", v, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	probes, err := data.ParseProbes(os.Getenv("MMDB_PROBES"))
+	if err != nil {
+		slog.Error("invalid MMDB_PROBES", "error", err)
+		os.Exit(1)
+	}
+
+	databaseTypes := data.CountryDatabaseTypes
+	if v := os.Getenv("MMDB_DATABASE_TYPES"); v != "" {
+		databaseTypes = splitList(v)
+	}
+
+	allowDowngrade := false
+	if v := os.Getenv("MMDB_ALLOW_DOWNGRADE"); v != "" {
+		allowDowngrade, err = strconv.ParseBool(v)
+		if err != nil {
+			slog.Error("invalid MMDB_ALLOW_DOWNGRADE", "value", v, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	retainGenerations := data.DefaultRetainGenerations
+	if v := os.Getenv("MMDB_RETAIN_GENERATIONS"); v != "" {
+		retainGenerations, err = strconv.Atoi(v)
+		if err != nil || retainGenerations < 0 {
+			slog.Error("invalid MMDB_RETAIN_GENERATIONS", "value", v, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	mmdbOpts := []data.Option{
+		data.WithWatchMode(watchMode),
+		data.WithPollInterval(pollInterval),
+		data.WithLoadMode(loadMode),
+		data.WithRejectOlderBuilds(!allowDowngrade),
+	}
+
+	// Options of the other watched files (overrides, policies), which keep
+	// the configured watch mode even if the MMDB readers do not watch
+	watchOpts := []data.Option{
+		data.WithWatchMode(watchMode),
+		data.WithPollInterval(pollInterval),
+	}
+
+	readerOpts := append(mmdbOpts,
+		data.WithDatabaseTypes(databaseTypes...),
+		data.WithRetainGenerations(retainGenerations),
+	)
+
+	// Optionally download MMDB_PATH in-process instead of relying on the
+	// geoipupdate CronJob; the file then needs no watching.
+	runCtx, stopRun := context.WithCancel(context.Background())
+	defer stopRun()
+	var downloader *data.Downloader
+	if downloadURL := os.Getenv("MMDB_DOWNLOAD_URL"); downloadURL != "" {
+		if len(paths) != 1 || isCSV(paths[0]) {
+			slog.Error("MMDB_DOWNLOAD_URL requires MMDB_PATH to name a single MMDB")
+			os.Exit(1)
+		}
+		mmdbPath := paths[0]
+		// Downloaded editions are checked like a reload before they replace
+		// the file, so a bad edition never reaches the disk.
+		validateOpts := slices.Concat(readerOpts, []data.Option{data.WithProbes(probes...)})
+		downloader = newDownloader(downloadURL, mmdbPath, func(path string) error {
+			return data.ValidateMmdbFile(path, mmdbPath, validateOpts...)
+		})
+		if _, err := downloader.Update(runCtx); err != nil {
+			if _, statErr := os.Stat(mmdbPath); statErr != nil {
+				slog.Error("initial MMDB download failed", "error", err)
+				os.Exit(1)
+			}
+			slog.Warn("MMDB download failed; using existing file", "path", mmdbPath, "error", err)
+		}
+	}
+	mmdbWatch := mmdbWatchMode(watchMode, os.Getenv("MMDB_WATCH_MODE") != "", downloader != nil)
+	readerOpts = append(readerOpts, data.WithWatchMode(mmdbWatch))
+
+	// Open every source with its own hot-reload. In precedence mode the
+	// probes must resolve in the last (fallback) database; the sources
+	// before it usually cover a few networks only. Consensus sources are
+	// full databases and are all probed.
+	var sources []data.Source
+	for i, path := range paths {
+		var sourceProbes []data.Probe
+		if consensus || i == len(paths)-1 {
+			sourceProbes = probes
+		}
+
+		var src countrySource
+		if isCSV(path) {
+			src, err = data.NewCsvReader(path,
+				data.WithWatchMode(watchMode),
+				data.WithPollInterval(pollInterval),
+				data.WithProbes(sourceProbes...),
+			)
+			if err != nil {
+				slog.Error("failed to load CSV ranges", "path", path, "error", err)
+				os.Exit(1)
+			}
+			slog.Info("CSV ranges loaded", "path", path, "watch_mode", watchMode.String(), "probes", len(sourceProbes))
+		} else {
+			src, err = data.NewMmdbReader(path, append(readerOpts, data.WithProbes(sourceProbes...))...)
+			if err != nil {
+				slog.Error("failed to open MMDB", "path", path, "error", err)
+				os.Exit(1)
+			}
+			slog.Info("MMDB loaded", "path", path, "watch_mode", mmdbWatch.String(), "load_mode", loadMode.String(), "probes", len(sourceProbes))
+		}
+		sources = append(sources, data.Source{Name: filepath.Base(path), Lookup: src})
+	}
+
+	// Generation rollback is only available for a single MMDB.
+	var source countrySource
+	var generations data.GenerationManager
+	switch {
+	case len(sources) == 1:
+		source = sources[0].Lookup.(countrySource)
+		generations, _ = source.(data.GenerationManager)
+	case consensus:
+		source = data.NewConsensusLookup(sources...)
+	default:
+		source = data.NewCompositeLookup(sources...)
+	}
+
+	if downloader != nil {
+		go downloader.Run(runCtx, source.Reload)
+	}
+	var lookup data.CountryLookup = source
+
+	// Answer private, loopback, CGNAT and other special-purpose addresses
+	// from their class policy instead of the database; classes that are not
+	// configured are denied. Overrides wrap the classifier, so an override
+	// for a private range wins over its class
+	classPolicies, err := data.ParseClassPolicies(os.Getenv("ADDRESS_CLASS_POLICY"))
+	if err != nil {
+		slog.Error("invalid ADDRESS_CLASS_POLICY", "error", err)
+		os.Exit(1)
+	}
+	lookup = data.NewAddressClassifier(lookup, classPolicies)
+
+	// Every reader behind lookup, so a lookup cache can be purged on reload
+	reloaders := []data.ReloadNotifier{source}
+
+	// Optionally answer from a table of CIDR overrides before the database
+	if overridesPath := os.Getenv("OVERRIDES_PATH"); overridesPath != "" {
+		overrides, err := data.NewOverrideLookup(lookup, overridesPath, watchOpts...)
+		if err != nil {
+			slog.Error("failed to load overrides", "path", overridesPath, "error", err)
+			os.Exit(1)
 		}
-		_, err := lookup.LookupCountry(readyIP)
+		lookup = overrides
+		reloaders = append(reloaders, overrides)
+
+		slog.Info("overrides loaded", "path", overridesPath, "watch_mode", watchMode.String())
+	}
+
+	// Optionally enrich lookups with ASN data from a second MMDB
+	if asnPath := os.Getenv("ASN_MMDB_PATH"); asnPath != "" {
+		asnReader, err := data.NewMmdbReader(asnPath, append(mmdbOpts,
+			data.WithDatabaseTypes(data.ASNDatabaseTypes...),
+		)...)
 		if err != nil {
-			return err
+			slog.Error("failed to open ASN MMDB", "path", asnPath, "error", err)
+			os.Exit(1)
 		}
-		return nil
-	})
+		lookup = data.NewASNEnricher(lookup, asnReader)
+		reloaders = append(reloaders, asnReader)
+
+		slog.Info("ASN MMDB loaded", "path", asnPath)
+	}
+
+	// Optionally enrich lookups with anonymizer flags (VPN, Tor, proxies)
+	if anonymousPath := os.Getenv("ANONYMOUS_IP_MMDB_PATH"); anonymousPath != "" {
+		anonymousReader, err := data.NewMmdbReader(anonymousPath, append(mmdbOpts,
+			data.WithDatabaseTypes(data.AnonymousIPDatabaseTypes...),
+		)...)
+		if err != nil {
+			slog.Error("failed to open Anonymous-IP MMDB", "path", anonymousPath, "error", err)
+			os.Exit(1)
+		}
+		lookup = data.NewAnonymousIPEnricher(lookup, anonymousReader)
+		reloaders = append(reloaders, anonymousReader)
+
+		slog.Info("Anonymous-IP MMDB loaded", "path", anonymousPath)
+	}
+	// Optionally cache lookup results of hot IPs; the cache is purged
+	// whenever any reader swaps its data
+	var cache *data.CachedLookup
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		cacheSize, err := strconv.Atoi(v)
+		if err != nil || cacheSize < 0 {
+			slog.Error("invalid CACHE_SIZE", "value", v, "error", err)
+			os.Exit(1)
+		}
+		var cacheTTL time.Duration
+		if v := os.Getenv("CACHE_TTL"); v != "" {
+			cacheTTL, err = time.ParseDuration(v)
+			if err != nil || cacheTTL < 0 {
+				slog.Error("invalid CACHE_TTL", "value", v, "error", err)
+				os.Exit(1)
+			}
+		}
+		if cacheSize > 0 {
+			cache = data.NewCachedLookup(lookup, cacheSize, cacheTTL, reloaders...)
+			lookup = cache
+
+			slog.Info("lookup cache enabled", "size", cacheSize, "ttl", cacheTTL.String())
+		}
+	}
+	// Geolocate the IPv4 address embedded in NAT64, 6to4 and Teredo
+	// addresses; it is classified like any other IPv4 address
+	lookup = data.NewTranslatingLookup(lookup)
+	defer lookup.Close()
+
+	// Custom country groups (e.g. DACH) accepted next to the built-in EU,
+	// EEA and continent groups
+	groups, err := policy.ParseGroups(os.Getenv("COUNTRY_GROUPS"))
+	if err != nil {
+		slog.Error("invalid COUNTRY_GROUPS", "error", err)
+		os.Exit(1)
+	}
+
+	// Optionally serve named policies that check requests reference by
+	// policy_id instead of sending their rules inline
+	var policies *policy.Store
+	if policyDir := os.Getenv("POLICY_DIR"); policyDir != "" {
+		policies, err = policy.NewStore(policyDir, groups, watchOpts...)
+		if err != nil {
+			slog.Error("failed to load policies", "path", policyDir, "error", err)
+			os.Exit(1)
+		}
+		defer policies.Close()
+
+		slog.Info("policies loaded", "path", policyDir, "policies", policies.Len(), "watch_mode", watchMode.String())
+	}
+	// Rules that need the ASN or Anonymous-IP database are rejected when it
+	// is not loaded, instead of silently never matching
+	resolver := policy.NewResolver(policies, groups, policy.WithDatabases(
+		os.Getenv("ASN_MMDB_PATH") != "",
+		os.Getenv("ANONYMOUS_IP_MMDB_PATH") != "",
+	))
+
+	// Register health endpoints
+	// Readiness runs the MMDB_PROBES against the currently loaded database
+	healthHandler := health.NewHandler(source.Ready)
 	router.GET("/health", healthHandler.Health)
 	router.GET("/ready", healthHandler.Ready)
 
 	// Register API endpoints
-	checkHandler := check.NewHandler(lookup)
+	checkHandler := check.NewHandler(lookup, resolver)
+	databaseHandler := database.NewHandler(source)
 	api := router.Group("/api/v1")
 	{
 		api.POST("/check", checkHandler.Check)
+		api.GET("/database", databaseHandler.Get)
+		if cache != nil {
+			api.GET("/cache", cacheHandler.NewHandler(cache.Stats).Get)
+		}
 	}
 
 	// Create HTTP server
@@ -99,9 +379,35 @@ func main() {
 		Handler: router,
 	}
 
+	// Create the admin HTTP server (generation rollback) only when ADMIN_PORT
+	// is set; it must not be exposed through the public Service.
+	var adminSrv *http.Server
+	adminPort := os.Getenv("ADMIN_PORT")
+	if adminPort != "" && generations == nil {
+		slog.Warn("ADMIN_PORT ignored: generation rollback requires MMDB_PATH to name a single MMDB")
+	} else if adminPort != "" {
+		adminRouter := gin.New()
+		adminRouter.Use(ginLogger(logger))
+		adminRouter.Use(gin.Recovery())
+
+		adminHandler := database.NewAdminHandler(generations)
+		admin := adminRouter.Group("/admin/v1")
+		{
+			admin.GET("/generations", adminHandler.List)
+			admin.POST("/generations/:id/revert", adminHandler.Revert)
+			admin.POST("/pin", adminHandler.Pin)
+			admin.POST("/unpin", adminHandler.Unpin)
+		}
+
+		adminSrv = &http.Server{
+			Addr:    ":" + adminPort,
+			Handler: adminRouter,
+		}
+	}
+
 	// Create gRPC server
 	grpcServer := grpc.NewServer()
-	grpcSvc := grpcHandler.NewHandler(lookup)
+	grpcSvc := grpcHandler.NewHandler(lookup, source, resolver)
 	geofencev1.RegisterGeofenceServiceServer(grpcServer, grpcSvc)
 
 	grpcListener, err := net.Listen("tcp", ":"+grpcPort)
@@ -119,6 +425,17 @@ func main() {
 		}
 	}()
 
+	// Start admin server in a goroutine
+	if adminSrv != nil {
+		go func() {
+			slog.Info("admin service started", "port", adminSrv.Addr[1:])
+			if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("admin server failed to start", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Start gRPC server in a goroutine
 	go func() {
 		slog.Info("grpc service started", "port", grpcPort)
@@ -141,6 +458,12 @@ func main() {
 
 	grpcServer.GracefulStop()
 
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			slog.Error("admin server forced to shutdown", "error", err)
+		}
+	}
+
 	if err := srv.Shutdown(ctx); err != nil {
 		slog.Error("server forced to shutdown", "error", err)
 		os.Exit(1)
@@ -149,6 +472,68 @@ func main() {
 	slog.Info("service stopped")
 }
 
+// countrySource is a country database the service serves: an MmdbReader, a
+// CsvReader or a CompositeLookup of them.
+type countrySource interface {
+	data.CountryLookup
+	data.MetadataProvider
+	data.ReloadNotifier
+	Ready() error
+	Reload() error
+}
+
+// mmdbWatchMode returns the watch mode of the MMDB_PATH readers. The
+// in-process downloader reloads them itself, so they are not watched unless
+// MMDB_WATCH_MODE is set explicitly; every other watched file keeps the
+// configured mode.
+func mmdbWatchMode(configured data.WatchMode, explicit, downloading bool) data.WatchMode {
+	if downloading && !explicit {
+		return data.WatchNone
+	}
+	return configured
+}
+
+// isCSV reports whether path names a CSV range file.
+func isCSV(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+// newDownloader creates the MMDB downloader from the MMDB_DOWNLOAD_*
+// environment variables, exiting on invalid configuration. validate checks
+// each edition before it is installed.
+func newDownloader(downloadURL, dest string, validate func(path string) error) *data.Downloader {
+	opts := []data.DownloaderOption{
+		data.WithCredentials(os.Getenv("MMDB_DOWNLOAD_ACCOUNT_ID"), os.Getenv("MMDB_DOWNLOAD_LICENSE_KEY")),
+		data.WithValidator(validate),
+	}
+	if v := os.Getenv("MMDB_DOWNLOAD_SHA256_URL"); v != "" {
+		opts = append(opts, data.WithSHA256URL(v))
+	}
+	if v := os.Getenv("MMDB_DOWNLOAD_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			slog.Error("invalid MMDB_DOWNLOAD_INTERVAL", "value", v, "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, data.WithDownloadInterval(interval))
+	}
+	if v := os.Getenv("MMDB_DOWNLOAD_MAX_SIZE"); v != "" {
+		maxSize, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || maxSize <= 0 {
+			slog.Error("invalid MMDB_DOWNLOAD_MAX_SIZE", "value", v, "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, data.WithMaxDownloadSize(maxSize))
+	}
+
+	downloader, err := data.NewDownloader(downloadURL, dest, opts...)
+	if err != nil {
+		slog.Error("invalid MMDB_DOWNLOAD_URL", "error", err)
+		os.Exit(1)
+	}
+	return downloader
+}
+
 // getLogLevel converts string log level to slog.Level
 func getLogLevel(level string) slog.Level {
 	switch level {
@@ -197,3 +582,15 @@ func ginLogger(logger *slog.Logger) gin.HandlerFunc {
 		}
 	}
 }
+
+// splitList splits a comma-separated list, trimming whitespace and dropping
+// empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
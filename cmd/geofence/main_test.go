@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/TomasB/geofence/internal/data"
+)
+
+func TestMmdbWatchMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		configured  data.WatchMode
+		explicit    bool
+		downloading bool
+		want        data.WatchMode
+	}{
+		{"no downloader", data.WatchNotify, false, false, data.WatchNotify},
+		{"downloader", data.WatchNotify, false, true, data.WatchNone},
+		{"downloader with explicit mode", data.WatchPoll, true, true, data.WatchPoll},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mmdbWatchMode(tt.configured, tt.explicit, tt.downloading); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package data
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// AddressClass names a special-purpose address range of the IANA IPv4 and
+// IPv6 Special-Purpose Address Registries. Globally routable addresses have
+// no class.
+type AddressClass string
+
+const (
+	ClassUnspecified   AddressClass = "unspecified"   // 0.0.0.0/8, ::/128
+	ClassPrivate       AddressClass = "private"       // RFC 1918, fc00::/7
+	ClassCGNAT         AddressClass = "cgnat"         // 100.64.0.0/10
+	ClassLoopback      AddressClass = "loopback"      // 127.0.0.0/8, ::1/128
+	ClassLinkLocal     AddressClass = "link_local"    // 169.254.0.0/16, fe80::/10
+	ClassDocumentation AddressClass = "documentation" // TEST-NET-1/2/3, 2001:db8::/32, 3fff::/20
+	ClassBenchmarking  AddressClass = "benchmarking"  // 198.18.0.0/15, 2001:2::/48
+	ClassMulticast     AddressClass = "multicast"     // 224.0.0.0/4, ff00::/8
+	ClassBroadcast     AddressClass = "broadcast"     // 255.255.255.255/32
+	ClassReserved      AddressClass = "reserved"      // 192.0.0.0/24, 240.0.0.0/4, 100::/64, 64:ff9b:1::/48
+)
+
+// AddressClasses lists every class, e.g. for validating configuration.
+var AddressClasses = []AddressClass{
+	ClassUnspecified, ClassPrivate, ClassCGNAT, ClassLoopback, ClassLinkLocal,
+	ClassDocumentation, ClassBenchmarking, ClassMulticast, ClassBroadcast, ClassReserved,
+}
+
+// specialNetwork is an entry of the special-purpose registries.
+type specialNetwork struct {
+	network *net.IPNet
+	class   AddressClass
+}
+
+// specialNetworks lists the special-purpose ranges, most specific first.
+// IPv4-mapped IPv6 addresses are classified as IPv4; the NAT64, 6to4 and
+// Teredo prefixes embed global IPv4 addresses and are left unclassified.
+// The local-use NAT64 prefix 64:ff9b:1::/48 (RFC 8215) is reserved, as its
+// addresses are only meaningful inside the network that assigns them.
+var specialNetworks = mustSpecialNetworks(map[string]AddressClass{
+	"255.255.255.255/32": ClassBroadcast,
+	"192.0.0.0/24":       ClassReserved,
+	"192.0.2.0/24":       ClassDocumentation,
+	"198.51.100.0/24":    ClassDocumentation,
+	"203.0.113.0/24":     ClassDocumentation,
+	"198.18.0.0/15":      ClassBenchmarking,
+	"169.254.0.0/16":     ClassLinkLocal,
+	"192.168.0.0/16":     ClassPrivate,
+	"172.16.0.0/12":      ClassPrivate,
+	"100.64.0.0/10":      ClassCGNAT,
+	"0.0.0.0/8":          ClassUnspecified,
+	"10.0.0.0/8":         ClassPrivate,
+	"127.0.0.0/8":        ClassLoopback,
+	"224.0.0.0/4":        ClassMulticast,
+	"240.0.0.0/4":        ClassReserved,
+
+	"::/128":         ClassUnspecified,
+	"::1/128":        ClassLoopback,
+	"100::/64":       ClassReserved,
+	"64:ff9b:1::/48": ClassReserved,
+	"2001:2::/48":    ClassBenchmarking,
+	"2001:db8::/32":  ClassDocumentation,
+	"3fff::/20":      ClassDocumentation,
+	"fe80::/10":      ClassLinkLocal,
+	"fc00::/7":       ClassPrivate,
+	"ff00::/8":       ClassMulticast,
+})
+
+func mustSpecialNetworks(ranges map[string]AddressClass) []specialNetwork {
+	networks := make([]specialNetwork, 0, len(ranges))
+	for cidr, class := range ranges {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, specialNetwork{network: network, class: class})
+	}
+	// The ranges only nest within a family (255.255.255.255/32 inside
+	// 240.0.0.0/4), so ordering by prefix length is enough.
+	slices.SortFunc(networks, func(a, b specialNetwork) int {
+		return prefixBits(b.network) - prefixBits(a.network)
+	})
+	return networks
+}
+
+// ClassifyAddress returns the special-purpose class of ip, or "" for a
+// globally routable address.
+func ClassifyAddress(ip net.IP) AddressClass {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, s := range specialNetworks {
+		if s.network.Contains(ip) {
+			return s.class
+		}
+	}
+	return ""
+}
+
+// ClassAction is what an AddressClassifier does with addresses of a class.
+type ClassAction int
+
+const (
+	// ClassDeny denies the address without a lookup. This is the default.
+	ClassDeny ClassAction = iota
+	// ClassAllow allows the address without a lookup.
+	ClassAllow
+	// ClassCountry treats the address as located in a configured country
+	// and evaluates the request rules as usual.
+	ClassCountry
+)
+
+// ClassPolicy is the configured handling of one address class.
+type ClassPolicy struct {
+	Action ClassAction
+	// Country is the ISO-3166-1 alpha-2 code used by ClassCountry.
+	Country string
+}
+
+// ParseClassPolicies parses a comma-separated list of class=action pairs,
+// where action is "allow", "deny" or "country:XX", e.g.
+// "private=allow,cgnat=country:US". The country may be given in any form
+// NormalizeCountry accepts. Classes that are not listed are denied.
+func ParseClassPolicies(s string) (map[AddressClass]ClassPolicy, error) {
+	policies := make(map[AddressClass]ClassPolicy)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, action, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid class policy %q: expected class=action", entry)
+		}
+		class := AddressClass(strings.ToLower(strings.TrimSpace(name)))
+		if !slices.Contains(AddressClasses, class) {
+			return nil, fmt.Errorf("invalid class policy %q: unknown address class %q", entry, class)
+		}
+
+		action = strings.TrimSpace(action)
+		switch country, isCountry := strings.CutPrefix(action, "country:"); {
+		case action == "allow":
+			policies[class] = ClassPolicy{Action: ClassAllow}
+		case action == "deny":
+			policies[class] = ClassPolicy{Action: ClassDeny}
+		case isCountry:
+			alpha2, ok := NormalizeCountry(country)
+			if !ok {
+				return nil, fmt.Errorf("invalid class policy %q: unknown country code %q", entry, country)
+			}
+			policies[class] = ClassPolicy{Action: ClassCountry, Country: alpha2}
+		default:
+			return nil, fmt.Errorf("invalid class policy %q: action must be allow, deny or country:XX", entry)
+		}
+	}
+	return policies, nil
+}
+
+// AddressClassifier implements CountryLookup by classifying special-purpose
+// addresses (private, loopback, CGNAT, ...) before they reach the
+// databases, which know nothing about them. Classified addresses are not
+// looked up: the result carries the AddressClass and the ClassAction of the
+// configured policy, and ClassCountry policies set the country.
+type AddressClassifier struct {
+	lookup   CountryLookup
+	policies map[AddressClass]ClassPolicy
+}
+
+// NewAddressClassifier returns a CountryLookup that answers special-purpose
+// addresses from policies and looks up every other address with lookup.
+// Classes without a policy are denied. Closing it closes lookup.
+func NewAddressClassifier(lookup CountryLookup, policies map[AddressClass]ClassPolicy) *AddressClassifier {
+	return &AddressClassifier{lookup: lookup, policies: policies}
+}
+
+// LookupCountry returns the ISO-3166 country code for the given IP address.
+func (a *AddressClassifier) LookupCountry(ip net.IP) (string, error) {
+	result, err := a.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	return result.Country, nil
+}
+
+// Lookup classifies the IP address and either answers from the class
+// policy or looks the address up.
+func (a *AddressClassifier) Lookup(ip net.IP) (*LookupResult, error) {
+	class := ClassifyAddress(ip)
+	if class == "" {
+		return a.lookup.Lookup(ip)
+	}
+	p := a.policies[class]
+	return &LookupResult{Country: p.Country, AddressClass: class, ClassAction: p.Action}, nil
+}
+
+// Close releases the wrapped lookup.
+func (a *AddressClassifier) Close() error {
+	return a.lookup.Close()
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"net"
+	"testing"
+)
+
+func TestClassifyAddress(t *testing.T) {
+	tests := []struct {
+		ip    string
+		class AddressClass
+	}{
+		{"0.0.0.0", ClassUnspecified},
+		{"10.1.2.3", ClassPrivate},
+		{"172.31.255.255", ClassPrivate},
+		{"172.32.0.1", ""},
+		{"192.168.1.1", ClassPrivate},
+		{"::ffff:10.0.0.1", ClassPrivate},
+		{"fd12:3456::1", ClassPrivate},
+		{"100.64.0.1", ClassCGNAT},
+		{"100.128.0.1", ""},
+		{"127.0.0.1", ClassLoopback},
+		{"::1", ClassLoopback},
+		{"169.254.169.254", ClassLinkLocal},
+		{"fe80::1", ClassLinkLocal},
+		{"192.0.2.1", ClassDocumentation},
+		{"203.0.113.7", ClassDocumentation},
+		{"2001:db8::1", ClassDocumentation},
+		{"198.19.0.1", ClassBenchmarking},
+		{"224.0.0.251", ClassMulticast},
+		{"ff02::1", ClassMulticast},
+		{"255.255.255.255", ClassBroadcast},
+		{"240.0.0.1", ClassReserved},
+		{"64:ff9b:1::a00:1", ClassReserved},
+		{"::", ClassUnspecified},
+		{"8.8.8.8", ""},
+		{"2001:4860:4860::8888", ""},
+		// Translation prefixes embed global IPv4 addresses.
+		{"64:ff9b::808:808", ""},
+		{"2002:808:808::1", ""},
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if class := ClassifyAddress(net.ParseIP(tt.ip)); class != tt.class {
+				t.Errorf("expected %q, got %q", tt.class, class)
+			}
+		})
+	}
+}
+
+func TestParseClassPolicies(t *testing.T) {
+	policies, err := ParseClassPolicies("private=allow, CGNAT=country:us,loopback=deny")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[AddressClass]ClassPolicy{
+		ClassPrivate:  {Action: ClassAllow},
+		ClassCGNAT:    {Action: ClassCountry, Country: "US"},
+		ClassLoopback: {Action: ClassDeny},
+	}
+	if len(policies) != len(want) {
+		t.Fatalf("expected %d policies, got %v", len(want), policies)
+	}
+	for class, p := range want {
+		if policies[class] != p {
+			t.Errorf("%s: expected %+v, got %+v", class, p, policies[class])
+		}
+	}
+
+	if policies, err := ParseClassPolicies(""); err != nil || len(policies) != 0 {
+		t.Errorf("expected no policies, got %v, %v", policies, err)
+	}
+
+	if policies, err := ParseClassPolicies("cgnat=country:UK"); err != nil || policies[ClassCGNAT].Country != "GB" {
+		t.Errorf("expected UK to be normalized to GB, got %v, %v", policies, err)
+	}
+
+	for _, invalid := range []string{"private", "public=allow", "private=permit", "cgnat=country:XX", "cgnat=country:"} {
+		if _, err := ParseClassPolicies(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestAddressClassifier_Lookup(t *testing.T) {
+	inner := &countingLookup{country: "SE"}
+	a := NewAddressClassifier(inner, map[AddressClass]ClassPolicy{
+		ClassPrivate: {Action: ClassAllow},
+		ClassCGNAT:   {Action: ClassCountry, Country: "US"},
+	})
+
+	tests := []struct {
+		ip      string
+		country string
+		class   AddressClass
+		action  ClassAction
+	}{
+		{"10.0.0.1", "", ClassPrivate, ClassAllow},
+		{"100.64.0.1", "US", ClassCGNAT, ClassCountry},
+		{"127.0.0.1", "", ClassLoopback, ClassDeny},
+	}
+	for _, tt := range tests {
+		result, err := a.Lookup(net.ParseIP(tt.ip))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.ip, err)
+		}
+		if result.Country != tt.country || result.AddressClass != tt.class || result.ClassAction != tt.action {
+			t.Errorf("%s: expected %q/%q/%d, got %q/%q/%d", tt.ip, tt.country, tt.class, tt.action,
+				result.Country, result.AddressClass, result.ClassAction)
+		}
+	}
+	if inner.calls != 0 {
+		t.Errorf("expected special-purpose addresses not to be looked up, got %d lookups", inner.calls)
+	}
+
+	country, err := a.LookupCountry(net.ParseIP("89.160.20.112"))
+	if err != nil || country != "SE" {
+		t.Errorf("expected SE from the wrapped lookup, got %q, %v", country, err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("expected 1 lookup, got %d", inner.calls)
+	}
+}
+
+func TestAddressClassifier_OverridesWin(t *testing.T) {
+	inner := &countingLookup{country: "SE"}
+	classifier := NewAddressClassifier(inner, map[AddressClass]ClassPolicy{
+		ClassPrivate: {Action: ClassAllow},
+	})
+	o, err := NewOverrideLookup(classifier, writeOverrides(t, `[
+  {"network": "10.1.0.0/16", "country": "DE", "reason": "Frankfurt office LAN"}
+]`), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to load overrides: %v", err)
+	}
+	defer o.Close()
+
+	result, err := o.Lookup(net.ParseIP("10.1.2.3"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Country != "DE" || result.Override == nil || result.AddressClass != "" {
+		t.Errorf("expected the override to win over the private class, got %+v", result)
+	}
+
+	result, err = o.Lookup(net.ParseIP("10.2.0.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.AddressClass != ClassPrivate || result.ClassAction != ClassAllow {
+		t.Errorf("expected the private class outside the override, got %+v", result)
+	}
+	if inner.calls != 0 {
+		t.Errorf("expected special-purpose addresses not to be looked up, got %d lookups", inner.calls)
+	}
+}
@@ -0,0 +1,47 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// AnonymousIPEnricher implements CountryLookup by decorating another
+// CountryLookup with the anonymizer flags (VPN, Tor, hosting, proxies) of a
+// GeoIP2-Anonymous-IP database.
+type AnonymousIPEnricher struct {
+	lookup    CountryLookup
+	anonymous AnonymousIPLookup
+}
+
+// NewAnonymousIPEnricher returns a CountryLookup that resolves countries with
+// lookup and fills the Anonymous flags of every result from anonymous.
+// Closing the enricher closes both.
+func NewAnonymousIPEnricher(lookup CountryLookup, anonymous AnonymousIPLookup) *AnonymousIPEnricher {
+	return &AnonymousIPEnricher{lookup: lookup, anonymous: anonymous}
+}
+
+// LookupCountry returns the ISO-3166 country code for the given IP address.
+func (e *AnonymousIPEnricher) LookupCountry(ip net.IP) (string, error) {
+	return e.lookup.LookupCountry(ip)
+}
+
+// Lookup returns the geolocation record for the given IP address with the
+// anonymizer flags filled in.
+func (e *AnonymousIPEnricher) Lookup(ip net.IP) (*LookupResult, error) {
+	result, err := e.lookup.Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+	anonymous, err := e.anonymous.LookupAnonymousIP(ip)
+	if err != nil {
+		return nil, fmt.Errorf("anonymous ip enrichment failed: %w", err)
+	}
+	result.Anonymous = *anonymous
+	return result, nil
+}
+
+// Close releases both the country and the anonymous IP lookups.
+func (e *AnonymousIPEnricher) Close() error {
+	return errors.Join(e.lookup.Close(), e.anonymous.Close())
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+)
+
+const testAnonymousIPMMDBPath = "../../testdata/GeoIP2-Anonymous-IP-Test.mmdb"
+
+type stubAnonymousIPLookup struct {
+	anonymous *AnonymousIP
+	err       error
+	closed    bool
+}
+
+func (s *stubAnonymousIPLookup) LookupAnonymousIP(_ net.IP) (*AnonymousIP, error) {
+	return s.anonymous, s.err
+}
+
+func (s *stubAnonymousIPLookup) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestAnonymousIPEnricher_Lookup(t *testing.T) {
+	country := &stubCountryLookup{result: &LookupResult{Country: "US"}}
+	anonymous := &stubAnonymousIPLookup{anonymous: &AnonymousIP{IsAnonymous: true, IsTorExitNode: true}}
+	e := NewAnonymousIPEnricher(country, anonymous)
+
+	result, err := e.Lookup(net.ParseIP("65.0.0.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Country != "US" {
+		t.Errorf("expected country US, got %s", result.Country)
+	}
+	if !result.Anonymous.IsAnonymous || !result.Anonymous.IsTorExitNode {
+		t.Errorf("expected anonymous Tor exit node, got %+v", result.Anonymous)
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if !country.closed || !anonymous.closed {
+		t.Error("expected both lookups to be closed")
+	}
+}
+
+func TestAnonymousIPEnricher_LookupError(t *testing.T) {
+	e := NewAnonymousIPEnricher(
+		&stubCountryLookup{result: &LookupResult{Country: "US"}},
+		&stubAnonymousIPLookup{err: errors.New("db failure")},
+	)
+
+	if _, err := e.Lookup(net.ParseIP("65.0.0.1")); err == nil {
+		t.Fatal("expected error when anonymous IP lookup fails")
+	}
+}
+
+func TestMmdbReader_LookupAnonymousIP(t *testing.T) {
+	if _, err := os.Stat(testAnonymousIPMMDBPath); os.IsNotExist(err) {
+		t.Skip("test Anonymous-IP MMDB file not found; download it with: curl -L -o testdata/GeoIP2-Anonymous-IP-Test.mmdb https://github.com/maxmind/MaxMind-DB/raw/main/test-data/GeoIP2-Anonymous-IP-Test.mmdb")
+	}
+
+	reader, err := NewMmdbReader(testAnonymousIPMMDBPath)
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	tests := []struct {
+		name string
+		ip   string
+		want AnonymousIP
+	}{
+		{
+			name: "vpn",
+			ip:   "1.2.0.1",
+			want: AnonymousIP{IsAnonymous: true, IsAnonymousVPN: true},
+		},
+		{
+			name: "tor exit node",
+			ip:   "65.0.0.1",
+			want: AnonymousIP{IsAnonymous: true, IsTorExitNode: true},
+		},
+		{
+			name: "hosting provider",
+			ip:   "71.160.223.1",
+			want: AnonymousIP{IsAnonymous: true, IsHostingProvider: true},
+		},
+		{
+			name: "not anonymous",
+			ip:   "8.8.8.8",
+			want: AnonymousIP{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anonymous, err := reader.LookupAnonymousIP(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *anonymous != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, *anonymous)
+			}
+		})
+	}
+}
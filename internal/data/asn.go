@@ -0,0 +1,48 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ASNEnricher implements CountryLookup by decorating another CountryLookup
+// with autonomous system attributes from a separate ASN database, such as
+// GeoLite2-ASN loaded next to the Country database.
+type ASNEnricher struct {
+	lookup CountryLookup
+	asn    ASNLookup
+}
+
+// NewASNEnricher returns a CountryLookup that resolves countries with lookup
+// and fills the ASN fields of every result from asn. Closing the enricher
+// closes both.
+func NewASNEnricher(lookup CountryLookup, asn ASNLookup) *ASNEnricher {
+	return &ASNEnricher{lookup: lookup, asn: asn}
+}
+
+// LookupCountry returns the ISO-3166 country code for the given IP address.
+func (e *ASNEnricher) LookupCountry(ip net.IP) (string, error) {
+	return e.lookup.LookupCountry(ip)
+}
+
+// Lookup returns the geolocation record for the given IP address with the
+// ASN and AS organisation filled in.
+func (e *ASNEnricher) Lookup(ip net.IP) (*LookupResult, error) {
+	result, err := e.lookup.Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+	asn, err := e.asn.LookupASN(ip)
+	if err != nil {
+		return nil, fmt.Errorf("asn enrichment failed: %w", err)
+	}
+	result.ASN = asn.Number
+	result.ASOrganization = asn.Organization
+	return result, nil
+}
+
+// Close releases both the country and the ASN lookups.
+func (e *ASNEnricher) Close() error {
+	return errors.Join(e.lookup.Close(), e.asn.Close())
+}
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+)
+
+const testASNMMDBPath = "../../testdata/GeoLite2-ASN-Test.mmdb"
+
+type stubCountryLookup struct {
+	result *LookupResult
+	closed bool
+}
+
+func (s *stubCountryLookup) LookupCountry(_ net.IP) (string, error) {
+	return s.result.Country, nil
+}
+
+func (s *stubCountryLookup) Lookup(_ net.IP) (*LookupResult, error) {
+	r := *s.result
+	return &r, nil
+}
+
+func (s *stubCountryLookup) Close() error {
+	s.closed = true
+	return nil
+}
+
+type stubASNLookup struct {
+	asn    *ASN
+	err    error
+	closed bool
+}
+
+func (s *stubASNLookup) LookupASN(_ net.IP) (*ASN, error) {
+	return s.asn, s.err
+}
+
+func (s *stubASNLookup) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestASNEnricher_Lookup(t *testing.T) {
+	country := &stubCountryLookup{result: &LookupResult{Country: "AU"}}
+	asn := &stubASNLookup{asn: &ASN{Number: 1221, Organization: "Telstra Pty Ltd"}}
+	e := NewASNEnricher(country, asn)
+
+	result, err := e.Lookup(net.ParseIP("1.128.0.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Country != "AU" {
+		t.Errorf("expected country AU, got %s", result.Country)
+	}
+	if result.ASN != 1221 || result.ASOrganization != "Telstra Pty Ltd" {
+		t.Errorf("expected ASN 1221 Telstra Pty Ltd, got %d %s", result.ASN, result.ASOrganization)
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if !country.closed || !asn.closed {
+		t.Error("expected both lookups to be closed")
+	}
+}
+
+func TestASNEnricher_LookupError(t *testing.T) {
+	e := NewASNEnricher(
+		&stubCountryLookup{result: &LookupResult{Country: "AU"}},
+		&stubASNLookup{err: errors.New("db failure")},
+	)
+
+	if _, err := e.Lookup(net.ParseIP("1.128.0.1")); err == nil {
+		t.Fatal("expected error when ASN lookup fails")
+	}
+}
+
+func TestMmdbReader_LookupASN(t *testing.T) {
+	if _, err := os.Stat(testASNMMDBPath); os.IsNotExist(err) {
+		t.Skip("test ASN MMDB file not found; download it with: curl -L -o testdata/GeoLite2-ASN-Test.mmdb https://github.com/maxmind/MaxMind-DB/raw/main/test-data/GeoLite2-ASN-Test.mmdb")
+	}
+
+	reader, err := NewMmdbReader(testASNMMDBPath)
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	asn, err := reader.LookupASN(net.ParseIP("1.128.0.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if asn.Number != 1221 {
+		t.Errorf("expected ASN 1221, got %d", asn.Number)
+	}
+	if asn.Organization != "Telstra Pty Ltd" {
+		t.Errorf("expected organization Telstra Pty Ltd, got %s", asn.Organization)
+	}
+}
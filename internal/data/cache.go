@@ -0,0 +1,162 @@
+package data
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats counts the lookups answered by a CachedLookup.
+type CacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	Size     int // entries currently cached
+	Capacity int // maximum number of entries
+}
+
+// cacheEntry is a cached lookup result.
+type cacheEntry struct {
+	key       [16]byte
+	result    LookupResult
+	expiresAt time.Time // zero if the entry does not expire
+}
+
+// CachedLookup implements CountryLookup by caching the results of another
+// CountryLookup in a fixed-size LRU keyed by IP address. Entries expire
+// after a TTL and the whole cache is purged whenever a ReloadNotifier it
+// was subscribed to swaps its data, so answers never outlive the database
+// generation that produced them.
+type CachedLookup struct {
+	lookup CountryLookup
+	size   int
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[[16]byte]*list.Element
+	lru     *list.List // most recently used first
+	epoch   uint64     // incremented by Purge; guards against caching stale results
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewCachedLookup returns a CountryLookup that caches up to size results of
+// lookup for ttl (zero caches until eviction or purge). The cache is purged
+// after every reload of the notifiers, which should include every reader
+// behind lookup. Closing it closes lookup.
+func NewCachedLookup(lookup CountryLookup, size int, ttl time.Duration, notifiers ...ReloadNotifier) *CachedLookup {
+	c := &CachedLookup{
+		lookup:  lookup,
+		size:    max(size, 1),
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[[16]byte]*list.Element),
+		lru:     list.New(),
+	}
+	for _, n := range notifiers {
+		n.OnReload(c.Purge)
+	}
+	return c
+}
+
+// LookupCountry returns the ISO-3166 country code for the given IP address.
+func (c *CachedLookup) LookupCountry(ip net.IP) (string, error) {
+	result, err := c.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	return result.Country, nil
+}
+
+// Lookup returns the cached result for the IP address, or looks it up and
+// caches it. Errors are not cached. Each call returns its own copy.
+func (c *CachedLookup) Lookup(ip net.IP) (*LookupResult, error) {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return c.lookup.Lookup(ip)
+	}
+	key := [16]byte(ip16)
+	now := c.now()
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if entry.expiresAt.IsZero() || now.Before(entry.expiresAt) {
+			c.lru.MoveToFront(elem)
+			result := entry.result
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return &result, nil
+		}
+		c.remove(elem)
+	}
+	epoch := c.epoch
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	result, err := c.lookup.Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry{key: key, result: *result}
+	if c.ttl > 0 {
+		entry.expiresAt = now.Add(c.ttl)
+	}
+	// An override must not be served past its expiry.
+	if o := result.Override; o != nil && !o.ExpiresAt.IsZero() && (entry.expiresAt.IsZero() || o.ExpiresAt.Before(entry.expiresAt)) {
+		entry.expiresAt = o.ExpiresAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A purge during the lookup means the result may come from a replaced
+	// generation; return it but do not cache it.
+	if c.epoch != epoch {
+		return result, nil
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+	return result, nil
+}
+
+// remove drops elem from the cache. c.mu must be held.
+func (c *CachedLookup) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// Purge drops every cached result.
+func (c *CachedLookup) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	clear(c.entries)
+	c.lru.Init()
+}
+
+// Stats returns the hit and miss counters and the current size.
+func (c *CachedLookup) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Size:     size,
+		Capacity: c.size,
+	}
+}
+
+// Close releases the wrapped lookup.
+func (c *CachedLookup) Close() error {
+	return c.lookup.Close()
+}
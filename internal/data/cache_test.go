@@ -0,0 +1,248 @@
+package data
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingLookup answers every IP with the same country and counts lookups.
+type countingLookup struct {
+	country string
+	err     error
+	calls   int
+}
+
+func (c *countingLookup) LookupCountry(ip net.IP) (string, error) {
+	result, err := c.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	return result.Country, nil
+}
+
+func (c *countingLookup) Lookup(_ net.IP) (*LookupResult, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &LookupResult{Country: c.country}, nil
+}
+
+func (c *countingLookup) Close() error {
+	return nil
+}
+
+func TestCachedLookup_HitsAndMisses(t *testing.T) {
+	inner := &countingLookup{country: "SE"}
+	c := NewCachedLookup(inner, 10, 0)
+
+	for i := 0; i < 3; i++ {
+		country, err := c.LookupCountry(net.ParseIP("89.160.20.112"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if country != "SE" {
+			t.Errorf("expected SE, got %s", country)
+		}
+	}
+	// The IPv4-mapped form shares the entry.
+	c.Lookup(net.ParseIP("::ffff:89.160.20.112"))
+
+	if inner.calls != 1 {
+		t.Errorf("expected 1 underlying lookup, got %d", inner.calls)
+	}
+	stats := c.Stats()
+	if stats.Hits != 3 || stats.Misses != 1 || stats.Size != 1 || stats.Capacity != 10 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCachedLookup_ReturnsCopies(t *testing.T) {
+	c := NewCachedLookup(&countingLookup{country: "SE"}, 10, 0)
+	ip := net.ParseIP("89.160.20.112")
+
+	first, _ := c.Lookup(ip)
+	first.Country = "XX"
+	second, _ := c.Lookup(ip)
+	if second.Country != "SE" {
+		t.Errorf("expected the cached entry to be unaffected, got %s", second.Country)
+	}
+}
+
+func TestCachedLookup_Eviction(t *testing.T) {
+	inner := &countingLookup{country: "US"}
+	c := NewCachedLookup(inner, 2, 0)
+
+	c.Lookup(net.ParseIP("10.0.0.1"))
+	c.Lookup(net.ParseIP("10.0.0.2"))
+	c.Lookup(net.ParseIP("10.0.0.1")) // 10.0.0.2 is now least recently used
+	c.Lookup(net.ParseIP("10.0.0.3"))
+
+	calls := inner.calls
+	c.Lookup(net.ParseIP("10.0.0.1"))
+	if inner.calls != calls {
+		t.Error("expected 10.0.0.1 to stay cached")
+	}
+	c.Lookup(net.ParseIP("10.0.0.2"))
+	if inner.calls != calls+1 {
+		t.Error("expected 10.0.0.2 to be evicted")
+	}
+	if size := c.Stats().Size; size != 2 {
+		t.Errorf("expected size 2, got %d", size)
+	}
+}
+
+func TestCachedLookup_TTL(t *testing.T) {
+	inner := &countingLookup{country: "US"}
+	c := NewCachedLookup(inner, 10, time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ip := net.ParseIP("10.0.0.1")
+
+	c.Lookup(ip)
+	now = now.Add(59 * time.Second)
+	c.Lookup(ip)
+	if inner.calls != 1 {
+		t.Errorf("expected a hit before the TTL, got %d lookups", inner.calls)
+	}
+	now = now.Add(time.Second)
+	c.Lookup(ip)
+	if inner.calls != 2 {
+		t.Errorf("expected a miss after the TTL, got %d lookups", inner.calls)
+	}
+}
+
+func TestCachedLookup_OverrideExpiry(t *testing.T) {
+	path := writeOverrides(t, `[{"network": "10.0.0.0/8", "country": "DE", "reason": "VPN", "expires_at": "2026-01-01T00:01:00Z"}]`)
+	overrides, err := NewOverrideLookup(&countingLookup{country: "US"}, path, WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create override lookup: %v", err)
+	}
+	defer overrides.Close()
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	overrides.now = func() time.Time { return now }
+	c := NewCachedLookup(overrides, 10, time.Hour)
+	c.now = overrides.now
+	ip := net.ParseIP("10.0.0.1")
+
+	if country, _ := c.LookupCountry(ip); country != "DE" {
+		t.Fatalf("expected DE from the override, got %s", country)
+	}
+	now = now.Add(time.Minute)
+	if country, _ := c.LookupCountry(ip); country != "US" {
+		t.Errorf("expected US once the override expired, got %s", country)
+	}
+}
+
+func TestCachedLookup_ErrorsAreNotCached(t *testing.T) {
+	inner := &countingLookup{err: errors.New("reader is closed")}
+	c := NewCachedLookup(inner, 10, 0)
+	ip := net.ParseIP("10.0.0.1")
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Lookup(ip); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if inner.calls != 2 {
+		t.Errorf("expected 2 underlying lookups, got %d", inner.calls)
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Errorf("expected an empty cache, got size %d", size)
+	}
+}
+
+func TestCachedLookup_PurgedOnReload(t *testing.T) {
+	path := writeCSV(t, dbipCSV)
+	reader, err := NewCsvReader(path, WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	c := NewCachedLookup(reader, 10, 0, reader)
+	defer c.Close()
+	ip := net.ParseIP("1.0.0.1")
+
+	if country, _ := c.LookupCountry(ip); country != "AU" {
+		t.Fatalf("expected AU, got %s", country)
+	}
+
+	replaceContent(t, path, strings.Replace(dbipCSV, "1.0.0.255,AU", "1.0.0.255,CN", 1))
+	if err := reader.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Errorf("expected the reload to purge the cache, got size %d", size)
+	}
+	if country, _ := c.LookupCountry(ip); country != "CN" {
+		t.Errorf("expected CN after reload, got %s", country)
+	}
+}
+
+func TestMmdbReader_OnReload(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	reloads := 0
+	reader.OnReload(func() { reloads++ })
+
+	if err := reader.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if reloads != 1 {
+		t.Errorf("expected 1 notification after reload, got %d", reloads)
+	}
+	if err := reader.Revert(1); err != nil {
+		t.Fatalf("revert failed: %v", err)
+	}
+	if reloads != 2 {
+		t.Errorf("expected 2 notifications after revert, got %d", reloads)
+	}
+}
+
+// BenchmarkCachedLookup compares cached and uncached lookups of a small set
+// of hot IPs against the test MMDB.
+func BenchmarkCachedLookup(b *testing.B) {
+	if _, err := os.Stat(testMMDBPath); os.IsNotExist(err) {
+		b.Skip("test MMDB file not found")
+	}
+	reader, err := NewMmdbReader(testMMDBPath, WithWatchMode(WatchNone))
+	if err != nil {
+		b.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	ips := []net.IP{
+		net.ParseIP("2.125.160.216"),
+		net.ParseIP("81.2.69.160"),
+		net.ParseIP("89.160.20.112"),
+		net.ParseIP("216.160.83.56"),
+		net.ParseIP("2001:218::1"),
+	}
+	lookups := map[string]CountryLookup{
+		"uncached": reader,
+		"cached":   NewCachedLookup(reader, 1024, time.Minute, reader),
+	}
+	for _, name := range []string{"uncached", "cached"} {
+		lookup := lookups[name]
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := lookup.Lookup(ips[i%len(ips)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
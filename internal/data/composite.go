@@ -0,0 +1,155 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CompositeDatabaseType is the database type CompositeLookup reports in its
+// Metadata; the metadata of each source is listed in Metadata.Sources.
+const CompositeDatabaseType = "composite"
+
+// Source is a named child of a CompositeLookup.
+type Source struct {
+	// Name identifies the source in LookupResult.Source, e.g. the file name.
+	Name   string
+	Lookup CountryLookup
+}
+
+// CompositeLookup implements CountryLookup by querying an ordered list of
+// sources and returning the first answer with a country, such as a manual
+// corrections file, then a commercial database, then GeoLite2 as a fallback.
+// Each source keeps its own hot-reload.
+type CompositeLookup struct {
+	sourceList
+}
+
+// NewCompositeLookup returns a CountryLookup that consults sources in order.
+// Closing it closes every source.
+func NewCompositeLookup(sources ...Source) *CompositeLookup {
+	return &CompositeLookup{sourceList: sources}
+}
+
+// LookupCountry returns the ISO-3166 country code for the given IP address.
+func (c *CompositeLookup) LookupCountry(ip net.IP) (string, error) {
+	result, err := c.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	return result.Country, nil
+}
+
+// Lookup returns the result of the first source that knows the country of
+// the IP address, with Source set to its name. A source that fails is
+// skipped; the lookup only fails if no source answered and one of them
+// failed. If no source knows the address, the result is empty.
+func (c *CompositeLookup) Lookup(ip net.IP) (*LookupResult, error) {
+	var errs []error
+	for _, s := range c.sourceList {
+		result, err := s.Lookup.Lookup(ip)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			continue
+		}
+		if result.Country != "" {
+			result.Source = s.Name
+			return result, nil
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &LookupResult{}, nil
+}
+
+// Metadata lists the metadata of every source that provides it in
+// Sources. Version joins the source versions with "+", LoadedAt is the
+// latest load of any source, and LastReloadError holds the first failed
+// reload.
+func (c *CompositeLookup) Metadata() (*Metadata, error) {
+	return c.metadata(CompositeDatabaseType, nil)
+}
+
+// sourceList is the ordered list of named sources of a CompositeLookup or a
+// ConsensusLookup. It implements the lifecycle methods shared by both.
+type sourceList []Source
+
+// Close releases every source.
+func (l sourceList) Close() error {
+	var errs []error
+	for _, s := range l {
+		errs = append(errs, s.Lookup.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// OnReload registers fn with every source that swaps its data at runtime.
+func (l sourceList) OnReload(fn func()) {
+	for _, s := range l {
+		if n, ok := s.Lookup.(ReloadNotifier); ok {
+			n.OnReload(fn)
+		}
+	}
+}
+
+// Reload reloads every source that supports it, as its watcher would.
+func (l sourceList) Reload() error {
+	var errs []error
+	for _, s := range l {
+		if r, ok := s.Lookup.(interface{ Reload() error }); ok {
+			if err := r.Reload(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ready reports an error if any source that supports readiness checks is
+// not ready.
+func (l sourceList) Ready() error {
+	var errs []error
+	for _, s := range l {
+		if r, ok := s.Lookup.(interface{ Ready() error }); ok {
+			if err := r.Ready(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// metadata returns Metadata of databaseType listing every source that
+// provides metadata; annotate, if not nil, may add to the metadata of
+// source i.
+func (l sourceList) metadata(databaseType string, annotate func(i int, meta *Metadata)) (*Metadata, error) {
+	meta := &Metadata{DatabaseType: databaseType}
+	var versions []string
+	for i, s := range l {
+		provider, ok := s.Lookup.(MetadataProvider)
+		if !ok {
+			continue
+		}
+		sourceMeta, err := provider.Metadata()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		sourceMeta.Source = s.Name
+		if annotate != nil {
+			annotate(i, sourceMeta)
+		}
+		meta.Sources = append(meta.Sources, *sourceMeta)
+
+		versions = append(versions, sourceMeta.Version)
+		if sourceMeta.LoadedAt.After(meta.LoadedAt) {
+			meta.LoadedAt = sourceMeta.LoadedAt
+		}
+		if meta.LastReloadError == "" && sourceMeta.LastReloadError != "" {
+			meta.LastReloadError = s.Name + ": " + sourceMeta.LastReloadError
+		}
+	}
+	meta.Version = strings.Join(versions, "+")
+	return meta, nil
+}
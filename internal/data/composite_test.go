@@ -0,0 +1,151 @@
+package data
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+type failingLookup struct {
+	err error
+}
+
+func (f *failingLookup) LookupCountry(_ net.IP) (string, error) {
+	return "", f.err
+}
+
+func (f *failingLookup) Lookup(_ net.IP) (*LookupResult, error) {
+	return nil, f.err
+}
+
+func (f *failingLookup) Close() error {
+	return nil
+}
+
+// newCompositeCSV returns a composite of a corrections file and a fallback
+// CSV range file. Closing the composite closes both.
+func newCompositeCSV(t *testing.T) (*CompositeLookup, *CsvReader, *CsvReader) {
+	t.Helper()
+	corrections, err := NewCsvReader(writeCSV(t, "1.0.0.0,1.0.0.127,NZ\n"), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create corrections reader: %v", err)
+	}
+	fallback, err := NewCsvReader(writeCSV(t, dbipCSV), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create fallback reader: %v", err)
+	}
+	c := NewCompositeLookup(
+		Source{Name: "corrections.csv", Lookup: corrections},
+		Source{Name: "ranges.csv", Lookup: fallback},
+	)
+	return c, corrections, fallback
+}
+
+func TestCompositeLookup_Precedence(t *testing.T) {
+	c, _, _ := newCompositeCSV(t)
+	defer c.Close()
+
+	tests := []struct {
+		ip      string
+		country string
+		source  string
+	}{
+		{ip: "1.0.0.1", country: "NZ", source: "corrections.csv"},
+		{ip: "1.0.0.200", country: "AU", source: "ranges.csv"},
+		{ip: "2.125.160.216", country: "GB", source: "ranges.csv"},
+		{ip: "10.0.0.7", country: "", source: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			result, err := c.Lookup(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Country != tt.country {
+				t.Errorf("expected country %q, got %q", tt.country, result.Country)
+			}
+			if result.Source != tt.source {
+				t.Errorf("expected source %q, got %q", tt.source, result.Source)
+			}
+
+			country, err := c.LookupCountry(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if country != tt.country {
+				t.Errorf("LookupCountry: expected %q, got %q", tt.country, country)
+			}
+		})
+	}
+}
+
+func TestCompositeLookup_FailingSource(t *testing.T) {
+	failing := &failingLookup{err: errors.New("corrupt database")}
+	fallback := &stubCountryLookup{result: &LookupResult{Country: "SE"}}
+
+	c := NewCompositeLookup(Source{Name: "broken", Lookup: failing}, Source{Name: "fallback", Lookup: fallback})
+	result, err := c.Lookup(net.ParseIP("89.160.20.112"))
+	if err != nil {
+		t.Fatalf("expected the fallback to answer, got %v", err)
+	}
+	if result.Country != "SE" || result.Source != "fallback" {
+		t.Errorf("expected SE from fallback, got %q from %q", result.Country, result.Source)
+	}
+
+	// Without an answer, the failure is reported with the source name.
+	c = NewCompositeLookup(Source{Name: "broken", Lookup: failing})
+	if _, err := c.Lookup(net.ParseIP("89.160.20.112")); err == nil || !strings.Contains(err.Error(), "broken: corrupt database") {
+		t.Errorf("expected the source error, got %v", err)
+	}
+}
+
+func TestCompositeLookup_Metadata(t *testing.T) {
+	c, _, _ := newCompositeCSV(t)
+	defer c.Close()
+
+	meta, err := c.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.DatabaseType != CompositeDatabaseType {
+		t.Errorf("expected database type %q, got %q", CompositeDatabaseType, meta.DatabaseType)
+	}
+	if len(meta.Sources) != 2 {
+		t.Fatalf("expected 2 sources, got %d", len(meta.Sources))
+	}
+	for i, name := range []string{"corrections.csv", "ranges.csv"} {
+		if meta.Sources[i].Source != name {
+			t.Errorf("source %d: expected %q, got %q", i, name, meta.Sources[i].Source)
+		}
+		if meta.Sources[i].DatabaseType != CSVDatabaseType {
+			t.Errorf("source %d: expected database type %q, got %q", i, CSVDatabaseType, meta.Sources[i].DatabaseType)
+		}
+	}
+	if want := meta.Sources[0].Version + "+" + meta.Sources[1].Version; meta.Version != want {
+		t.Errorf("expected version %q, got %q", want, meta.Version)
+	}
+	if meta.LoadedAt.IsZero() {
+		t.Error("expected LoadedAt to be set")
+	}
+}
+
+func TestCompositeLookup_ReadyAndClose(t *testing.T) {
+	c, corrections, fallback := newCompositeCSV(t)
+
+	if err := c.Ready(); err != nil {
+		t.Errorf("expected ready, got %v", err)
+	}
+	if err := c.Reload(); err != nil {
+		t.Errorf("unexpected reload error: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	for name, r := range map[string]*CsvReader{"corrections": corrections, "fallback": fallback} {
+		if _, err := r.Lookup(net.ParseIP("1.0.0.1")); err == nil {
+			t.Errorf("expected %s to be closed", name)
+		}
+	}
+}
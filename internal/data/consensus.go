@@ -0,0 +1,161 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// ConsensusDatabaseType is the database type ConsensusLookup reports in its
+// Metadata; the metadata of each source is listed in Metadata.Sources.
+const ConsensusDatabaseType = "consensus"
+
+// Consensus describes how the sources of a ConsensusLookup voted.
+type Consensus struct {
+	// Agreement is the share of the configured sources that reported the
+	// most common country, from 0 to 1. Sources without a country for the
+	// IP and sources that failed count as disagreeing, so a vote is only
+	// unanimous if every source answered. The country is only chosen if
+	// Agreement is above 0.5.
+	Agreement float64
+	// Votes maps each answering source to the country it reported.
+	Votes map[string]string
+	// Failed lists the sources whose lookup failed.
+	Failed []string
+}
+
+// Unanimous reports whether every configured source answered and reported
+// the chosen country.
+func (c *Consensus) Unanimous() bool {
+	return c.Agreement == 1
+}
+
+// ConsensusLookup implements CountryLookup by querying several sources in
+// parallel and returning the country a strict majority of them agree on,
+// e.g. to compare
+// MaxMind, DB-IP and IP2Location on live traffic. Every disagreement is
+// logged and counted per dissenting source.
+type ConsensusLookup struct {
+	sourceList
+	dissents []atomic.Uint64 // per source, lookups it disagreed with
+
+	lookups       atomic.Uint64
+	disagreements atomic.Uint64
+}
+
+// NewConsensusLookup returns a CountryLookup that takes the majority vote of
+// sources. Closing it closes every source.
+func NewConsensusLookup(sources ...Source) *ConsensusLookup {
+	return &ConsensusLookup{
+		sourceList: sources,
+		dissents:   make([]atomic.Uint64, len(sources)),
+	}
+}
+
+// LookupCountry returns the ISO-3166 country code for the given IP address.
+func (c *ConsensusLookup) LookupCountry(ip net.IP) (string, error) {
+	result, err := c.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	return result.Country, nil
+}
+
+// Lookup queries every source and returns the result of the first source
+// that reported the majority country, with Consensus describing the vote
+// and Source naming that source. The majority is one of more than half of
+// the configured sources; without one, such as in a 1/1/1 split, the
+// result has no country and the check denies it. A source that fails does
+// not vote but counts against the agreement, so the result is not
+// unanimous; the lookup only fails if every source failed.
+func (c *ConsensusLookup) Lookup(ip net.IP) (*LookupResult, error) {
+	results := make([]*LookupResult, len(c.sourceList))
+	errs := make([]error, len(c.sourceList))
+	var wg sync.WaitGroup
+	for i, s := range c.sourceList {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := s.Lookup.Lookup(ip)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", s.Name, err)
+				return
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	counts := make(map[string]int)
+	answered := 0
+	for _, result := range results {
+		if result != nil {
+			answered++
+			if result.Country != "" {
+				counts[result.Country]++
+			}
+		}
+	}
+	// The candidate is the first source reporting a country with the most
+	// votes; it only wins with a strict majority below.
+	winner := -1
+	for i, result := range results {
+		if result != nil && result.Country != "" && (winner < 0 || counts[result.Country] > counts[results[winner].Country]) {
+			winner = i
+		}
+	}
+	if answered == 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	c.lookups.Add(1)
+	// Sources that all lack the IP agree that its country is unknown.
+	consensus := &Consensus{Votes: make(map[string]string, answered)}
+	agreeing := answered
+	result := &LookupResult{}
+	if winner >= 0 {
+		agreeing = counts[results[winner].Country]
+		if 2*agreeing > len(c.sourceList) {
+			result = results[winner]
+			result.Source = c.sourceList[winner].Name
+		}
+	}
+	consensus.Agreement = float64(agreeing) / float64(len(c.sourceList))
+	for i, r := range results {
+		if r == nil {
+			consensus.Failed = append(consensus.Failed, c.sourceList[i].Name)
+			continue
+		}
+		consensus.Votes[c.sourceList[i].Name] = r.Country
+		if r.Country != result.Country {
+			c.dissents[i].Add(1)
+		}
+	}
+	result.Consensus = consensus
+
+	if !consensus.Unanimous() {
+		c.disagreements.Add(1)
+		slog.Info("geolocation sources disagree", "ip", ip.String(), "country", result.Country,
+			"agreement", consensus.Agreement, "votes", consensus.Votes, "failed", consensus.Failed)
+	}
+	return result, nil
+}
+
+// Metadata lists the metadata of every source in Sources, like
+// CompositeLookup, and adds the disagreement counters: Disagreements counts
+// the lookups that were not unanimous and each source's Disagreements the
+// lookups it dissented from.
+func (c *ConsensusLookup) Metadata() (*Metadata, error) {
+	meta, err := c.metadata(ConsensusDatabaseType, func(i int, sourceMeta *Metadata) {
+		sourceMeta.Disagreements = c.dissents[i].Load()
+	})
+	if err != nil {
+		return nil, err
+	}
+	meta.Lookups = c.lookups.Load()
+	meta.Disagreements = c.disagreements.Load()
+	return meta, nil
+}
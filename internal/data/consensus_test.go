@@ -0,0 +1,156 @@
+package data
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// vendor returns a source answering every IP with country.
+func vendor(name, country string) Source {
+	return Source{Name: name, Lookup: &stubCountryLookup{result: &LookupResult{Country: country, DatabaseVersion: name + "/1"}}}
+}
+
+func TestConsensusLookup_Lookup(t *testing.T) {
+	tests := []struct {
+		name      string
+		sources   []Source
+		country   string
+		source    string
+		agreement float64
+	}{
+		{
+			name:      "unanimous",
+			sources:   []Source{vendor("maxmind", "DE"), vendor("dbip", "DE"), vendor("ip2location", "DE")},
+			country:   "DE",
+			source:    "maxmind",
+			agreement: 1,
+		},
+		{
+			name:      "majority",
+			sources:   []Source{vendor("maxmind", "US"), vendor("dbip", "DE"), vendor("ip2location", "DE")},
+			country:   "DE",
+			source:    "dbip",
+			agreement: 2.0 / 3,
+		},
+		{
+			name:      "tie has no majority",
+			sources:   []Source{vendor("maxmind", "US"), vendor("dbip", "DE")},
+			country:   "",
+			agreement: 0.5,
+		},
+		{
+			name:      "plurality is not a majority",
+			sources:   []Source{vendor("maxmind", "US"), vendor("dbip", "DE"), vendor("ip2location", "FR")},
+			country:   "",
+			agreement: 1.0 / 3,
+		},
+		{
+			name:      "unknown counts against agreement",
+			sources:   []Source{vendor("maxmind", ""), vendor("dbip", "DE"), vendor("ip2location", "DE")},
+			country:   "DE",
+			source:    "dbip",
+			agreement: 2.0 / 3,
+		},
+		{
+			name:      "unknown everywhere",
+			sources:   []Source{vendor("maxmind", ""), vendor("dbip", "")},
+			country:   "",
+			agreement: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConsensusLookup(tt.sources...)
+			result, err := c.Lookup(net.ParseIP("81.2.69.1"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Country != tt.country || result.Source != tt.source {
+				t.Errorf("expected %q from %q, got %q from %q", tt.country, tt.source, result.Country, result.Source)
+			}
+			if result.Consensus == nil {
+				t.Fatal("expected the consensus to be reported")
+			}
+			if result.Consensus.Agreement != tt.agreement {
+				t.Errorf("expected agreement %v, got %v", tt.agreement, result.Consensus.Agreement)
+			}
+			if len(result.Consensus.Votes) != len(tt.sources) {
+				t.Errorf("expected %d votes, got %v", len(tt.sources), result.Consensus.Votes)
+			}
+			if tt.source != "" && result.DatabaseVersion != tt.source+"/1" {
+				t.Errorf("expected the attributes of %s, got version %q", tt.source, result.DatabaseVersion)
+			}
+		})
+	}
+}
+
+func TestConsensusLookup_FailingSource(t *testing.T) {
+	broken := Source{Name: "broken", Lookup: &failingLookup{err: errors.New("corrupt database")}}
+
+	c := NewConsensusLookup(broken, vendor("dbip", "DE"), vendor("ip2location", "DE"))
+	result, err := c.Lookup(net.ParseIP("81.2.69.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Country != "DE" || result.Consensus.Agreement != 2.0/3 || result.Consensus.Unanimous() {
+		t.Errorf("expected DE without unanimity, got %q %+v", result.Country, result.Consensus)
+	}
+	if _, voted := result.Consensus.Votes["broken"]; voted {
+		t.Error("expected the failed source not to vote")
+	}
+	if len(result.Consensus.Failed) != 1 || result.Consensus.Failed[0] != "broken" {
+		t.Errorf("expected the failed source to be listed, got %v", result.Consensus.Failed)
+	}
+
+	// A single answering source of three is no majority.
+	other := Source{Name: "other", Lookup: &failingLookup{err: errors.New("timeout")}}
+	c = NewConsensusLookup(broken, vendor("dbip", "DE"), other)
+	result, err = c.Lookup(net.ParseIP("81.2.69.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Country != "" || result.Consensus.Agreement != 1.0/3 || result.Consensus.Unanimous() {
+		t.Errorf("expected no country from one of three sources, got %q %+v", result.Country, result.Consensus)
+	}
+
+	c = NewConsensusLookup(broken)
+	if _, err := c.Lookup(net.ParseIP("81.2.69.1")); err == nil || !strings.Contains(err.Error(), "broken: corrupt database") {
+		t.Errorf("expected the source error, got %v", err)
+	}
+}
+
+func TestConsensusLookup_Metadata(t *testing.T) {
+	c, corrections, fallback := newCompositeCSV(t)
+	defer c.Close()
+	consensus := NewConsensusLookup(
+		Source{Name: "corrections.csv", Lookup: corrections},
+		Source{Name: "ranges.csv", Lookup: fallback},
+	)
+
+	// 1.0.0.1 is NZ in the corrections and AU in the ranges; 2.125.160.216
+	// is only in the ranges.
+	for _, ip := range []string{"1.0.0.1", "1.0.0.200", "2.125.160.216"} {
+		if _, err := consensus.Lookup(net.ParseIP(ip)); err != nil {
+			t.Fatalf("lookup %s failed: %v", ip, err)
+		}
+	}
+
+	meta, err := consensus.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.DatabaseType != ConsensusDatabaseType || len(meta.Sources) != 2 {
+		t.Fatalf("expected a consensus of 2 sources, got %+v", meta)
+	}
+	if meta.Lookups != 3 || meta.Disagreements != 3 {
+		t.Errorf("expected 3 lookups and 3 disagreements, got %d and %d", meta.Lookups, meta.Disagreements)
+	}
+	// Two sources never reach a majority when they disagree, so every
+	// source reporting a country dissents from the unknown result.
+	if meta.Sources[0].Disagreements != 1 || meta.Sources[1].Disagreements != 3 {
+		t.Errorf("expected 1 and 3 dissents, got %d and %d", meta.Sources[0].Disagreements, meta.Sources[1].Disagreements)
+	}
+}
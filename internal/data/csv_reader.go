@@ -0,0 +1,359 @@
+package data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CSVDatabaseType is the database type CsvReader reports in its Metadata.
+const CSVDatabaseType = "CSV"
+
+// errCsvReaderClosed is returned by lookups on a closed CsvReader.
+var errCsvReaderClosed = errors.New("csv reader is closed")
+
+// CsvReader implements CountryLookup using a CSV range file, as published
+// by DB-IP and IP2Location: one start_ip,end_ip,country row per range.
+// Addresses may be written in dotted/colon notation or as decimal integers
+// (IP2Location); IPv4 and IPv6 ranges can be mixed. Columns after the
+// country are ignored, as is a header row. Ranges without a country ("-"
+// or empty) are skipped.
+//
+// The ranges are loaded into an in-memory table sorted by address, which
+// lookups binary-search. Like MmdbReader, the reader hot-reloads the file
+// when it changes and swaps the new table in atomically.
+type CsvReader struct {
+	table atomic.Pointer[csvTable] // current table; nil once closed
+	path  string
+	watch *fileWatch // reloads the table when the file changes
+
+	options
+	listeners reloadListeners
+
+	mu         sync.Mutex // serializes reloads and guards the fields below
+	reloadErr  error      // error of the last reload attempt; nil after a success
+	generation uint64     // ID of the most recently loaded table
+}
+
+// csvTable is one loaded generation of a CSV range file. Tables are
+// immutable once published and garbage collected when replaced.
+type csvTable struct {
+	id       uint64
+	ranges   rangeTable
+	ipv6     bool // whether any range lies outside the IPv4-mapped space
+	state    fileState
+	loadedAt time.Time
+	version  string
+}
+
+// NewCsvReader loads the CSV range file at path, starts watching it as
+// configured by opts (see WithWatchMode, WithPollInterval and WithProbes)
+// and returns a reader. Call Close to stop the watcher.
+func NewCsvReader(path string, opts ...Option) (*CsvReader, error) {
+	r := &CsvReader{
+		path:    path,
+		options: defaultOptions(),
+	}
+	for _, opt := range opts {
+		opt(&r.options)
+	}
+
+	table, err := r.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CSV file: %w", err)
+	}
+	r.table.Store(table)
+
+	r.watch = newFileWatch("csv file", path, r)
+	r.watch.start(r.watchMode, r.pollInterval)
+
+	return r, nil
+}
+
+// LookupCountry returns the ISO-3166 country code for the given IP address.
+func (r *CsvReader) LookupCountry(ip net.IP) (string, error) {
+	result, err := r.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	return result.Country, nil
+}
+
+// Lookup returns the country of the range containing the IP address, with
+// the matching prefix as Network. Only Country, Network and DatabaseVersion
+// are set; an address outside every range yields an empty Country.
+func (r *CsvReader) Lookup(ip net.IP) (*LookupResult, error) {
+	table := r.table.Load()
+	if table == nil {
+		return nil, fmt.Errorf("country lookup failed: %w", errCsvReaderClosed)
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return nil, fmt.Errorf("country lookup failed: invalid IP address %v", ip)
+	}
+
+	country, length := table.ranges.lookup(uint128From16([16]byte(ip16)))
+	result := &LookupResult{
+		Country:         country,
+		DatabaseVersion: table.version,
+	}
+	if country != "" {
+		result.Network = prefixNetwork(ip, length)
+	}
+	return result, nil
+}
+
+// Close stops the watcher. Lookups fail afterwards.
+func (r *CsvReader) Close() error {
+	r.watch.stop()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.table.Store(nil)
+	return nil
+}
+
+// OnReload registers fn to be called after every reload that swaps the
+// table.
+func (r *CsvReader) OnReload(fn func()) {
+	r.listeners.add(fn)
+}
+
+// Reload reloads the CSV file now, as the watcher and poller do.
+func (r *CsvReader) Reload() error {
+	return r.reload()
+}
+
+// Ready runs the configured probes against the current table.
+func (r *CsvReader) Ready() error {
+	table := r.table.Load()
+	if table == nil {
+		return errCsvReaderClosed
+	}
+	return checkTableProbes(table, r.probes)
+}
+
+// Metadata describes the loaded table. CSV files carry no build time, so
+// BuildEpoch is the modification time of the file.
+func (r *CsvReader) Metadata() (*Metadata, error) {
+	table := r.table.Load()
+	if table == nil {
+		return nil, errCsvReaderClosed
+	}
+
+	meta := &Metadata{
+		Generation:   table.id,
+		Path:         r.path,
+		DatabaseType: CSVDatabaseType,
+		BuildEpoch:   uint(table.state.modTime.Unix()),
+		IPVersion:    4,
+		NodeCount:    uint(len(table.ranges.ranges)),
+		FileHash:     hex.EncodeToString(table.state.hash[:]),
+		LoadedAt:     table.loadedAt,
+		Version:      table.version,
+	}
+	if table.ipv6 {
+		meta.IPVersion = 6
+	}
+
+	r.mu.Lock()
+	if r.reloadErr != nil {
+		meta.LastReloadError = r.reloadErr.Error()
+	}
+	r.mu.Unlock()
+	return meta, nil
+}
+
+// reload parses the file again and swaps the new table in if it parses and
+// passes the probes. Concurrent reloads are serialized.
+func (r *CsvReader) reload() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.table.Load() == nil {
+		return errCsvReaderClosed
+	}
+	defer func() { r.reloadErr = err }()
+
+	table, err := r.load()
+	if err != nil {
+		return fmt.Errorf("candidate CSV rejected: %w", err)
+	}
+	r.table.Store(table)
+	r.listeners.notify()
+
+	slog.Info("csv database reloaded", "path", r.path, "generation", table.id, "version", table.version)
+	return nil
+}
+
+// loadedState returns the on-disk state of the loaded file, or the zero
+// state once the reader is closed.
+func (r *CsvReader) loadedState() fileState {
+	if table := r.table.Load(); table != nil {
+		return table.state
+	}
+	return fileState{}
+}
+
+// load reads and parses the file and checks the probes against the result.
+func (r *CsvReader) load() (*csvTable, error) {
+	buf, state, err := readFile(r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &csvTable{state: state, loadedAt: time.Now()}
+	if err := parseCSVRanges(bytes.NewReader(buf), table); err != nil {
+		return nil, err
+	}
+	if err := checkTableProbes(table, r.probes); err != nil {
+		return nil, err
+	}
+
+	r.generation++
+	table.id = r.generation
+	table.version = fmt.Sprintf("%s/%d/%s", CSVDatabaseType, state.modTime.Unix(), hex.EncodeToString(state.hash[:6]))
+	return table, nil
+}
+
+// checkTableProbes verifies that every probe IP resolves to its expected
+// country.
+func checkTableProbes(table *csvTable, probes []Probe) error {
+	for _, p := range probes {
+		country, _ := table.ranges.lookup(uint128From16([16]byte(p.IP.To16())))
+		if country != p.Country {
+			return fmt.Errorf("probe %s: expected country %s, got %q", p.IP, p.Country, country)
+		}
+	}
+	return nil
+}
+
+// parseCSVRanges inserts the ranges read from in into table.
+func parseCSVRanges(in io.Reader, table *csvTable) error {
+	cr := csv.NewReader(in)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	cr.Comment = '#'
+
+	var ranges []addrRange
+	// Country codes are interned, so that they do not keep the lines they
+	// were read from alive.
+	countries := make(map[string]string)
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) < 3 {
+			return fmt.Errorf("line %d: expected start_ip,end_ip,country", line)
+		}
+
+		// Rows without a country are gaps; their addresses are not checked.
+		country := strings.ToUpper(strings.TrimSpace(record[2]))
+		if country == "" || country == "-" {
+			continue
+		}
+
+		start, end, err := parseCSVRange(record[0], record[1])
+		if err != nil {
+			if line == 1 {
+				continue // header row
+			}
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		lo, hi := uint128From16(start.As16()), uint128From16(end.As16())
+		if hi.less(lo) {
+			return fmt.Errorf("line %d: start %s is after end %s", line, start, end)
+		}
+		if !start.Is4() && !start.Is4In6() {
+			table.ipv6 = true
+		}
+		if c, ok := countries[country]; ok {
+			country = c
+		} else {
+			country = strings.Clone(country)
+			countries[country] = country
+		}
+		ranges = append(ranges, addrRange{lo: lo, hi: hi, country: country})
+	}
+
+	if len(ranges) == 0 {
+		return errors.New("no ranges found")
+	}
+	table.ranges = newRangeTable(ranges)
+	return nil
+}
+
+// maxIPv4 is the largest decimal address read as IPv4.
+var maxIPv4 = big.NewInt(1<<32 - 1)
+
+// parseCSVRange parses the start and end address of a row. Decimal
+// addresses are read as IPv4 if the end of the range fits in 32 bits, and
+// as IPv6 otherwise, so that IP2Location IPv6 rows starting at "0" are
+// IPv6 ranges too.
+func parseCSVRange(startStr, endStr string) (start, end netip.Addr, err error) {
+	startN, startDecimal, err := parseCSVAddr(startStr)
+	if err != nil {
+		return start, end, err
+	}
+	endN, endDecimal, err := parseCSVAddr(endStr)
+	if err != nil {
+		return start, end, err
+	}
+	if startDecimal != endDecimal {
+		return start, end, errors.New("range mixes decimal and dotted/colon addresses")
+	}
+	if startDecimal {
+		ipv4 := endN.Cmp(maxIPv4) <= 0
+		return decimalAddr(startN, ipv4), decimalAddr(endN, ipv4), nil
+	}
+
+	start, _ = netip.ParseAddr(strings.TrimSpace(startStr))
+	end, _ = netip.ParseAddr(strings.TrimSpace(endStr))
+	if end.Is4() != start.Is4() {
+		return start, end, errors.New("range mixes IPv4 and IPv6 addresses")
+	}
+	return start, end, nil
+}
+
+// parseCSVAddr validates an address in dotted/colon notation or as a
+// decimal integer, and returns the integer for the latter.
+func parseCSVAddr(s string) (n *big.Int, decimal bool, err error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, ".:") {
+		if _, err := netip.ParseAddr(s); err != nil {
+			return nil, false, fmt.Errorf("invalid IP address %q", s)
+		}
+		return nil, false, nil
+	}
+
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return nil, false, fmt.Errorf("invalid IP address %q", s)
+	}
+	return n, true, nil
+}
+
+// decimalAddr converts a decimal address to an IPv4 or IPv6 address.
+func decimalAddr(n *big.Int, ipv4 bool) netip.Addr {
+	var b [16]byte
+	n.FillBytes(b[:])
+	if ipv4 {
+		return netip.AddrFrom4([4]byte(b[12:]))
+	}
+	return netip.AddrFrom16(b)
+}
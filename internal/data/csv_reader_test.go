@@ -0,0 +1,228 @@
+package data
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCSV writes content to a fresh temp file and returns its path.
+func writeCSV(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ranges.csv")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write CSV: %v", err)
+	}
+	return path
+}
+
+const dbipCSV = `1.0.0.0,1.0.0.255,AU
+2.125.160.216,2.125.160.223,GB
+10.0.0.1,10.0.0.6,ZZ
+81.2.69.0,81.2.69.255,-
+216.160.83.56,216.160.83.63,us
+2001:218::,2001:218:ffff:ffff:ffff:ffff:ffff:ffff,JP
+2001:218:1::,2001:218:1::ff,KR
+`
+
+func TestCsvReader_Lookup(t *testing.T) {
+	reader, err := NewCsvReader(writeCSV(t, dbipCSV), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	tests := []struct {
+		ip      string
+		country string
+		network string
+	}{
+		{ip: "1.0.0.1", country: "AU", network: "1.0.0.0/24"},
+		{ip: "2.125.160.216", country: "GB", network: "2.125.160.216/29"},
+		{ip: "216.160.83.60", country: "US", network: "216.160.83.56/29"},
+		{ip: "10.0.0.1", country: "ZZ", network: "10.0.0.1/32"},
+		{ip: "10.0.0.6", country: "ZZ", network: "10.0.0.6/32"},
+		{ip: "10.0.0.7", country: ""},
+		{ip: "10.0.0.0", country: ""},
+		{ip: "81.2.69.160", country: ""},
+		{ip: "2001:218:abcd::1", country: "JP", network: "2001:218:8000::/33"},
+		{ip: "2001:218:1::10", country: "KR", network: "2001:218:1::/120"},
+		{ip: "2001:219::1", country: ""},
+		{ip: "::ffff:1.0.0.1", country: "AU", network: "1.0.0.0/24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			result, err := reader.Lookup(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Country != tt.country {
+				t.Errorf("expected country %q, got %q", tt.country, result.Country)
+			}
+			var network string
+			if result.Network != nil {
+				network = result.Network.String()
+			}
+			if network != tt.network {
+				t.Errorf("expected network %q, got %q", tt.network, network)
+			}
+		})
+	}
+}
+
+func TestCsvReader_IP2LocationFormat(t *testing.T) {
+	// IP2Location LITE DB1 IPv6 layout: quoted decimal addresses, IPv4
+	// ranges in their IPv4-mapped form, a country name column, and gaps
+	// that start at "0" and end beyond 2^32.
+	content := `"ip_from","ip_to","country_code","country_name"
+"0","281470681743359","-","-"
+"281470681743360","281470698520575","-","-"
+"281470698520576","281470698520831","US","United States of America"
+"281470698520832","281470698521087","AU","Australia"
+"42540528726795050063891204319802818560","42540528806023212578155541913346768895","JP","Japan"
+"42540528806023212578155541913346768896","340282366920938463463374607431768211455","-","-"
+`
+	reader, err := NewCsvReader(writeCSV(t, content), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	for ip, want := range map[string]string{
+		"1.0.0.1":     "US",
+		"1.0.1.1":     "AU",
+		"0.0.0.1":     "",
+		"2001:200::1": "JP",
+	} {
+		country, err := reader.LookupCountry(net.ParseIP(ip))
+		if err != nil {
+			t.Fatalf("lookup %s failed: %v", ip, err)
+		}
+		if country != want {
+			t.Errorf("%s: expected %q, got %q", ip, want, country)
+		}
+	}
+
+	meta, err := reader.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.DatabaseType != CSVDatabaseType || meta.IPVersion != 6 || meta.NodeCount == 0 {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+}
+
+func TestCsvReader_IP2LocationIPv4Format(t *testing.T) {
+	// IP2Location LITE DB1 IPv4 layout: decimal addresses up to 2^32-1.
+	content := `"0","16777215","-","-"
+"16777216","16777471","US","United States of America"
+"16777472","16778239","CN","China"
+`
+	reader, err := NewCsvReader(writeCSV(t, content), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	for ip, want := range map[string]string{"1.0.0.1": "US", "1.0.2.1": "CN", "0.0.0.1": ""} {
+		if country, _ := reader.LookupCountry(net.ParseIP(ip)); country != want {
+			t.Errorf("%s: expected %q, got %q", ip, want, country)
+		}
+	}
+	if meta, _ := reader.Metadata(); meta.IPVersion != 4 {
+		t.Errorf("expected an IPv4 table, got IP version %d", meta.IPVersion)
+	}
+}
+
+func TestNewCsvReader_InvalidFile(t *testing.T) {
+	tests := map[string]string{
+		"start after end": "1.0.0.255,1.0.0.0,AU\n",
+		"mixed families":  "1.0.0.0,2001:218::,AU\n",
+		"mixed notations": "1.0.0.0,16777471,AU\n",
+		"bad address":     "1.0.0.0,1.0.0.255,AU\n1.0.0.x,1.0.1.0,AU\n",
+		"missing columns": "1.0.0.0,1.0.0.255\n",
+		"no ranges":       "start_ip,end_ip,country\n",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewCsvReader(writeCSV(t, content), WithWatchMode(WatchNone)); err == nil {
+				t.Errorf("expected error for %s", name)
+			}
+		})
+	}
+
+	if _, err := NewCsvReader(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestCsvReader_Probes(t *testing.T) {
+	path := writeCSV(t, dbipCSV)
+
+	if _, err := NewCsvReader(path, WithWatchMode(WatchNone), WithProbes(Probe{IP: net.ParseIP("1.0.0.1"), Country: "US"})); err == nil {
+		t.Fatal("expected failing probe to reject the file")
+	}
+
+	reader, err := NewCsvReader(path, WithWatchMode(WatchNone), WithProbes(Probe{IP: net.ParseIP("1.0.0.1"), Country: "AU"}))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	if err := reader.Ready(); err != nil {
+		t.Errorf("expected reader to be ready, got %v", err)
+	}
+	reader.Close()
+	if err := reader.Ready(); err == nil {
+		t.Error("expected closed reader not to be ready")
+	}
+}
+
+func TestCsvReader_HotReload(t *testing.T) {
+	path := writeCSV(t, dbipCSV)
+	reader, err := NewCsvReader(path, WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	before, _ := reader.Metadata()
+	ip := net.ParseIP("1.0.0.1")
+
+	// An invalid file is rejected and the old table keeps serving.
+	replaceContent(t, path, "garbage\n")
+	reader.watch.poll(reader.loadedState())
+	meta, _ := reader.Metadata()
+	if meta.LastReloadError == "" || meta.Generation != before.Generation {
+		t.Errorf("expected rejected reload to keep generation %d, got %+v", before.Generation, meta)
+	}
+
+	replaceContent(t, path, strings.Replace(dbipCSV, "1.0.0.255,AU", "1.0.0.255,CN", 1))
+	reader.watch.poll(reader.loadedState())
+	country, err := reader.LookupCountry(ip)
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if country != "CN" {
+		t.Errorf("expected CN after reload, got %s", country)
+	}
+	meta, _ = reader.Metadata()
+	if meta.LastReloadError != "" || meta.Generation != before.Generation+1 {
+		t.Errorf("expected generation %d without error, got %+v", before.Generation+1, meta)
+	}
+}
+
+// replaceContent atomically replaces the file at path with content.
+func replaceContent(t *testing.T, path, content string) {
+	t.Helper()
+	staging := path + ".tmp"
+	if err := os.WriteFile(staging, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write staging file: %v", err)
+	}
+	if err := os.Rename(staging, path); err != nil {
+		t.Fatalf("failed to rename staging file: %v", err)
+	}
+}
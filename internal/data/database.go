@@ -0,0 +1,69 @@
+package data
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// errReaderClosed is returned by lookups on a closed MmdbReader.
+var errReaderClosed = errors.New("mmdb reader is closed")
+
+// database is one loaded generation of an MMDB file. It is reference
+// counted: the MmdbReader holds one reference while the generation is
+// current, and every in-flight lookup holds another. The underlying reader
+// (and its memory map) is closed only when the last reference is released,
+// so a hot-reload never unmaps memory a concurrent lookup is still reading.
+type database struct {
+	id       uint64 // generation number, increasing with every load
+	reader   *maxminddb.Reader
+	state    fileState // on-disk state of the file the generation was loaded from
+	loadedAt time.Time
+	version  string
+	refs     atomic.Int64
+}
+
+// newDatabase wraps reader with a single reference owned by the caller.
+func newDatabase(id uint64, reader *maxminddb.Reader, state fileState) *database {
+	d := &database{
+		id:       id,
+		reader:   reader,
+		state:    state,
+		loadedAt: time.Now(),
+		version:  databaseVersion(reader.Metadata, state),
+	}
+	d.refs.Store(1)
+	return d
+}
+
+// databaseVersion identifies a generation by its database type, build epoch
+// and a prefix of its file hash, e.g. "GeoLite2-Country/1704728164/3f2a9c1b0d4e".
+// The hash prefix tells apart files that share a build epoch.
+func databaseVersion(meta maxminddb.Metadata, state fileState) string {
+	return fmt.Sprintf("%s/%d/%s", meta.DatabaseType, meta.BuildEpoch, hex.EncodeToString(state.hash[:6]))
+}
+
+// tryAcquire takes a reference unless the database has already been closed.
+func (d *database) tryAcquire() bool {
+	for {
+		n := d.refs.Load()
+		if n == 0 {
+			return false
+		}
+		if d.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// release drops a reference and closes the reader when it was the last one.
+func (d *database) release() error {
+	if d.refs.Add(-1) == 0 {
+		return d.reader.Close()
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package data
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMmdbReader_RetiredDatabaseStaysOpenWhileInUse(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithWatchMode(WatchPoll), WithPollInterval(time.Hour), WithRetainGenerations(0))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	// Simulate a lookup that loaded the database just before a reload.
+	db, err := reader.acquire()
+	if err != nil {
+		t.Fatalf("failed to acquire database: %v", err)
+	}
+
+	if err := reader.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if reader.db.Load() == db {
+		t.Fatal("expected reload to publish a new database")
+	}
+
+	var record struct{}
+	if err := db.reader.Lookup(net.ParseIP("2.125.160.216"), &record); err != nil {
+		t.Fatalf("retired database closed while still in use: %v", err)
+	}
+
+	reader.releaseDB(db)
+	if err := db.reader.Lookup(net.ParseIP("2.125.160.216"), &record); err == nil {
+		t.Fatal("expected retired database to be closed after the last release")
+	}
+}
+
+func TestMmdbReader_LookupAfterClose(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	reader, err := NewMmdbReader(testMMDBPath)
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("failed to close reader: %v", err)
+	}
+
+	_, err = reader.Lookup(net.ParseIP("2.125.160.216"))
+	if !errors.Is(err, errReaderClosed) {
+		t.Fatalf("expected errReaderClosed, got %v", err)
+	}
+	if err := reader.reload(); !errors.Is(err, errReaderClosed) {
+		t.Fatalf("expected reload after close to fail with errReaderClosed, got %v", err)
+	}
+}
+
+// TestMmdbReader_ConcurrentLookupsDuringReload hammers lookups while the
+// database is reloaded repeatedly. Run with -race; a premature Close of a
+// retired database shows up as lookup errors, wrong countries or a crash.
+func TestMmdbReader_ConcurrentLookupsDuringReload(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	const (
+		workers = 8
+		reloads = 50
+	)
+	ip := net.ParseIP("2.125.160.216")
+
+	var (
+		wg      sync.WaitGroup
+		stop    atomic.Bool
+		lookups atomic.Int64
+		errs    = make(chan error, workers)
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				result, err := reader.Lookup(ip)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if result.Country != "GB" {
+					errs <- errors.New("unexpected country " + result.Country)
+					return
+				}
+				lookups.Add(1)
+			}
+		}()
+	}
+
+	for range reloads {
+		if err := reader.reload(); err != nil {
+			t.Errorf("reload failed: %v", err)
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stop.Store(true)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("lookup failed during reload: %v", err)
+	}
+	if lookups.Load() == 0 {
+		t.Error("expected lookups to run during reloads")
+	}
+}
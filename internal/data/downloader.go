@@ -0,0 +1,362 @@
+package data
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultDownloadInterval is how often a Downloader checks for a new edition
+// when no interval is configured.
+const DefaultDownloadInterval = 24 * time.Hour
+
+// DefaultMaxDownloadSize caps the downloaded archive and the extracted
+// database when no limit is configured. GeoIP2 Enterprise, the largest
+// edition, is well below it.
+const DefaultMaxDownloadSize = 2 << 30
+
+// Downloader keeps an MMDB file up to date from a MaxMind-compatible download
+// endpoint: a tar.gz archive containing the .mmdb file, with its SHA-256
+// published next to it (MaxMind serves it with the suffix "tar.gz.sha256").
+// Requests are conditional (ETag / If-Modified-Since), so an unchanged
+// edition costs one 304 response.
+type Downloader struct {
+	url        string
+	sha256URL  string
+	dest       string
+	accountID  string
+	licenseKey string
+	interval   time.Duration
+	maxSize    int64
+	client     *http.Client
+	validate   func(path string) error
+
+	etag         string
+	lastModified string
+}
+
+// DownloaderOption configures a Downloader.
+type DownloaderOption func(*Downloader)
+
+// WithSHA256URL sets the URL of the published checksum. By default it is
+// derived from the download URL: a "suffix" query parameter gets ".sha256"
+// appended (MaxMind's scheme), otherwise the path does.
+func WithSHA256URL(u string) DownloaderOption {
+	return func(d *Downloader) {
+		d.sha256URL = u
+	}
+}
+
+// WithCredentials sets the MaxMind account ID and license key sent with
+// HTTP basic authentication.
+func WithCredentials(accountID, licenseKey string) DownloaderOption {
+	return func(d *Downloader) {
+		d.accountID = accountID
+		d.licenseKey = licenseKey
+	}
+}
+
+// WithDownloadInterval sets how often Run checks for a new edition.
+// Non-positive values are ignored.
+func WithDownloadInterval(interval time.Duration) DownloaderOption {
+	return func(d *Downloader) {
+		if interval > 0 {
+			d.interval = interval
+		}
+	}
+}
+
+// WithMaxDownloadSize sets the size limit in bytes of both the archive and
+// the extracted database; an edition over it is rejected. Non-positive
+// values are ignored.
+func WithMaxDownloadSize(size int64) DownloaderOption {
+	return func(d *Downloader) {
+		if size > 0 {
+			d.maxSize = size
+		}
+	}
+}
+
+// WithValidator sets a check run on the extracted database before it
+// replaces dest, typically ValidateMmdbFile with the options of the reader
+// that serves dest. A rejected edition is neither installed nor remembered,
+// so the next check downloads it again.
+func WithValidator(validate func(path string) error) DownloaderOption {
+	return func(d *Downloader) {
+		d.validate = validate
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for downloads.
+func WithHTTPClient(client *http.Client) DownloaderOption {
+	return func(d *Downloader) {
+		d.client = client
+	}
+}
+
+// NewDownloader returns a Downloader that fetches the archive at url and
+// installs the extracted database at dest.
+func NewDownloader(url, dest string, opts ...DownloaderOption) (*Downloader, error) {
+	d := &Downloader{
+		url:      url,
+		dest:     dest,
+		interval: DefaultDownloadInterval,
+		maxSize:  DefaultMaxDownloadSize,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	if d.sha256URL == "" {
+		sha256URL, err := defaultSHA256URL(url)
+		if err != nil {
+			return nil, err
+		}
+		d.sha256URL = sha256URL
+	}
+	return d, nil
+}
+
+// defaultSHA256URL derives the checksum URL from the download URL.
+func defaultSHA256URL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid download URL: %w", err)
+	}
+	q := u.Query()
+	if suffix := q.Get("suffix"); suffix != "" {
+		q.Set("suffix", suffix+".sha256")
+		u.RawQuery = q.Encode()
+	} else {
+		u.Path += ".sha256"
+	}
+	return u.String(), nil
+}
+
+// Run checks for a new edition every interval until ctx is cancelled and
+// passes each installed file to reload, typically MmdbReader.Reload.
+func (d *Downloader) Run(ctx context.Context, reload func() error) {
+	slog.Info("mmdb downloader started", "url", redactURL(d.url), "dest", d.dest, "interval", d.interval.String())
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			updated, err := d.Update(ctx)
+			if err != nil {
+				slog.Error("mmdb download failed", "url", redactURL(d.url), "error", err)
+				continue
+			}
+			if !updated {
+				continue
+			}
+			if err := reload(); err != nil {
+				slog.Error("mmdb hot-reload failed", "error", err)
+			}
+		}
+	}
+}
+
+// Update downloads the edition if it changed since the last successful
+// download, verifies its SHA-256, validates the extracted database and
+// atomically replaces dest with it. The ETag and Last-Modified of the
+// edition are only recorded once it is installed. It reports whether a new
+// file was installed.
+func (d *Downloader) Update(ctx context.Context) (bool, error) {
+	req, err := d.newRequest(ctx, d.url)
+	if err != nil {
+		return false, err
+	}
+	if d.etag != "" {
+		req.Header.Set("If-None-Match", d.etag)
+	}
+	if d.lastModified != "" {
+		req.Header.Set("If-Modified-Since", d.lastModified)
+	} else if info, err := os.Stat(d.dest); err == nil && d.etag == "" {
+		// After a restart, the installed file is as recent as its mtime.
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		slog.Debug("mmdb edition not modified", "url", redactURL(d.url))
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("download failed: unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > d.maxSize {
+		return false, fmt.Errorf("download failed: archive of %d bytes exceeds the limit of %d bytes", resp.ContentLength, d.maxSize)
+	}
+
+	want, err := d.fetchSHA256(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// Spool the archive next to dest so the rename below stays on one
+	// filesystem, hashing it on the way.
+	archive, err := os.CreateTemp(filepath.Dir(d.dest), ".download-*.tar.gz")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(archive, h), io.LimitReader(resp.Body, d.maxSize+1))
+	if err != nil {
+		return false, fmt.Errorf("download failed: %w", err)
+	}
+	if n > d.maxSize {
+		return false, fmt.Errorf("download failed: archive exceeds the limit of %d bytes", d.maxSize)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return false, fmt.Errorf("checksum mismatch: published %s, downloaded %s", want, got)
+	}
+
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf("failed to rewind archive: %w", err)
+	}
+	if err := d.install(archive); err != nil {
+		return false, err
+	}
+
+	d.etag = resp.Header.Get("ETag")
+	d.lastModified = resp.Header.Get("Last-Modified")
+	slog.Info("mmdb edition downloaded", "url", redactURL(d.url), "dest", d.dest, "sha256", want)
+	return true, nil
+}
+
+// newRequest creates an authenticated GET request.
+func (d *Downloader) newRequest(ctx context.Context, u string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download URL: %w", err)
+	}
+	if d.accountID != "" || d.licenseKey != "" {
+		req.SetBasicAuth(d.accountID, d.licenseKey)
+	}
+	return req, nil
+}
+
+// fetchSHA256 returns the published checksum. The file holds the hex digest
+// optionally followed by the archive name, as written by sha256sum.
+func (d *Downloader) fetchSHA256(ctx context.Context) (string, error) {
+	req, err := d.newRequest(ctx, d.sha256URL)
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("checksum download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("checksum download failed: unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", fmt.Errorf("checksum download failed: %w", err)
+	}
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 || len(fields[0]) != 2*sha256.Size {
+		return "", errors.New("checksum download failed: malformed checksum file")
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// install extracts the first .mmdb file of the tar.gz archive and renames
+// it over dest, so readers never observe a partially written file.
+func (d *Downloader) install(archive io.Reader) error {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return errors.New("invalid archive: no .mmdb file found")
+		}
+		if err != nil {
+			return fmt.Errorf("invalid archive: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeReg && strings.HasSuffix(hdr.Name, ".mmdb") {
+			if hdr.Size > d.maxSize {
+				return fmt.Errorf("invalid archive: database of %d bytes exceeds the limit of %d bytes", hdr.Size, d.maxSize)
+			}
+			return d.writeFile(tr)
+		}
+	}
+}
+
+// writeFile writes r to a temp file next to dest, validates it and renames
+// it into place. At most maxSize bytes are written.
+func (d *Downloader) writeFile(r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(d.dest), ".download-*.mmdb")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	n, err := io.Copy(tmp, io.LimitReader(r, d.maxSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to extract database: %w", err)
+	}
+	if n > d.maxSize {
+		return fmt.Errorf("failed to extract database: exceeds the limit of %d bytes", d.maxSize)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to extract database: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to extract database: %w", err)
+	}
+	if d.validate != nil {
+		if err := d.validate(tmp.Name()); err != nil {
+			return fmt.Errorf("downloaded database rejected: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), d.dest); err != nil {
+		return fmt.Errorf("failed to install database: %w", err)
+	}
+	return nil
+}
+
+// redactURL drops credentials and query parameters (MaxMind's legacy
+// endpoint carries the license key there) from u for logging.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
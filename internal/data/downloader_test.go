@@ -0,0 +1,310 @@
+package data
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newArchive returns a tar.gz archive laid out like MaxMind's downloads,
+// containing the MMDB at src.
+func newArchive(t *testing.T, src string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("failed to read source MMDB: %v", err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "GeoLite2-Country_20260101/LICENSE.txt", content: []byte("license")},
+		{name: "GeoLite2-Country_20260101/" + filepath.Base(src), content: content},
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			t.Fatalf("failed to write tar entry: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to close gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// editionServer is a stand-in for MaxMind's download endpoint.
+type editionServer struct {
+	archive   []byte
+	checksum  string
+	downloads atomic.Int32
+}
+
+func newEditionServer(t *testing.T, archive []byte) (*editionServer, *httptest.Server) {
+	t.Helper()
+	sum := sha256.Sum256(archive)
+	es := &editionServer{archive: archive, checksum: hex.EncodeToString(sum[:])}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "42" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("suffix") {
+		case "tar.gz":
+			etag := `"` + es.checksum[:16] + `"`
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			es.downloads.Add(1)
+			w.Header().Set("ETag", etag)
+			w.Write(es.archive)
+		case "tar.gz.sha256":
+			w.Write([]byte(es.checksum + "  GeoLite2-Country_20260101.tar.gz\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return es, srv
+}
+
+func newTestDownloader(t *testing.T, srv *httptest.Server, dest string) *Downloader {
+	t.Helper()
+	d, err := NewDownloader(srv.URL+"/geoip/databases/GeoLite2-Country/download?suffix=tar.gz", dest,
+		WithCredentials("42", "secret"),
+		WithHTTPClient(srv.Client()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create downloader: %v", err)
+	}
+	return d
+}
+
+func TestDefaultSHA256URL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   "https://download.maxmind.com/geoip/databases/GeoLite2-Country/download?suffix=tar.gz",
+			want: "https://download.maxmind.com/geoip/databases/GeoLite2-Country/download?suffix=tar.gz.sha256",
+		},
+		{
+			in:   "https://mirror.example.com/GeoLite2-Country.tar.gz",
+			want: "https://mirror.example.com/GeoLite2-Country.tar.gz.sha256",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := defaultSHA256URL(tt.in)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("expected %s, got %s", tt.want, got)
+		}
+	}
+}
+
+func TestDownloader_Update(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	es, srv := newEditionServer(t, newArchive(t, testMMDBPath))
+	dest := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	d := newTestDownloader(t, srv, dest)
+
+	updated, err := d.Update(context.Background())
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if !updated {
+		t.Fatal("expected first update to install the database")
+	}
+
+	want, _ := os.ReadFile(testMMDBPath)
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("failed to read installed database: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("installed database differs from the archived one")
+	}
+
+	// The ETag makes the second request conditional.
+	updated, err = d.Update(context.Background())
+	if err != nil {
+		t.Fatalf("second update failed: %v", err)
+	}
+	if updated {
+		t.Error("expected unchanged edition not to be installed again")
+	}
+	if n := es.downloads.Load(); n != 1 {
+		t.Errorf("expected 1 full download, got %d", n)
+	}
+}
+
+func TestDownloader_UpdateRejectsChecksumMismatch(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	es, srv := newEditionServer(t, newArchive(t, testMMDBPath))
+	es.checksum = hex.EncodeToString(make([]byte, sha256.Size))
+	dest := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	d := newTestDownloader(t, srv, dest)
+
+	if _, err := d.Update(context.Background()); err == nil {
+		t.Fatal("expected checksum mismatch error")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("expected nothing to be installed after a checksum mismatch")
+	}
+}
+
+func TestDownloader_UpdateRejectsArchiveWithoutMMDB(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tar.NewWriter(gz).Close()
+	gz.Close()
+
+	_, srv := newEditionServer(t, buf.Bytes())
+	dest := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	d := newTestDownloader(t, srv, dest)
+
+	if _, err := d.Update(context.Background()); err == nil {
+		t.Fatal("expected error for archive without .mmdb file")
+	}
+}
+
+func TestDownloader_UpdateRejectsOversizeEdition(t *testing.T) {
+	// A megabyte of zeros compresses to an archive of a few kilobytes.
+	src := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	if err := os.WriteFile(src, make([]byte, 1<<20), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	archive := newArchive(t, src)
+
+	tests := []struct {
+		name    string
+		maxSize int64
+		want    string
+	}{
+		{"archive", int64(len(archive)) - 1, fmt.Sprintf("exceeds the limit of %d bytes", len(archive)-1)},
+		{"database", 64 << 10, "database of 1048576 bytes exceeds the limit of 65536 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := newEditionServer(t, archive)
+			dest := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+			d := newTestDownloader(t, srv, dest)
+			WithMaxDownloadSize(tt.maxSize)(d)
+
+			_, err := d.Update(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected %q, got %v", tt.want, err)
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Error("expected nothing to be installed")
+			}
+		})
+	}
+}
+
+func TestDownloader_UpdateRejectsInvalidDatabase(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	junk := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	if err := os.WriteFile(junk, []byte("not an mmdb"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	es, srv := newEditionServer(t, newArchive(t, junk))
+	dest := copyToTemp(t, testMMDBPath)
+	d := newTestDownloader(t, srv, dest)
+	WithValidator(func(path string) error { return ValidateMmdbFile(path, dest) })(d)
+
+	for range 2 {
+		if _, err := d.Update(context.Background()); err == nil {
+			t.Fatal("expected the invalid database to be rejected")
+		}
+	}
+
+	// The installed database is untouched, and the rejected edition's ETag
+	// was not recorded, so it is downloaded again.
+	if err := ValidateMmdbFile(dest, ""); err != nil {
+		t.Errorf("expected the installed database to stay valid, got %v", err)
+	}
+	if n := es.downloads.Load(); n != 2 {
+		t.Errorf("expected 2 full downloads, got %d", n)
+	}
+}
+
+func TestDownloader_RunReloadsReader(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	_, srv := newEditionServer(t, newArchive(t, testNextMMDBPath))
+	dest := copyToTemp(t, testMMDBPath)
+	// Date the installed file back so If-Modified-Since does not apply.
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(dest, old, old); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+
+	reader, err := NewMmdbReader(dest, WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	d := newTestDownloader(t, srv, dest)
+	WithDownloadInterval(10 * time.Millisecond)(d)
+
+	reloaded := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx, func() error {
+		err := reader.Reload()
+		select {
+		case reloaded <- err:
+		default:
+		}
+		return err
+	})
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("reload failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the downloader to reload the reader")
+	}
+
+	meta, err := reader.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.DatabaseType != "GeoLite2-City" {
+		t.Errorf("expected downloaded GeoLite2-City database, got %s", meta.DatabaseType)
+	}
+}
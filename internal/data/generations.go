@@ -0,0 +1,96 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ErrGenerationNotFound is returned by Revert for generations that are
+// neither current nor retained.
+var ErrGenerationNotFound = errors.New("database generation not found")
+
+// newGeneration wraps reader as the next database generation.
+func (r *MmdbReader) newGeneration(reader *maxminddb.Reader, state fileState) *database {
+	r.generation++
+	return newDatabase(r.generation, reader, state)
+}
+
+// retire moves a replaced generation into the history, closing the oldest
+// retained generations beyond the configured count. The caller must hold mu.
+func (r *MmdbReader) retire(db *database) {
+	r.history = append([]*database{db}, r.history...)
+	for len(r.history) > r.retain {
+		last := len(r.history) - 1
+		r.releaseDB(r.history[last])
+		r.history[last] = nil
+		r.history = r.history[:last]
+	}
+}
+
+// Generations returns the metadata of the current generation followed by
+// the retained previous generations, newest first.
+func (r *MmdbReader) Generations() ([]Metadata, error) {
+	current, err := r.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	generations := []Metadata{*current}
+	for _, db := range r.history {
+		generations = append(generations, r.describe(db))
+	}
+	return generations, nil
+}
+
+// Revert atomically makes the retained generation id current again and pins
+// it, so that the watcher and poller do not re-promote the file on disk
+// until Unpin is called. The replaced generation is retained in turn.
+func (r *MmdbReader) Revert(id uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current := r.db.Load()
+	if current == nil {
+		return errReaderClosed
+	}
+	if current.id == id {
+		r.pinned = true
+		return nil
+	}
+
+	for i, db := range r.history {
+		if db.id != id {
+			continue
+		}
+		r.history = append(r.history[:i], r.history[i+1:]...)
+		r.retire(r.db.Swap(db))
+		r.pinned = true
+		r.listeners.notify()
+		slog.Warn("mmdb database reverted", "path", r.path, "generation", db.id, "version", db.version)
+		return nil
+	}
+	return fmt.Errorf("%w: %d", ErrGenerationNotFound, id)
+}
+
+// Pin stops the watcher and poller from replacing the current generation.
+func (r *MmdbReader) Pin() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pinned = true
+	slog.Info("mmdb generation pinned", "path", r.path)
+}
+
+// Unpin resumes hot-reloading and immediately loads the file on disk, which
+// the watcher and poller may have skipped while the generation was pinned.
+func (r *MmdbReader) Unpin() error {
+	r.mu.Lock()
+	r.pinned = false
+	r.mu.Unlock()
+	slog.Info("mmdb generation unpinned", "path", r.path)
+
+	return r.reload()
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// newGenerationsReader opens a copy of the Country test database that only
+// reloads when the test calls reload.
+func newGenerationsReader(t *testing.T, retain int) (*MmdbReader, string) {
+	t.Helper()
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithWatchMode(WatchPoll), WithPollInterval(time.Hour), WithRetainGenerations(retain))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	return reader, tmpFile
+}
+
+func generationIDs(t *testing.T, reader *MmdbReader) []uint64 {
+	t.Helper()
+	generations, err := reader.Generations()
+	if err != nil {
+		t.Fatalf("failed to list generations: %v", err)
+	}
+	var ids []uint64
+	for _, g := range generations {
+		ids = append(ids, g.Generation)
+	}
+	return ids
+}
+
+func TestMmdbReader_RetainsGenerations(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	reader, _ := newGenerationsReader(t, 2)
+	for i := 0; i < 3; i++ {
+		if err := reader.reload(); err != nil {
+			t.Fatalf("reload failed: %v", err)
+		}
+	}
+
+	// Generation 1 was closed when generation 4 arrived.
+	ids := generationIDs(t, reader)
+	want := []uint64{4, 3, 2}
+	if len(ids) != len(want) {
+		t.Fatalf("expected generations %v, got %v", want, ids)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("expected generations %v, got %v", want, ids)
+		}
+	}
+}
+
+func TestMmdbReader_RevertPinsGeneration(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	reader, tmpFile := newGenerationsReader(t, 2)
+	replaceFile(t, testNextMMDBPath, tmpFile)
+	if err := reader.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	if err := reader.Revert(1); err != nil {
+		t.Fatalf("revert failed: %v", err)
+	}
+	meta, err := reader.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Generation != 1 || meta.DatabaseType != "GeoLite2-Country" || !meta.Pinned {
+		t.Errorf("expected pinned generation 1 (GeoLite2-Country), got %+v", meta)
+	}
+	if ids := generationIDs(t, reader); len(ids) != 2 || ids[1] != 2 {
+		t.Errorf("expected replaced generation 2 to be retained, got %v", ids)
+	}
+
+	// The City file is still on disk, but pinned reloads must not promote it.
+	if err := reader.reload(); err != nil {
+		t.Fatalf("pinned reload failed: %v", err)
+	}
+	result, err := reader.Lookup(net.ParseIP("2.125.160.216"))
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if result.City != "" {
+		t.Errorf("expected pinned Country database, got city %q", result.City)
+	}
+
+	// Unpinning loads the file on disk again.
+	if err := reader.Unpin(); err != nil {
+		t.Fatalf("unpin failed: %v", err)
+	}
+	meta, err = reader.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Pinned || meta.DatabaseType != "GeoLite2-City" {
+		t.Errorf("expected unpinned GeoLite2-City database, got %+v", meta)
+	}
+}
+
+func TestMmdbReader_RevertUnknownGeneration(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	reader, _ := newGenerationsReader(t, 1)
+	if err := reader.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if err := reader.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	// Only generation 2 is retained.
+	if err := reader.Revert(1); !errors.Is(err, ErrGenerationNotFound) {
+		t.Errorf("expected ErrGenerationNotFound, got %v", err)
+	}
+	if err := reader.Revert(2); err != nil {
+		t.Errorf("revert failed: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package data
+
+import "testing"
+
+func TestNormalizeCountry(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+		ok   bool
+	}{
+		{"US", "US", true},
+		{"us", "US", true},
+		{" US ", "US", true},
+		{"usa", "US", true},
+		{"840", "US", true},
+		{"076", "BR", true},
+		{"76", "BR", true},
+		{"UK", "GB", true},
+		{"EL", "GR", true},
+		{"XK", "XK", true},
+		{"USA1", "", false},
+		{"XX", "", false},
+		{"0840", "", false},
+		{"0", "", false},
+		{"+76", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, ok := NormalizeCountry(tt.code)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("expected %q, %v, got %q, %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
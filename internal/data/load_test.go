@@ -0,0 +1,107 @@
+package data
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseLoadMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    LoadMode
+		wantErr bool
+	}{
+		{in: "", want: LoadMmap},
+		{in: "mmap", want: LoadMmap},
+		{in: "memory", want: LoadMemory},
+		{in: "heap", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLoadMode(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMmdbReader_MemoryModeSurvivesInPlaceRewrite(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithLoadMode(LoadMemory), WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	fromDisk, err := statFile(tmpFile)
+	if err != nil {
+		t.Fatalf("failed to stat MMDB: %v", err)
+	}
+	if reader.loadedState().hash != fromDisk.hash {
+		t.Error("expected hash of the loaded buffer to match the file")
+	}
+
+	// Truncating a memory-mapped file would fault on the next lookup; a heap
+	// copy is unaffected.
+	if err := os.Truncate(tmpFile, 0); err != nil {
+		t.Fatalf("failed to truncate MMDB: %v", err)
+	}
+
+	country, err := reader.LookupCountry(net.ParseIP("2.125.160.216"))
+	if err != nil {
+		t.Fatalf("lookup after in-place rewrite failed: %v", err)
+	}
+	if country != "GB" {
+		t.Errorf("expected GB, got %s", country)
+	}
+
+	// The truncated file is rejected and the heap copy keeps serving.
+	if err := reader.reload(); err == nil {
+		t.Error("expected reload of truncated file to fail")
+	}
+	replaceFile(t, testMMDBPath, tmpFile)
+	if err := reader.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+}
+
+// BenchmarkMmdbReader_Lookup compares lookup latency of the load modes.
+func BenchmarkMmdbReader_Lookup(b *testing.B) {
+	if _, err := os.Stat(testMMDBPath); os.IsNotExist(err) {
+		b.Skip("test MMDB file not found")
+	}
+
+	for _, mode := range []LoadMode{LoadMmap, LoadMemory} {
+		b.Run(mode.String(), func(b *testing.B) {
+			reader, err := NewMmdbReader(testMMDBPath, WithLoadMode(mode), WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+			if err != nil {
+				b.Fatalf("failed to create reader: %v", err)
+			}
+			defer reader.Close()
+
+			ip := net.ParseIP("2.125.160.216")
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := reader.Lookup(ip); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,141 @@ type CountryLookup interface {
 	// Returns an error if the lookup fails or the IP cannot be resolved.
 	LookupCountry(ip net.IP) (string, error)
 
+	// Lookup returns the full geolocation record for the given IP address.
+	// Returns an error if the lookup fails or the IP cannot be resolved.
+	Lookup(ip net.IP) (*LookupResult, error)
+
 	// Close releases any resources held by the lookup implementation.
 	Close() error
 }
+
+// LookupResult holds the geolocation attributes resolved for an IP address.
+// Country codes are ISO-3166-1 alpha-2; empty strings mean the database
+// carries no value for that attribute.
+type LookupResult struct {
+	// Country is the country the IP address is located in.
+	Country string
+	// Continent is the two-letter continent code (e.g. "EU", "NA").
+	Continent string
+	// RegisteredCountry is the country the ISP registered the network in.
+	RegisteredCountry string
+	// RepresentedCountry is the country represented by the users of the IP
+	// address, such as a military base abroad.
+	RepresentedCountry string
+	// Subdivisions lists the ISO-3166-2 codes (e.g. "US-CA") of the
+	// subdivisions containing the IP address, most general first. Only
+	// City editions carry subdivisions.
+	Subdivisions []string
+	// City is the English city name. Only City editions carry cities.
+	City string
+	// IsInEuropeanUnion is true if Country is a member state of the EU.
+	IsInEuropeanUnion bool
+	// IsAnonymousProxy is true if the IP address belongs to an anonymous proxy.
+	IsAnonymousProxy bool
+	// IsSatelliteProvider is true if the IP address belongs to a satellite
+	// internet provider, whose users may be located in many countries.
+	IsSatelliteProvider bool
+	// ASN is the autonomous system number announcing the IP address. It is
+	// zero unless an ASN database is configured.
+	ASN uint32
+	// ASOrganization is the organisation registered for ASN.
+	ASOrganization string
+	// Anonymous holds the anonymizer flags for the IP address. All flags
+	// are false unless an Anonymous-IP database is configured.
+	Anonymous AnonymousIP
+	// Network is the network in the database that matched the IP address.
+	Network *net.IPNet
+	// DatabaseVersion identifies the database generation that answered the
+	// lookup (see Metadata.Version).
+	DatabaseVersion string
+	// Source names the source of a CompositeLookup or ConsensusLookup that
+	// answered; it is empty for single-source lookups.
+	Source string
+	// Consensus describes the vote of a ConsensusLookup, or is nil for
+	// other lookups.
+	Consensus *Consensus
+	// AddressClass is the special-purpose class of the IP address, such as
+	// ClassPrivate, or empty for globally routable addresses. Classified
+	// addresses are not looked up.
+	AddressClass AddressClass
+	// ClassAction is the configured policy for AddressClass. With
+	// ClassCountry, Country holds the configured country.
+	ClassAction ClassAction
+	// Translation is the IPv6 transition mechanism the IPv4 address that
+	// was looked up was extracted from, or empty if the IP address was
+	// looked up as given.
+	Translation Translation
+	// EmbeddedIP is the IPv4 address extracted for Translation.
+	EmbeddedIP net.IP
+	// Override is the override rule that set Country, or nil if the
+	// database answered.
+	Override *Override
+}
+
+// MetadataProvider is implemented by lookups that can describe the database
+// they currently serve.
+type MetadataProvider interface {
+	// Metadata returns the metadata of the currently loaded database.
+	Metadata() (*Metadata, error)
+}
+
+// ReloadNotifier is implemented by lookups that swap the data they serve at
+// runtime, so that callers holding derived state can drop it.
+type ReloadNotifier interface {
+	// OnReload registers fn to be called after every swap, once the new
+	// data is serving.
+	OnReload(fn func())
+}
+
+// GenerationManager is implemented by lookups that retain previous database
+// generations and can roll back to them.
+type GenerationManager interface {
+	// Generations lists the current generation followed by the retained
+	// previous generations, newest first.
+	Generations() ([]Metadata, error)
+
+	// Revert makes the retained generation id current and pins it.
+	Revert(id uint64) error
+
+	// Pin stops hot-reloads from replacing the current generation.
+	Pin()
+
+	// Unpin resumes hot-reloads and loads the database file on disk.
+	Unpin() error
+}
+
+// ASNLookup defines the interface for IP-to-ASN lookups.
+type ASNLookup interface {
+	// LookupASN returns the autonomous system announcing the given IP address.
+	// A zero Number means the database has no record for the address.
+	LookupASN(ip net.IP) (*ASN, error)
+
+	// Close releases any resources held by the lookup implementation.
+	Close() error
+}
+
+// ASN identifies an autonomous system.
+type ASN struct {
+	Number       uint32
+	Organization string
+}
+
+// AnonymousIPLookup defines the interface for detecting anonymizing networks.
+type AnonymousIPLookup interface {
+	// LookupAnonymousIP returns the anonymizer flags for the given IP address.
+	LookupAnonymousIP(ip net.IP) (*AnonymousIP, error)
+
+	// Close releases any resources held by the lookup implementation.
+	Close() error
+}
+
+// AnonymousIP holds the flags of the GeoIP2 Anonymous IP database.
+type AnonymousIP struct {
+	// IsAnonymous is true if any of the other flags is set.
+	IsAnonymous        bool
+	IsAnonymousVPN     bool
+	IsHostingProvider  bool
+	IsPublicProxy      bool
+	IsResidentialProxy bool
+	IsTorExitNode      bool
+}
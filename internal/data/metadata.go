@@ -0,0 +1,85 @@
+package data
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// Metadata describes a database generation loaded by an MmdbReader.
+type Metadata struct {
+	// Generation numbers the loads of the reader, starting at 1.
+	Generation uint64
+	// Path is the MMDB file the database was loaded from.
+	Path string
+	// DatabaseType is the MMDB database_type, e.g. "GeoLite2-Country".
+	DatabaseType string
+	// BuildEpoch is the build time of the database as a Unix timestamp.
+	BuildEpoch uint
+	// IPVersion is 4 for IPv4-only databases and 6 for databases that also
+	// contain IPv6 networks.
+	IPVersion uint
+	// NodeCount is the number of nodes in the search tree, or the number
+	// of disjoint ranges of a CSV source.
+	NodeCount uint
+	// FileHash is the hex-encoded SHA-256 of the file.
+	FileHash string
+	// LoadedAt is when the database was loaded or reloaded.
+	LoadedAt time.Time
+	// LastReloadError is the error of the most recent reload attempt. It is
+	// empty if that attempt succeeded or no reload has happened yet. Only
+	// set for the current generation.
+	LastReloadError string
+	// Pinned is true if the current generation is pinned and hot-reloads
+	// are skipped. Only set for the current generation.
+	Pinned bool
+	// Version identifies the generation, e.g.
+	// "GeoLite2-Country/1704728164/3f2a9c1b0d4e". Lookup results carry the
+	// same value in LookupResult.DatabaseVersion.
+	Version string
+	// Source is the name of the CompositeLookup or ConsensusLookup source
+	// this metadata describes. Only set for entries of Sources.
+	Source string
+	// Sources lists the metadata of each source of a CompositeLookup or
+	// ConsensusLookup, in configuration order.
+	Sources []Metadata
+	// Lookups counts the lookups answered by a ConsensusLookup.
+	Lookups uint64
+	// Disagreements counts the lookups of a ConsensusLookup whose sources
+	// were not unanimous; for an entry of Sources, the lookups that source
+	// dissented from.
+	Disagreements uint64
+}
+
+// Metadata returns the metadata of the currently loaded database.
+func (r *MmdbReader) Metadata() (*Metadata, error) {
+	db, err := r.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer r.releaseDB(db)
+
+	meta := r.describe(db)
+	r.mu.Lock()
+	if r.reloadErr != nil {
+		meta.LastReloadError = r.reloadErr.Error()
+	}
+	meta.Pinned = r.pinned
+	r.mu.Unlock()
+
+	return &meta, nil
+}
+
+// describe returns the metadata of the generation db.
+func (r *MmdbReader) describe(db *database) Metadata {
+	return Metadata{
+		Generation:   db.id,
+		Path:         r.path,
+		DatabaseType: db.reader.Metadata.DatabaseType,
+		BuildEpoch:   db.reader.Metadata.BuildEpoch,
+		IPVersion:    db.reader.Metadata.IPVersion,
+		NodeCount:    db.reader.Metadata.NodeCount,
+		FileHash:     hex.EncodeToString(db.state.hash[:]),
+		LoadedAt:     db.loadedAt,
+		Version:      db.version,
+	}
+}
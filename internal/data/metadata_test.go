@@ -0,0 +1,128 @@
+package data
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMmdbReader_Metadata(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	before := time.Now()
+	reader, err := NewMmdbReader(testMMDBPath)
+	if err != nil {
+		t.Fatalf("failed to open MMDB: %v", err)
+	}
+	defer reader.Close()
+
+	meta, err := reader.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if meta.Path != testMMDBPath {
+		t.Errorf("expected path %s, got %s", testMMDBPath, meta.Path)
+	}
+	if meta.DatabaseType != "GeoLite2-Country" {
+		t.Errorf("expected type GeoLite2-Country, got %s", meta.DatabaseType)
+	}
+	if meta.BuildEpoch == 0 {
+		t.Error("expected non-zero build epoch")
+	}
+	if meta.IPVersion != 6 {
+		t.Errorf("expected IP version 6, got %d", meta.IPVersion)
+	}
+	if meta.NodeCount == 0 {
+		t.Error("expected non-zero node count")
+	}
+	if len(meta.FileHash) != 64 {
+		t.Errorf("expected hex SHA-256 file hash, got %q", meta.FileHash)
+	}
+	if meta.LoadedAt.Before(before) {
+		t.Errorf("expected load time after %v, got %v", before, meta.LoadedAt)
+	}
+	if meta.LastReloadError != "" {
+		t.Errorf("expected no reload error, got %s", meta.LastReloadError)
+	}
+	if !strings.HasPrefix(meta.Version, "GeoLite2-Country/") || !strings.HasSuffix(meta.Version, meta.FileHash[:12]) {
+		t.Errorf("unexpected version %q", meta.Version)
+	}
+
+	result, err := reader.Lookup(net.ParseIP("2.125.160.216"))
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if result.DatabaseVersion != meta.Version {
+		t.Errorf("expected lookup database version %s, got %s", meta.Version, result.DatabaseVersion)
+	}
+}
+
+func TestMmdbReader_MetadataAfterReload(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to open MMDB: %v", err)
+	}
+	defer reader.Close()
+
+	before, err := reader.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A failed reload is reported while the old database keeps serving.
+	if err := os.WriteFile(tmpFile, []byte("not an mmdb"), 0644); err != nil {
+		t.Fatalf("failed to corrupt MMDB: %v", err)
+	}
+	if err := reader.reload(); err == nil {
+		t.Fatal("expected reload of corrupt file to fail")
+	}
+	meta, err := reader.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.LastReloadError == "" {
+		t.Error("expected last reload error to be set")
+	}
+	if meta.Version != before.Version {
+		t.Errorf("expected version %s to stay loaded, got %s", before.Version, meta.Version)
+	}
+
+	// A successful reload clears the error and reports the new database.
+	replaceFile(t, testNextMMDBPath, tmpFile)
+	if err := reader.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	meta, err = reader.Metadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.LastReloadError != "" {
+		t.Errorf("expected reload error to be cleared, got %s", meta.LastReloadError)
+	}
+	if meta.DatabaseType != "GeoLite2-City" {
+		t.Errorf("expected type GeoLite2-City, got %s", meta.DatabaseType)
+	}
+	if meta.FileHash == before.FileHash {
+		t.Error("expected file hash to change")
+	}
+}
+
+func TestMmdbReader_MetadataAfterClose(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	reader, err := NewMmdbReader(testMMDBPath)
+	if err != nil {
+		t.Fatalf("failed to open MMDB: %v", err)
+	}
+	reader.Close()
+
+	if _, err := reader.Metadata(); err == nil {
+		t.Error("expected error after close")
+	}
+}
@@ -1,146 +1,281 @@
 package data
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
-	"path/filepath"
+	"sync"
 	"sync/atomic"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/oschwald/geoip2-golang"
+	"github.com/oschwald/maxminddb-golang"
 )
 
-// MmdbReader implements CountryLookup using a MaxMind MMDB file.
+// MmdbReader implements CountryLookup using a MaxMind MMDB file. Both the
+// Country and City editions (GeoLite2/GeoIP2) are supported. Opened on an
+// ASN or Anonymous-IP edition it implements ASNLookup or AnonymousIPLookup
+// instead, with the same hot-reload behaviour.
 // It watches the underlying file for changes and performs atomic
 // hot-reload, so callers never observe downtime.
 type MmdbReader struct {
-	db   atomic.Pointer[geoip2.Reader]
-	path string
-	done chan struct{} // signals the watcher goroutine to stop
+	db    atomic.Pointer[database] // current generation; nil once closed
+	path  string
+	watch *fileWatch // reloads the database when the file changes
+
+	options
+	listeners reloadListeners
+
+	mu         sync.Mutex  // serializes reloads and guards the fields below
+	reloadErr  error       // error of the last reload attempt; nil after a success
+	history    []*database // retained previous generations, newest first
+	pinned     bool        // reloads are skipped while the current generation is pinned
+	generation uint64      // ID of the most recently loaded generation
 }
 
 // NewMmdbReader opens the MMDB file at the given path, starts a background
-// file watcher that automatically reloads the database when the file changes,
-// and returns a reader. Call Close to release resources and stop the watcher.
-func NewMmdbReader(path string) (*MmdbReader, error) {
-	db, err := geoip2.Open(path)
+// file watcher (and, depending on the watch mode, a poller) that automatically
+// reloads the database when the file changes, and returns a reader. Call
+// Close to release resources and stop the watcher.
+func NewMmdbReader(path string, opts ...Option) (*MmdbReader, error) {
+	r := &MmdbReader{
+		path:    path,
+		options: defaultOptions(),
+	}
+	for _, opt := range opts {
+		opt(&r.options)
+	}
+
+	db, state, err := r.open()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open MMDB file: %w", err)
 	}
-
-	r := &MmdbReader{
-		path: path,
-		done: make(chan struct{}),
+	if err := r.validate(db, nil); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("invalid MMDB file: %w", err)
 	}
-	r.db.Store(db)
+	r.db.Store(r.newGeneration(db, state))
 
-	if err := r.startWatcher(); err != nil {
-		// Watcher failure is non-fatal: log and continue with a static reader.
-		slog.Warn("mmdb file watcher not started; hot-reload disabled", "path", path, "error", err)
-	}
+	r.watch = newFileWatch("mmdb file", path, r)
+	r.watch.start(r.watchMode, r.pollInterval)
 
 	return r, nil
 }
 
 // LookupCountry returns the ISO-3166 country code for the given IP address.
 func (r *MmdbReader) LookupCountry(ip net.IP) (string, error) {
-	record, err := r.db.Load().Country(ip)
+	db, err := r.acquire()
 	if err != nil {
 		return "", fmt.Errorf("country lookup failed: %w", err)
 	}
+	defer r.releaseDB(db)
+
+	var record geoip2.Country
+	if err := db.reader.Lookup(ip, &record); err != nil {
+		return "", fmt.Errorf("country lookup failed: %w", err)
+	}
 	return record.Country.IsoCode, nil
 }
 
+// Lookup returns the full geolocation record for the given IP address,
+// including the database network that matched it. Country editions decode
+// with empty subdivision and city fields; City editions fill them in.
+func (r *MmdbReader) Lookup(ip net.IP) (*LookupResult, error) {
+	db, err := r.acquire()
+	if err != nil {
+		return nil, fmt.Errorf("country lookup failed: %w", err)
+	}
+	defer r.releaseDB(db)
+
+	var record geoip2.City
+	network, _, err := db.reader.LookupNetwork(ip, &record)
+	if err != nil {
+		return nil, fmt.Errorf("country lookup failed: %w", err)
+	}
+	result := &LookupResult{
+		Country:             record.Country.IsoCode,
+		Continent:           record.Continent.Code,
+		RegisteredCountry:   record.RegisteredCountry.IsoCode,
+		RepresentedCountry:  record.RepresentedCountry.IsoCode,
+		City:                record.City.Names["en"],
+		IsInEuropeanUnion:   record.Country.IsInEuropeanUnion,
+		IsAnonymousProxy:    record.Traits.IsAnonymousProxy,
+		IsSatelliteProvider: record.Traits.IsSatelliteProvider,
+		Network:             network,
+		DatabaseVersion:     db.version,
+	}
+	for _, sub := range record.Subdivisions {
+		if sub.IsoCode != "" && record.Country.IsoCode != "" {
+			result.Subdivisions = append(result.Subdivisions, record.Country.IsoCode+"-"+sub.IsoCode)
+		}
+	}
+	return result, nil
+}
+
+// LookupASN returns the autonomous system for the given IP address. The
+// reader must have been opened on an ASN edition (e.g. GeoLite2-ASN).
+func (r *MmdbReader) LookupASN(ip net.IP) (*ASN, error) {
+	db, err := r.acquire()
+	if err != nil {
+		return nil, fmt.Errorf("asn lookup failed: %w", err)
+	}
+	defer r.releaseDB(db)
+
+	var record geoip2.ASN
+	if err := db.reader.Lookup(ip, &record); err != nil {
+		return nil, fmt.Errorf("asn lookup failed: %w", err)
+	}
+	return &ASN{
+		Number:       uint32(record.AutonomousSystemNumber),
+		Organization: record.AutonomousSystemOrganization,
+	}, nil
+}
+
+// LookupAnonymousIP returns the anonymizer flags for the given IP address.
+// The reader must have been opened on a GeoIP2-Anonymous-IP edition.
+func (r *MmdbReader) LookupAnonymousIP(ip net.IP) (*AnonymousIP, error) {
+	db, err := r.acquire()
+	if err != nil {
+		return nil, fmt.Errorf("anonymous ip lookup failed: %w", err)
+	}
+	defer r.releaseDB(db)
+
+	var record geoip2.AnonymousIP
+	if err := db.reader.Lookup(ip, &record); err != nil {
+		return nil, fmt.Errorf("anonymous ip lookup failed: %w", err)
+	}
+	return &AnonymousIP{
+		IsAnonymous:        record.IsAnonymous,
+		IsAnonymousVPN:     record.IsAnonymousVPN,
+		IsHostingProvider:  record.IsHostingProvider,
+		IsPublicProxy:      record.IsPublicProxy,
+		IsResidentialProxy: record.IsResidentialProxy,
+		IsTorExitNode:      record.IsTorExitNode,
+	}, nil
+}
+
 // Close stops the file watcher and releases the MMDB reader resources.
+// Lookups still in flight finish against the current database, which is
+// closed when the last of them returns.
 func (r *MmdbReader) Close() error {
-	close(r.done)
-	return r.db.Load().Close()
+	r.watch.stop()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, db := range r.history {
+		errs = append(errs, db.release())
+	}
+	r.history = nil
+	if db := r.db.Swap(nil); db != nil {
+		errs = append(errs, db.release())
+	}
+	return errors.Join(errs...)
 }
 
-// reload opens a new MMDB reader from disk and atomically swaps it in,
-// then closes the old reader.
-func (r *MmdbReader) reload() error {
-	newDB, err := geoip2.Open(r.path)
-	if err != nil {
-		return fmt.Errorf("failed to open new MMDB file: %w", err)
+// acquire returns the current database with a reference held for the
+// caller, who must pass it to releaseDB when done.
+func (r *MmdbReader) acquire() (*database, error) {
+	for {
+		db := r.db.Load()
+		if db == nil {
+			return nil, errReaderClosed
+		}
+		if db.tryAcquire() {
+			return db, nil
+		}
+		// db was retired and closed between Load and tryAcquire; its
+		// successor is already published, so retry.
 	}
+}
 
-	oldDB := r.db.Swap(newDB)
-	if err := oldDB.Close(); err != nil {
+// releaseDB drops a lookup's reference to db.
+func (r *MmdbReader) releaseDB(db *database) {
+	if err := db.release(); err != nil {
 		slog.Warn("failed to close old MMDB reader", "error", err)
 	}
+}
 
-	slog.Info("mmdb database reloaded", "path", r.path)
-	return nil
+// OnReload registers fn to be called after every reload or revert that
+// swaps the current generation.
+func (r *MmdbReader) OnReload(fn func()) {
+	r.listeners.add(fn)
+}
+
+// Reload reloads the database file now, through the same validated path as
+// the watcher and poller. It is meant for callers that replace the file
+// themselves, such as a Downloader.
+func (r *MmdbReader) Reload() error {
+	return r.reload()
 }
 
-// startWatcher sets up an fsnotify watcher on the parent directory of the MMDB
-// file and spawns a goroutine that reloads the database when the file is
-// written or created. Watching the directory (not the file) correctly handles
-// both in-place writes and atomic rename-into-place strategies used by tools
-// like geoipupdate and Kubernetes volume mounts.
-//
-// NOTE: On macOS with Docker Desktop, host-side file changes on bind mounts are
-// proxied through gRPC-FUSE / VirtioFS and do NOT reliably generate inotify
-// events inside the container. This means the watcher will not fire when you
-// edit files on the host. It works correctly on native Linux (production).
-// A polling fallback (startPoller) covers this gap.
-// To simulate file changes in development on macOS,
-// use docker cp to copy the updated MMDB file into the container, which triggers events correctly:
-//
-//	docker compose cp ./testdata/GeoLite2-Country-Test.mmdb geofence:/data/GeoLite2-Country-Test.mmdb
-//
-// You will need to change the volume mount in docker-compose.yaml to a read-write mount for this to work.
-func (r *MmdbReader) startWatcher() error {
-	watcher, err := fsnotify.NewWatcher()
+// reload opens a new MMDB reader from disk, validates it (database type,
+// build epoch, probes) and atomically swaps it in, then retires the old
+// reader: it is kept for Revert, or closed once every lookup that is still
+// using it has finished. Reloads are skipped while a generation is pinned.
+// Concurrent reloads from the watcher and the poller are serialized.
+func (r *MmdbReader) reload() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pinned {
+		slog.Warn("mmdb reload skipped: generation is pinned", "path", r.path, "generation", r.generation)
+		return nil
+	}
+	defer func() { r.reloadErr = err }()
+
+	current := r.db.Load()
+	if current == nil {
+		return errReaderClosed
+	}
+
+	newDB, state, err := r.open()
 	if err != nil {
-		return fmt.Errorf("failed to create file watcher: %w", err)
-	}
-
-	dir := filepath.Dir(r.path)
-	if err := watcher.Add(dir); err != nil {
-		watcher.Close()
-		return fmt.Errorf("failed to watch mmdb directory: %w", err)
-	}
-
-	base := filepath.Base(r.path)
-	slog.Info("mmdb file watcher started", "path", r.path, "watching_dir", dir)
-
-	go func() {
-		defer watcher.Close()
-		for {
-			select {
-			case <-r.done:
-				return
-			case event, ok := <-watcher.Events:
-
-				slog.Info("mmdb file change detected", "event", event.Op.String(), "path", event.Name)
-
-				if !ok {
-					slog.Error("mmdb file watcher event channel closed")
-					return
-				}
-				// Only react to events on our specific file.
-				if filepath.Base(event.Name) != base {
-					continue
-				}
-				// Reload on write or create (covers both in-place updates
-				// and atomic rename-into-place strategies).
-				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) {
-					slog.Info("mmdb file change detected", "event", event.Op.String(), "path", event.Name)
-					if err := r.reload(); err != nil {
-						slog.Error("mmdb hot-reload failed", "error", err)
-					}
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				slog.Error("mmdb file watcher error", "error", err)
-			}
-		}
-	}()
+		return fmt.Errorf("failed to open new MMDB file: %w", err)
+	}
+	if err := r.validate(newDB, &current.reader.Metadata); err != nil {
+		newDB.Close()
+		return fmt.Errorf("candidate MMDB rejected: %w", err)
+	}
 
+	newGen := r.newGeneration(newDB, state)
+	r.retire(r.db.Swap(newGen))
+	r.listeners.notify()
+
+	slog.Info("mmdb database reloaded", "path", r.path, "generation", newGen.id, "version", newGen.version)
 	return nil
 }
+
+// open loads the database file according to the load mode and returns it
+// together with the state of the file it was loaded from.
+func (r *MmdbReader) open() (*maxminddb.Reader, fileState, error) {
+	if r.loadMode == LoadMemory {
+		buf, state, err := readFile(r.path)
+		if err != nil {
+			return nil, fileState{}, err
+		}
+		db, err := maxminddb.FromBytes(buf)
+		if err != nil {
+			return nil, fileState{}, err
+		}
+		return db, state, nil
+	}
+
+	state, err := statFile(r.path)
+	if err != nil {
+		return nil, fileState{}, err
+	}
+	db, err := maxminddb.Open(r.path)
+	if err != nil {
+		return nil, fileState{}, err
+	}
+	return db, state, nil
+}
+
+// loadedState returns the on-disk state of the currently loaded database,
+// or the zero state once the reader is closed.
+func (r *MmdbReader) loadedState() fileState {
+	if db := r.db.Load(); db != nil {
+		return db.state
+	}
+	return fileState{}
+}
@@ -1,14 +1,95 @@
 package data
 
 import (
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/TomasB/geofence/internal/mmdb"
 )
 
-const testMMDBPath = "../../testdata/GeoLite2-Country-Test.mmdb"
+const testFixturePath = "../../testdata/GeoLite2-Country-Test.json"
+
+// testMMDBPath is the MaxMind test database, or a database compiled from
+// testFixturePath by TestMain when it has not been downloaded.
+var testMMDBPath = "../../testdata/GeoLite2-Country-Test.mmdb"
+
+// testNextMMDBPath is a second database compiled by TestMain for the reload
+// tests: a GeoLite2-City edition built a day after testMMDBPath, in which
+// 2.125.160.216 moved from GB to IE.
+var testNextMMDBPath string
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "geofence-testdata-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create fixture directory: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := os.Stat(testMMDBPath); os.IsNotExist(err) {
+		path := filepath.Join(dir, filepath.Base(testMMDBPath))
+		if err := compileFixture(testFixturePath, path); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compile test MMDB: %v\n", err)
+			return 1
+		}
+		testMMDBPath = path
+	}
+
+	testNextMMDBPath = filepath.Join(dir, "GeoLite2-City-Next.mmdb")
+	if err := compileNextFixture(testFixturePath, testNextMMDBPath); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to compile second test MMDB: %v\n", err)
+		return 1
+	}
+	return m.Run()
+}
+
+// testBuildEpoch is the build epoch of the MaxMind test database.
+var testBuildEpoch = time.Unix(1704728164, 0)
+
+// compileFixture compiles the JSON records in src into a GeoLite2-Country
+// database at dst, with the build epoch of the MaxMind test database.
+func compileFixture(src, dst string) error {
+	records, err := mmdb.ReadFile(src, "")
+	if err != nil {
+		return err
+	}
+	_, err = mmdb.WriteFile(dst, records, mmdb.Metadata{
+		DatabaseType: "GeoLite2-Country",
+		BuildEpoch:   testBuildEpoch,
+	})
+	return err
+}
+
+// compileNextFixture compiles the records in src with 2.125.160.216 moved
+// to IE and an added network into a GeoLite2-City database at dst, built a
+// day after the first fixture.
+func compileNextFixture(src, dst string) error {
+	records, err := mmdb.ReadFile(src, "")
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		if records[i].Network == "2.125.160.216/29" {
+			records[i].Country = "IE"
+		}
+	}
+	records = append(records, mmdb.Record{Network: "198.51.100.0/24", Country: "NL", Continent: "EU"})
+	_, err = mmdb.WriteFile(dst, records, mmdb.Metadata{
+		DatabaseType: "GeoLite2-City",
+		BuildEpoch:   testBuildEpoch.Add(24 * time.Hour),
+	})
+	return err
+}
 
 func skipIfNoMMDB(t *testing.T) {
 	t.Helper()
@@ -90,6 +171,101 @@ func TestMmdbReader_LookupCountry(t *testing.T) {
 	}
 }
 
+func TestMmdbReader_Lookup(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	reader, err := NewMmdbReader(testMMDBPath)
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	tests := []struct {
+		name string
+		ip   string
+		want LookupResult
+	}{
+		{
+			name: "EU member",
+			ip:   "89.160.20.112",
+			want: LookupResult{Country: "SE", Continent: "EU", RegisteredCountry: "DE", IsInEuropeanUnion: true},
+		},
+		{
+			name: "anonymous proxy",
+			ip:   "67.43.156.1",
+			want: LookupResult{Country: "BT", Continent: "AS", RegisteredCountry: "RO", IsAnonymousProxy: true},
+		},
+		{
+			name: "represented country",
+			ip:   "202.196.224.1",
+			want: LookupResult{Country: "PH", Continent: "AS", RegisteredCountry: "PH", RepresentedCountry: "US"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := reader.Lookup(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Network == nil || !result.Network.Contains(net.ParseIP(tt.ip)) {
+				t.Errorf("expected network containing %s, got %v", tt.ip, result.Network)
+			}
+			if !strings.HasPrefix(result.DatabaseVersion, "GeoLite2-Country/") {
+				t.Errorf("expected GeoLite2-Country database version, got %q", result.DatabaseVersion)
+			}
+			result.Network = nil
+			result.DatabaseVersion = ""
+			if !reflect.DeepEqual(*result, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, *result)
+			}
+		})
+	}
+}
+
+func TestMmdbReader_LookupCity(t *testing.T) {
+	// A City record laid out like the one of the MaxMind test database.
+	w := mmdb.NewWriter(mmdb.Metadata{DatabaseType: "GeoLite2-City", Languages: []string{"en"}})
+	_, network, _ := net.ParseCIDR("2.125.160.216/29")
+	if err := w.Insert(network, map[string]any{
+		"country":      map[string]any{"iso_code": "GB"},
+		"subdivisions": []any{map[string]any{"iso_code": "ENG"}, map[string]any{"iso_code": "WBK"}},
+		"city":         map[string]any{"names": map[string]any{"en": "Boxford"}},
+	}); err != nil {
+		t.Fatalf("failed to insert record: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create MMDB: %v", err)
+	}
+	if _, err := w.WriteTo(f); err != nil {
+		t.Fatalf("failed to write MMDB: %v", err)
+	}
+	f.Close()
+
+	reader, err := NewMmdbReader(path)
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	result, err := reader.Lookup(net.ParseIP("2.125.160.216"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Country != "GB" {
+		t.Errorf("expected country GB, got %s", result.Country)
+	}
+	wantSubdivisions := []string{"GB-ENG", "GB-WBK"}
+	if !reflect.DeepEqual(result.Subdivisions, wantSubdivisions) {
+		t.Errorf("expected subdivisions %v, got %v", wantSubdivisions, result.Subdivisions)
+	}
+	if result.City != "Boxford" {
+		t.Errorf("expected city Boxford, got %s", result.City)
+	}
+}
+
 func TestMmdbReader_Close(t *testing.T) {
 	skipIfNoMMDB(t)
 
@@ -0,0 +1,190 @@
+package data
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultPollInterval is how often the poller checks the database file when
+// no interval is configured.
+const DefaultPollInterval = 30 * time.Second
+
+// DefaultRetainGenerations is how many previous database generations an
+// MmdbReader keeps for Revert when no count is configured.
+const DefaultRetainGenerations = 2
+
+// WatchMode selects how an MmdbReader detects changes to its database file.
+type WatchMode int
+
+const (
+	// WatchNotify uses fsnotify and falls back to polling only when the
+	// fsnotify watcher cannot be started. This is the default.
+	WatchNotify WatchMode = iota
+	// WatchPoll uses only the poller. Use it on filesystems that never
+	// deliver inotify events, such as NFS or Docker Desktop bind mounts.
+	WatchPoll
+	// WatchBoth runs the poller alongside fsnotify.
+	WatchBoth
+	// WatchNone neither watches nor polls the file. The database only
+	// changes through Reload, e.g. when a Downloader owns the file.
+	WatchNone
+)
+
+// String returns the configuration name of the mode.
+func (m WatchMode) String() string {
+	switch m {
+	case WatchNotify:
+		return "notify"
+	case WatchPoll:
+		return "poll"
+	case WatchBoth:
+		return "both"
+	case WatchNone:
+		return "none"
+	default:
+		return fmt.Sprintf("WatchMode(%d)", int(m))
+	}
+}
+
+// ParseWatchMode converts a configuration value ("notify", "poll", "both" or
+// "none") to a WatchMode. An empty string selects WatchNotify.
+func ParseWatchMode(s string) (WatchMode, error) {
+	switch s {
+	case "", "notify":
+		return WatchNotify, nil
+	case "poll":
+		return WatchPoll, nil
+	case "both":
+		return WatchBoth, nil
+	case "none":
+		return WatchNone, nil
+	default:
+		return WatchNotify, fmt.Errorf("unknown watch mode %q (want notify, poll, both or none)", s)
+	}
+}
+
+// LoadMode selects how an MmdbReader loads its database file.
+type LoadMode int
+
+const (
+	// LoadMmap memory-maps the file. This is the default. The mapping is
+	// backed by the file, so rewriting the file in place (instead of renaming
+	// a new file over it) can crash the process with SIGBUS.
+	LoadMmap LoadMode = iota
+	// LoadMemory reads the whole file into a heap buffer. The process no
+	// longer depends on the file after a load, at the cost of holding every
+	// retained generation on the heap.
+	LoadMemory
+)
+
+// String returns the configuration name of the mode.
+func (m LoadMode) String() string {
+	switch m {
+	case LoadMmap:
+		return "mmap"
+	case LoadMemory:
+		return "memory"
+	default:
+		return fmt.Sprintf("LoadMode(%d)", int(m))
+	}
+}
+
+// ParseLoadMode converts a configuration value ("mmap" or "memory") to a
+// LoadMode. An empty string selects LoadMmap.
+func ParseLoadMode(s string) (LoadMode, error) {
+	switch s {
+	case "", "mmap":
+		return LoadMmap, nil
+	case "memory":
+		return LoadMemory, nil
+	default:
+		return LoadMmap, fmt.Errorf("unknown load mode %q (want mmap or memory)", s)
+	}
+}
+
+// options holds the settings shared by the file-backed readers. CsvReader
+// honours the watch mode, poll interval and probes; the other settings only
+// apply to MmdbReader.
+type options struct {
+	watchMode    WatchMode
+	pollInterval time.Duration
+	loadMode     LoadMode
+
+	probes            []Probe
+	databaseTypes     []string
+	rejectOlderBuilds bool
+
+	retain int // number of previous generations kept for Revert
+}
+
+// defaultOptions returns the settings used when no Option overrides them.
+func defaultOptions() options {
+	return options{
+		pollInterval: DefaultPollInterval,
+		retain:       DefaultRetainGenerations,
+	}
+}
+
+// Option configures an MmdbReader or CsvReader.
+type Option func(*options)
+
+// WithWatchMode sets how the reader detects database file changes.
+func WithWatchMode(mode WatchMode) Option {
+	return func(o *options) {
+		o.watchMode = mode
+	}
+}
+
+// WithLoadMode sets how the reader loads the database file.
+func WithLoadMode(mode LoadMode) Option {
+	return func(o *options) {
+		o.loadMode = mode
+	}
+}
+
+// WithProbes sets the probe IPs a database must resolve to their expected
+// countries. Probes are checked on the initial load, before every reload
+// is promoted, and by Ready.
+func WithProbes(probes ...Probe) Option {
+	return func(o *options) {
+		o.probes = probes
+	}
+}
+
+// WithDatabaseTypes restricts the accepted database types (the MMDB
+// metadata database_type, e.g. "GeoLite2-Country"). By default any type is
+// accepted.
+func WithDatabaseTypes(types ...string) Option {
+	return func(o *options) {
+		o.databaseTypes = types
+	}
+}
+
+// WithRejectOlderBuilds makes reloads reject candidates whose build epoch is
+// older than the loaded database.
+func WithRejectOlderBuilds(reject bool) Option {
+	return func(o *options) {
+		o.rejectOlderBuilds = reject
+	}
+}
+
+// WithRetainGenerations sets how many previous generations are kept open
+// for Revert. Zero closes every generation as soon as it is replaced;
+// negative values are ignored.
+func WithRetainGenerations(n int) Option {
+	return func(o *options) {
+		if n >= 0 {
+			o.retain = n
+		}
+	}
+}
+
+// WithPollInterval sets how often the poller checks the database file.
+// Non-positive values select DefaultPollInterval.
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.pollInterval = interval
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package data
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverrideDatabaseType is the database type in the DatabaseVersion of
+// results answered by an override.
+const OverrideDatabaseType = "overrides"
+
+// errOverrideLookupClosed is returned by lookups on a closed OverrideLookup.
+var errOverrideLookupClosed = errors.New("override lookup is closed")
+
+// Override maps a network to a country regardless of what the database
+// says, e.g. a corporate VPN egress that GeoLite2 places in the wrong
+// country.
+type Override struct {
+	// Network is the network the override applies to.
+	Network *net.IPNet
+	// Country is the ISO-3166-1 alpha-2 code reported for the network.
+	Country string
+	// Reason explains why the override exists.
+	Reason string
+	// ExpiresAt is when the override stops applying; zero means never.
+	ExpiresAt time.Time
+}
+
+// expired reports whether the override no longer applies at now.
+func (o *Override) expired(now time.Time) bool {
+	return !o.ExpiresAt.IsZero() && !now.Before(o.ExpiresAt)
+}
+
+// overrideEntry is one rule of the JSON overrides file.
+type overrideEntry struct {
+	Network   string    `json:"network"`
+	Country   string    `json:"country"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// overrideTable is one loaded generation of the overrides file, most
+// specific network first.
+type overrideTable struct {
+	overrides []Override
+	state     fileState
+	version   string
+}
+
+// OverrideLookup implements CountryLookup by consulting a static table of
+// CIDR overrides before another CountryLookup. The table is read from a
+// JSON file of {"network", "country", "reason", "expires_at"} objects and
+// hot-reloaded when the file changes; expired overrides are ignored.
+type OverrideLookup struct {
+	lookup CountryLookup
+	table  atomic.Pointer[overrideTable] // current table; nil once closed
+	path   string
+	watch  *fileWatch
+	now    func() time.Time
+
+	options
+	listeners reloadListeners
+
+	mu sync.Mutex // serializes reloads
+}
+
+// NewOverrideLookup loads the overrides file at path, starts watching it as
+// configured by opts (see WithWatchMode and WithPollInterval) and returns a
+// CountryLookup that answers from the overrides first and from lookup
+// otherwise. Closing it closes lookup.
+func NewOverrideLookup(lookup CountryLookup, path string, opts ...Option) (*OverrideLookup, error) {
+	o := &OverrideLookup{
+		lookup:  lookup,
+		path:    path,
+		now:     time.Now,
+		options: defaultOptions(),
+	}
+	for _, opt := range opts {
+		opt(&o.options)
+	}
+
+	table, err := o.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load overrides file: %w", err)
+	}
+	o.table.Store(table)
+
+	o.watch = newFileWatch("overrides file", path, o)
+	o.watch.start(o.watchMode, o.pollInterval)
+
+	return o, nil
+}
+
+// LookupCountry returns the ISO-3166 country code for the given IP address.
+func (o *OverrideLookup) LookupCountry(ip net.IP) (string, error) {
+	result, err := o.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	return result.Country, nil
+}
+
+// Lookup returns the country of the most specific unexpired override
+// containing the IP address, with Override set to the rule that applied.
+// Without a matching override the wrapped lookup answers.
+func (o *OverrideLookup) Lookup(ip net.IP) (*LookupResult, error) {
+	table := o.table.Load()
+	if table == nil {
+		return nil, fmt.Errorf("country lookup failed: %w", errOverrideLookupClosed)
+	}
+
+	now := o.now()
+	for i := range table.overrides {
+		override := &table.overrides[i]
+		if override.Network.Contains(ip) && !override.expired(now) {
+			return &LookupResult{
+				Country:         override.Country,
+				Network:         override.Network,
+				DatabaseVersion: table.version,
+				Override:        override,
+			}, nil
+		}
+	}
+	return o.lookup.Lookup(ip)
+}
+
+// Close stops the watcher and releases the wrapped lookup.
+func (o *OverrideLookup) Close() error {
+	o.watch.stop()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.table.Store(nil)
+	return o.lookup.Close()
+}
+
+// OnReload registers fn to be called after every reload that swaps the
+// table.
+func (o *OverrideLookup) OnReload(fn func()) {
+	o.listeners.add(fn)
+}
+
+// Reload reloads the overrides file now, as the watcher and poller do.
+func (o *OverrideLookup) Reload() error {
+	return o.reload()
+}
+
+// reload parses the file again and swaps the new table in if it is valid.
+// Concurrent reloads are serialized.
+func (o *OverrideLookup) reload() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.table.Load() == nil {
+		return errOverrideLookupClosed
+	}
+
+	table, err := o.load()
+	if err != nil {
+		return fmt.Errorf("candidate overrides rejected: %w", err)
+	}
+	o.table.Store(table)
+	o.listeners.notify()
+
+	slog.Info("overrides reloaded", "path", o.path, "overrides", len(table.overrides), "version", table.version)
+	return nil
+}
+
+// loadedState returns the on-disk state of the loaded file, or the zero
+// state once the lookup is closed.
+func (o *OverrideLookup) loadedState() fileState {
+	if table := o.table.Load(); table != nil {
+		return table.state
+	}
+	return fileState{}
+}
+
+// load reads and parses the overrides file.
+func (o *OverrideLookup) load() (*overrideTable, error) {
+	buf, state, err := readFile(o.path)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := parseOverrides(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	now := o.now()
+	for _, override := range overrides {
+		if override.expired(now) {
+			slog.Warn("override expired", "network", override.Network.String(), "country", override.Country,
+				"reason", override.Reason, "expires_at", override.ExpiresAt)
+		}
+	}
+
+	return &overrideTable{
+		overrides: overrides,
+		state:     state,
+		version:   fmt.Sprintf("%s/%d/%s", OverrideDatabaseType, state.modTime.Unix(), hex.EncodeToString(state.hash[:6])),
+	}, nil
+}
+
+// parseOverrides parses a JSON array of override rules, normalizes their
+// countries to alpha-2 and sorts them most specific network first.
+func parseOverrides(buf []byte) ([]Override, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	var entries []overrideEntry
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid overrides JSON: %w", err)
+	}
+
+	overrides := make([]Override, 0, len(entries))
+	for i, e := range entries {
+		_, network, err := net.ParseCIDR(e.Network)
+		if err != nil {
+			return nil, fmt.Errorf("override %d: invalid network %q", i+1, e.Network)
+		}
+		country, ok := NormalizeCountry(e.Country)
+		if !ok {
+			return nil, fmt.Errorf("override %d (%s): unknown country code %q", i+1, e.Network, e.Country)
+		}
+		if strings.TrimSpace(e.Reason) == "" {
+			return nil, fmt.Errorf("override %d (%s): reason is required", i+1, e.Network)
+		}
+		overrides = append(overrides, Override{
+			Network:   network,
+			Country:   country,
+			Reason:    e.Reason,
+			ExpiresAt: e.ExpiresAt,
+		})
+	}
+
+	// Compare IPv4 prefix lengths in the IPv4-mapped space so the most
+	// specific override wins across both families.
+	slices.SortStableFunc(overrides, func(a, b Override) int {
+		return prefixBits(b.Network) - prefixBits(a.Network)
+	})
+	return overrides, nil
+}
+
+// prefixBits returns the prefix length of network in the IPv6 space.
+func prefixBits(network *net.IPNet) int {
+	ones, bits := network.Mask.Size()
+	if bits == 32 {
+		ones += 96
+	}
+	return ones
+}
@@ -0,0 +1,173 @@
+package data
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const overridesJSON = `[
+  {"network": "81.2.69.0/24", "country": "de", "reason": "Frankfurt VPN egress"},
+  {"network": "81.2.69.128/26", "country": "AT", "reason": "Vienna office", "expires_at": "2026-06-01T00:00:00Z"},
+  {"network": "2001:db8::/32", "country": "NL", "reason": "Partner range"}
+]`
+
+// writeOverrides writes content to a fresh overrides file and returns its
+// path.
+func writeOverrides(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write overrides: %v", err)
+	}
+	return path
+}
+
+func TestOverrideLookup_Lookup(t *testing.T) {
+	fallback := &stubCountryLookup{result: &LookupResult{Country: "US", DatabaseVersion: "GeoLite2-Country/1/abc"}}
+	o, err := NewOverrideLookup(fallback, writeOverrides(t, overridesJSON), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create override lookup: %v", err)
+	}
+	defer o.Close()
+	o.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		ip      string
+		country string
+		rule    string
+	}{
+		{ip: "81.2.69.1", country: "DE", rule: "81.2.69.0/24"},
+		{ip: "81.2.69.130", country: "AT", rule: "81.2.69.128/26"},
+		{ip: "::ffff:81.2.69.1", country: "DE", rule: "81.2.69.0/24"},
+		{ip: "2001:db8::1", country: "NL", rule: "2001:db8::/32"},
+		{ip: "8.8.8.8", country: "US"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			result, err := o.Lookup(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Country != tt.country {
+				t.Errorf("expected country %q, got %q", tt.country, result.Country)
+			}
+			if tt.rule == "" {
+				if result.Override != nil {
+					t.Errorf("expected no override, got %+v", result.Override)
+				}
+				if result.DatabaseVersion != "GeoLite2-Country/1/abc" {
+					t.Errorf("expected the database to answer, got version %q", result.DatabaseVersion)
+				}
+				return
+			}
+			if result.Override == nil || result.Override.Network.String() != tt.rule {
+				t.Fatalf("expected override %s, got %+v", tt.rule, result.Override)
+			}
+			if result.Override.Reason == "" {
+				t.Error("expected the override reason to be set")
+			}
+			if !strings.HasPrefix(result.DatabaseVersion, OverrideDatabaseType+"/") {
+				t.Errorf("expected an overrides version, got %q", result.DatabaseVersion)
+			}
+		})
+	}
+}
+
+func TestOverrideLookup_Expiry(t *testing.T) {
+	fallback := &stubCountryLookup{result: &LookupResult{Country: "GB"}}
+	o, err := NewOverrideLookup(fallback, writeOverrides(t, overridesJSON), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create override lookup: %v", err)
+	}
+	defer o.Close()
+
+	// Once the /26 expires, the enclosing /24 applies again.
+	o.now = func() time.Time { return time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC) }
+	result, err := o.Lookup(net.ParseIP("81.2.69.130"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Country != "DE" || result.Override.Network.String() != "81.2.69.0/24" {
+		t.Errorf("expected DE from 81.2.69.0/24 after expiry, got %q from %+v", result.Country, result.Override)
+	}
+}
+
+func TestOverrideLookup_CountryCodes(t *testing.T) {
+	o, err := NewOverrideLookup(&stubCountryLookup{}, writeOverrides(t, `[
+  {"network": "81.2.69.0/24", "country": "uk", "reason": "London office"},
+  {"network": "89.160.20.0/24", "country": "SWE", "reason": "Stockholm office"},
+  {"network": "2001:db8::/32", "country": "528", "reason": "Partner range"}
+]`), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create override lookup: %v", err)
+	}
+	defer o.Close()
+
+	for ip, want := range map[string]string{"81.2.69.1": "GB", "89.160.20.1": "SE", "2001:db8::1": "NL"} {
+		if country, err := o.LookupCountry(net.ParseIP(ip)); err != nil || country != want {
+			t.Errorf("%s: expected %s, got %q, %v", ip, want, country, err)
+		}
+	}
+}
+
+func TestOverrideLookup_InvalidFile(t *testing.T) {
+	tests := map[string]string{
+		"not JSON":        "garbage",
+		"unknown field":   `[{"network": "10.0.0.0/8", "country": "US", "reason": "x", "comment": "y"}]`,
+		"invalid network": `[{"network": "10.0.0.0", "country": "US", "reason": "x"}]`,
+		"unknown country": `[{"network": "10.0.0.0/8", "country": "XX", "reason": "x"}]`,
+		"missing reason":  `[{"network": "10.0.0.0/8", "country": "US"}]`,
+		"invalid expiry":  `[{"network": "10.0.0.0/8", "country": "US", "reason": "x", "expires_at": "tomorrow"}]`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewOverrideLookup(&stubCountryLookup{}, writeOverrides(t, content), WithWatchMode(WatchNone))
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestOverrideLookup_HotReload(t *testing.T) {
+	path := writeOverrides(t, overridesJSON)
+	fallback := &stubCountryLookup{result: &LookupResult{Country: "US"}}
+	o, err := NewOverrideLookup(fallback, path, WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create override lookup: %v", err)
+	}
+	ip := net.ParseIP("81.2.69.1")
+
+	// An invalid file is rejected and the old table keeps serving.
+	replaceContent(t, path, "garbage")
+	o.watch.poll(o.loadedState())
+	if country, _ := o.LookupCountry(ip); country != "DE" {
+		t.Errorf("expected DE after rejected reload, got %s", country)
+	}
+	replaceContent(t, path, `[{"network": "81.2.69.0/24", "country": "XX", "reason": "Unknown"}]`)
+	o.watch.poll(o.loadedState())
+	if country, _ := o.LookupCountry(ip); country != "DE" {
+		t.Errorf("expected DE after rejecting an unknown country, got %s", country)
+	}
+
+	replaceContent(t, path, `[{"network": "81.2.69.0/24", "country": "FR", "reason": "Paris VPN egress"}]`)
+	o.watch.poll(o.loadedState())
+	if country, _ := o.LookupCountry(ip); country != "FR" {
+		t.Errorf("expected FR after reload, got %s", country)
+	}
+
+	if err := o.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if !fallback.closed {
+		t.Error("expected the wrapped lookup to be closed")
+	}
+	if _, err := o.Lookup(ip); err == nil {
+		t.Error("expected lookups to fail after close")
+	}
+}
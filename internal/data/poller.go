@@ -0,0 +1,165 @@
+package data
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileState identifies the content of a database file on disk. The poller
+// compares mtime and size first and only hashes the file when they differ.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// statFile returns the state of the file at path, including its SHA-256.
+func statFile(path string) (fileState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fileState{}, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fileState{}, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	st := fileState{modTime: info.ModTime(), size: info.Size()}
+	copy(st.hash[:], h.Sum(nil))
+	return st, nil
+}
+
+// readFile reads the whole file at path and returns its content together
+// with its state. The hash is computed from the returned bytes, so it always
+// describes exactly what was loaded.
+func readFile(path string) ([]byte, fileState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fileState{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fileState{}, err
+	}
+	buf, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fileState{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return buf, fileState{modTime: info.ModTime(), size: info.Size(), hash: sha256.Sum256(buf)}, nil
+}
+
+// statDir returns the combined state of the regular files in the directory
+// at path: the newest mtime, the total size and a SHA-256 over every file
+// name and content. Hidden files and subdirectories are ignored; symlinks
+// are followed, as used by Kubernetes ConfigMap mounts.
+func statDir(path string) (fileState, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fileState{}, err
+	}
+
+	h := sha256.New()
+	var st fileState
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		name := filepath.Join(path, entry.Name())
+		info, err := os.Stat(name)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		buf, err := os.ReadFile(name)
+		if err != nil {
+			return fileState{}, fmt.Errorf("failed to read file: %w", err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", entry.Name(), len(buf))
+		h.Write(buf)
+		if info.ModTime().After(st.modTime) {
+			st.modTime = info.ModTime()
+		}
+		st.size += info.Size()
+	}
+	copy(st.hash[:], h.Sum(nil))
+	return st, nil
+}
+
+// startPoller spawns a goroutine that checks the MMDB file every interval and
+// reloads the database through the same reload path as the fsnotify watcher.
+// It covers filesystems that never deliver inotify events (NFS volumes,
+// Docker Desktop bind mounts) and hosts where the watcher cannot start.
+func (w *fileWatch) startPoller(interval time.Duration) {
+	slog.Info(w.name+" poller started", "path", w.path, "interval", interval.String())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		seen := w.source.loadedState()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				seen = w.poll(seen)
+			}
+		}
+	}()
+}
+
+// poll compares the file on disk with seen, the state observed by the
+// previous poll, and reloads the database when its content changed. A change
+// of mtime or size alone (e.g. touch) does not trigger a reload unless the
+// content hash differs too. It returns the state to compare against next.
+func (w *fileWatch) poll(seen fileState) fileState {
+	var current fileState
+	if w.dir {
+		// A directory has no mtime and size that track its files' content;
+		// hash them all, which is cheap for configuration directories.
+		var err error
+		if current, err = statDir(w.path); err != nil {
+			slog.Warn(w.name+" poll failed", "path", w.path, "error", err)
+			return seen
+		}
+	} else {
+		info, err := os.Stat(w.path)
+		if err != nil {
+			slog.Warn(w.name+" poll failed", "path", w.path, "error", err)
+			return seen
+		}
+		if info.ModTime().Equal(seen.modTime) && info.Size() == seen.size {
+			return seen
+		}
+
+		if current, err = statFile(w.path); err != nil {
+			slog.Warn(w.name+" poll failed", "path", w.path, "error", err)
+			return seen
+		}
+	}
+	// Skip content we already tried, and content the fsnotify watcher has
+	// already loaded.
+	if current.hash == seen.hash || current.hash == w.source.loadedState().hash {
+		return current
+	}
+
+	slog.Info(w.name+" change detected", "source", "poller", "path", w.path)
+	if err := w.source.reload(); err != nil {
+		slog.Error(w.name+" hot-reload failed", "error", err)
+	}
+	return current
+}
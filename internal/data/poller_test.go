@@ -0,0 +1,252 @@
+package data
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyToTemp copies the MMDB at src into a fresh temp directory and returns
+// the path of the copy.
+func copyToTemp(t *testing.T, src string) string {
+	t.Helper()
+	srcData, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("failed to read source MMDB: %v", err)
+	}
+	tmpFile := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(tmpFile, srcData, 0644); err != nil {
+		t.Fatalf("failed to write temp MMDB: %v", err)
+	}
+	return tmpFile
+}
+
+// replaceFile atomically replaces dst with the content of src.
+func replaceFile(t *testing.T, src, dst string) {
+	t.Helper()
+	srcData, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("failed to read source MMDB: %v", err)
+	}
+	staging := dst + ".tmp"
+	if err := os.WriteFile(staging, srcData, 0644); err != nil {
+		t.Fatalf("failed to write staging MMDB: %v", err)
+	}
+	if err := os.Rename(staging, dst); err != nil {
+		t.Fatalf("failed to rename staging MMDB: %v", err)
+	}
+}
+
+func TestParseWatchMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    WatchMode
+		wantErr bool
+	}{
+		{in: "", want: WatchNotify},
+		{in: "notify", want: WatchNotify},
+		{in: "poll", want: WatchPoll},
+		{in: "both", want: WatchBoth},
+		{in: "none", want: WatchNone},
+		{in: "inotify", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseWatchMode(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMmdbReader_Poll_TouchDoesNotReload(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	before := reader.db.Load()
+	seen := reader.loadedState()
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tmpFile, later, later); err != nil {
+		t.Fatalf("failed to touch MMDB: %v", err)
+	}
+
+	seen = reader.watch.poll(seen)
+	if reader.db.Load() != before {
+		t.Error("expected no reload when only mtime changed")
+	}
+	if !seen.modTime.Equal(later) {
+		t.Errorf("expected poller to record new mtime %v, got %v", later, seen.modTime)
+	}
+}
+
+func TestMmdbReader_Poll_ContentChangeReloads(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	before := reader.db.Load()
+	replaceFile(t, testNextMMDBPath, tmpFile)
+
+	seen := reader.watch.poll(reader.loadedState())
+	if reader.db.Load() == before {
+		t.Fatal("expected reload after content change")
+	}
+	if seen.hash != reader.loadedState().hash {
+		t.Error("expected poller state to match the loaded database")
+	}
+
+	// A second poll of the same content must not reload again.
+	after := reader.db.Load()
+	reader.watch.poll(seen)
+	if reader.db.Load() != after {
+		t.Error("expected no reload when content is unchanged")
+	}
+}
+
+func TestMmdbReader_Poll_InvalidFileKeepsOldReader(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	before := reader.db.Load()
+	staging := tmpFile + ".tmp"
+	if err := os.WriteFile(staging, []byte("not a valid mmdb"), 0644); err != nil {
+		t.Fatalf("failed to write invalid MMDB: %v", err)
+	}
+	if err := os.Rename(staging, tmpFile); err != nil {
+		t.Fatalf("failed to rename invalid MMDB: %v", err)
+	}
+
+	seen := reader.watch.poll(reader.loadedState())
+	if reader.db.Load() != before {
+		t.Error("expected old reader to stay active after failed reload")
+	}
+	if seen.hash == reader.loadedState().hash {
+		t.Error("expected poller to remember the rejected content")
+	}
+}
+
+func TestMmdbReader_PollerHotReload(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithWatchMode(WatchPoll), WithPollInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	replaceFile(t, testNextMMDBPath, tmpFile)
+
+	// Give the poller time to detect the change and reload.
+	time.Sleep(500 * time.Millisecond)
+
+	result, err := reader.Lookup(net.ParseIP("2.125.160.216"))
+	if err != nil {
+		t.Fatalf("lookup failed after reload: %v", err)
+	}
+	if result.Country != "IE" {
+		t.Errorf("expected the second database after poller reload, got country %q", result.Country)
+	}
+}
+
+func TestWatchDir_Poll(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("one"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	reloads := 0
+	w, err := WatchDir("test directory", dir, func() error { reloads++; return nil }, WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to watch directory: %v", err)
+	}
+	defer w.Close()
+	seen := w.watch.source.loadedState()
+
+	// Hidden files such as Kubernetes' ..data are not part of the content.
+	if err := os.WriteFile(filepath.Join(dir, ".swp"), []byte("x"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if seen = w.watch.poll(seen); reloads != 0 {
+		t.Fatalf("expected no reload for a hidden file, got %d", reloads)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "b.json"), []byte("two"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if seen = w.watch.poll(seen); reloads != 1 {
+		t.Fatalf("expected a reload after adding a file, got %d", reloads)
+	}
+	if seen = w.watch.poll(seen); reloads != 1 {
+		t.Fatalf("expected no reload without changes, got %d", reloads)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a.yaml")); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	if w.watch.poll(seen); reloads != 2 {
+		t.Errorf("expected a reload after removing a file, got %d", reloads)
+	}
+}
+
+func TestWatchDir_LogsName(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	dir := t.TempDir()
+	w, err := WatchDir("policy directory", dir, func() error { return nil },
+		WithWatchMode(WatchPoll), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to watch directory: %v", err)
+	}
+	defer w.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("one"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	w.watch.poll(w.watch.source.loadedState())
+
+	for _, msg := range []string{`msg="policy directory poller started"`, `msg="policy directory change detected"`} {
+		if !strings.Contains(logs.String(), msg) {
+			t.Errorf("expected %s in the logs, got:\n%s", msg, logs.String())
+		}
+	}
+	if strings.Contains(logs.String(), "mmdb") {
+		t.Errorf("expected no mmdb log messages, got:\n%s", logs.String())
+	}
+}
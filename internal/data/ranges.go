@@ -0,0 +1,179 @@
+package data
+
+import (
+	"net"
+	"slices"
+	"sort"
+)
+
+// uint128 is an IPv6 address (IPv4 addresses in their IPv4-mapped form) as
+// a 128-bit integer.
+type uint128 struct {
+	hi, lo uint64
+}
+
+// uint128From16 converts a 16-byte address.
+func uint128From16(b [16]byte) uint128 {
+	var u uint128
+	for i := 0; i < 8; i++ {
+		u.hi = u.hi<<8 | uint64(b[i])
+		u.lo = u.lo<<8 | uint64(b[i+8])
+	}
+	return u
+}
+
+func (u uint128) less(v uint128) bool {
+	return u.hi < v.hi || (u.hi == v.hi && u.lo < v.lo)
+}
+
+// cmp returns -1, 0 or +1 as u is less than, equal to or greater than v.
+func (u uint128) cmp(v uint128) int {
+	switch {
+	case u.less(v):
+		return -1
+	case v.less(u):
+		return 1
+	}
+	return 0
+}
+
+// hostMask returns a value with the low n bits set.
+func hostMask(n int) uint128 {
+	switch {
+	case n <= 0:
+		return uint128{}
+	case n < 64:
+		return uint128{lo: 1<<n - 1}
+	case n < 128:
+		return uint128{hi: 1<<(n-64) - 1, lo: ^uint64(0)}
+	default:
+		return uint128{hi: ^uint64(0), lo: ^uint64(0)}
+	}
+}
+
+func (u uint128) or(v uint128) uint128 {
+	return uint128{hi: u.hi | v.hi, lo: u.lo | v.lo}
+}
+
+// addOne returns u+1 and whether it overflowed.
+func (u uint128) addOne() (uint128, bool) {
+	lo := u.lo + 1
+	hi := u.hi
+	if lo == 0 {
+		hi++
+	}
+	return uint128{hi: hi, lo: lo}, hi == 0 && lo == 0
+}
+
+// subOne returns u-1 and whether it underflowed.
+func (u uint128) subOne() (uint128, bool) {
+	lo := u.lo - 1
+	hi := u.hi
+	if u.lo == 0 {
+		hi--
+	}
+	return uint128{hi: hi, lo: lo}, u.hi == 0 && u.lo == 0
+}
+
+func (u uint128) andNot(v uint128) uint128 {
+	return uint128{hi: u.hi &^ v.hi, lo: u.lo &^ v.lo}
+}
+
+// addrRange is an inclusive range of addresses mapped to a country.
+type addrRange struct {
+	lo, hi  uint128
+	country string
+}
+
+// rangeTable maps disjoint address ranges, sorted by start, to country
+// codes and answers lookups by binary search. It takes one entry per range
+// of the source file, however the range aligns to prefixes.
+type rangeTable struct {
+	ranges []addrRange
+}
+
+// newRangeTable builds a table from ranges in any order. Where ranges
+// overlap, the one starting later wins, and of ranges with the same start
+// the shorter one, so a range nested in another overrides it.
+func newRangeTable(ranges []addrRange) rangeTable {
+	slices.SortStableFunc(ranges, func(a, b addrRange) int {
+		if c := a.lo.cmp(b.lo); c != 0 {
+			return c
+		}
+		return b.hi.cmp(a.hi)
+	})
+
+	t := rangeTable{ranges: make([]addrRange, 0, len(ranges))}
+	var stack []addrRange // ranges containing pos, innermost last
+	pos, exhausted := uint128{}, false
+	// flush emits the innermost open range up to hi and moves pos past it.
+	flush := func(hi uint128) {
+		top := stack[len(stack)-1]
+		if exhausted || hi.less(pos) {
+			return
+		}
+		t.add(addrRange{lo: pos, hi: hi, country: top.country})
+		pos, exhausted = hi.addOne()
+	}
+	for _, r := range ranges {
+		for len(stack) > 0 && stack[len(stack)-1].hi.less(r.lo) {
+			flush(stack[len(stack)-1].hi)
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 && pos.less(r.lo) {
+			before, _ := r.lo.subOne()
+			flush(before)
+		}
+		if !exhausted && pos.less(r.lo) {
+			pos = r.lo
+		}
+		stack = append(stack, r)
+	}
+	for len(stack) > 0 {
+		flush(stack[len(stack)-1].hi)
+		stack = stack[:len(stack)-1]
+	}
+	return t
+}
+
+// add appends r, merging it into the last range if they are adjacent and
+// share the country.
+func (t *rangeTable) add(r addrRange) {
+	if n := len(t.ranges); n > 0 {
+		last := &t.ranges[n-1]
+		if next, _ := last.hi.addOne(); next == r.lo && last.country == r.country {
+			last.hi = r.hi
+			return
+		}
+	}
+	t.ranges = append(t.ranges, r)
+}
+
+// lookup returns the country of the range containing addr and the length
+// of the largest prefix around addr within that range, or "" if no range
+// contains it.
+func (t *rangeTable) lookup(addr uint128) (string, int) {
+	i := sort.Search(len(t.ranges), func(i int) bool { return !t.ranges[i].hi.less(addr) })
+	if i == len(t.ranges) || addr.less(t.ranges[i].lo) {
+		return "", 0
+	}
+	r := t.ranges[i]
+	for host := 128; host > 0; host-- {
+		mask := hostMask(host)
+		if !addr.andNot(mask).less(r.lo) && !r.hi.less(addr.or(mask)) {
+			return r.country, 128 - host
+		}
+	}
+	return r.country, 128
+}
+
+// prefixNetwork returns the network of the given prefix length containing
+// ip. IPv4 addresses yield IPv4 networks.
+func prefixNetwork(ip net.IP, length int) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil && length >= 96 {
+		mask := net.CIDRMask(length-96, 32)
+		return &net.IPNet{IP: ip4.Mask(mask), Mask: mask}
+	}
+	mask := net.CIDRMask(length, 128)
+	return &net.IPNet{IP: ip.To16().Mask(mask), Mask: mask}
+}
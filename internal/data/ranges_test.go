@@ -0,0 +1,91 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"testing"
+)
+
+func addrU(s string) uint128 {
+	return uint128From16(netip.MustParseAddr(s).As16())
+}
+
+func TestNewRangeTable(t *testing.T) {
+	last := uint128{hi: ^uint64(0), lo: ^uint64(0)}
+	table := newRangeTable([]addrRange{
+		{lo: addrU("::ffff:10.0.0.0"), hi: addrU("::ffff:10.255.255.255"), country: "US"},
+		{lo: addrU("::ffff:10.1.0.0"), hi: addrU("::ffff:10.1.0.255"), country: "CA"},     // nested
+		{lo: addrU("::ffff:10.0.0.0"), hi: addrU("::ffff:10.0.0.255"), country: "MX"},     // same start, shorter
+		{lo: addrU("::ffff:10.255.255.0"), hi: addrU("::ffff:11.0.0.255"), country: "GB"}, // overlaps the end
+		{lo: addrU("::ffff:11.0.1.0"), hi: addrU("::ffff:11.0.1.255"), country: "GB"},     // adjacent, merged
+		{lo: addrU("8000::"), hi: last, country: "JP"},
+		{lo: addrU("ffff::"), hi: last, country: "KR"}, // nested up to the last address
+	})
+
+	tests := []struct {
+		addr    string
+		country string
+		length  int
+	}{
+		{"::ffff:10.0.0.1", "MX", 120},
+		{"::ffff:10.0.1.1", "US", 120},
+		{"::ffff:10.1.0.1", "CA", 120},
+		{"::ffff:10.1.1.1", "US", 120},
+		{"::ffff:10.128.0.1", "US", 106},
+		{"::ffff:10.255.255.1", "GB", 120},
+		{"::ffff:11.0.1.1", "GB", 119},
+		{"::ffff:11.0.2.1", "", 0},
+		{"::ffff:9.255.255.255", "", 0},
+		{"8000::1", "JP", 2},
+		{"ffff::1", "KR", 16},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "KR", 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			country, length := table.lookup(addrU(tt.addr))
+			if country != tt.country || length != tt.length {
+				t.Errorf("expected %q /%d, got %q /%d", tt.country, tt.length, country, length)
+			}
+		})
+	}
+	if len(table.ranges) != 7 {
+		t.Errorf("expected 7 disjoint ranges, got %d: %+v", len(table.ranges), table.ranges)
+	}
+}
+
+// BenchmarkParseCSVRanges loads a file the size of the DB-IP IP-to-Country
+// Lite edition (about 300k IPv4 and 250k IPv6 ranges) and reports the heap
+// the table retains.
+func BenchmarkParseCSVRanges(b *testing.B) {
+	var buf bytes.Buffer
+	countries := []string{"US", "DE", "JP", "BR", "IN", "FR", "GB", "CN"}
+	for i := 0; i < 300000; i++ {
+		start := uint32(16777216 + i*4096)
+		fmt.Fprintf(&buf, "%d.%d.%d.0,%d.%d.%d.%d,%s\n",
+			start>>24, start>>16&0xff, start>>8&0xff,
+			start>>24, start>>16&0xff, (start>>8&0xff)|0x0b, 200+i%50, countries[i%len(countries)])
+	}
+	for i := 0; i < 250000; i++ {
+		fmt.Fprintf(&buf, "2a%02x:%x::,2a%02x:%x:ffff:ffff:ffff:ffff:ffff:ff%02x,%s\n",
+			i>>16, i&0xffff, i>>16, i&0xffff, i%256, countries[i%len(countries)])
+	}
+	content := buf.Bytes()
+
+	b.ReportAllocs()
+	var before, after runtime.MemStats
+	for b.Loop() {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		table := &csvTable{}
+		if err := parseCSVRanges(bytes.NewReader(content), table); err != nil {
+			b.Fatal(err)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/(1<<20), "MB-retained")
+		b.ReportMetric(float64(len(table.ranges.ranges)), "ranges")
+		runtime.KeepAlive(table)
+	}
+}
@@ -0,0 +1,95 @@
+package data
+
+import "net"
+
+// Translation names an IPv6 transition mechanism that embeds an IPv4
+// address in an IPv6 address.
+type Translation string
+
+const (
+	TranslationNAT64  Translation = "nat64"  // 64:ff9b::/96 (RFC 6052)
+	Translation6to4   Translation = "6to4"   // 2002::/16 (RFC 3056)
+	TranslationTeredo Translation = "teredo" // 2001::/32 (RFC 4380)
+)
+
+var (
+	nat64Prefix  = mustParseCIDR("64:ff9b::/96")
+	sixToFour    = mustParseCIDR("2002::/16")
+	teredoPrefix = mustParseCIDR("2001::/32")
+)
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// EmbeddedIPv4 returns the IPv4 address embedded in a NAT64, 6to4 or Teredo
+// address and the translation it was extracted by. It returns nil and ""
+// for any other address, including IPv4 and IPv4-mapped addresses.
+func EmbeddedIPv4(ip net.IP) (net.IP, Translation) {
+	if ip.To4() != nil || len(ip) != net.IPv6len {
+		return nil, ""
+	}
+	switch {
+	case nat64Prefix.Contains(ip):
+		// The IPv4 address is the last 32 bits of the /96.
+		return net.IPv4(ip[12], ip[13], ip[14], ip[15]).To4(), TranslationNAT64
+	case sixToFour.Contains(ip):
+		// 2002:AABB:CCDD::/48 is the site of IPv4 address AA.BB.CC.DD.
+		return net.IPv4(ip[2], ip[3], ip[4], ip[5]).To4(), Translation6to4
+	case teredoPrefix.Contains(ip):
+		// The client's public IPv4 address is stored inverted in the last
+		// 32 bits, behind the server address, flags and obfuscated port.
+		return net.IPv4(^ip[12], ^ip[13], ^ip[14], ^ip[15]).To4(), TranslationTeredo
+	}
+	return nil, ""
+}
+
+// TranslatingLookup implements CountryLookup by geolocating the IPv4
+// address embedded in NAT64, 6to4 and Teredo addresses. The databases
+// rarely place those IPv6 networks in a useful country, while the embedded
+// IPv4 address is the one of the actual client or its gateway.
+type TranslatingLookup struct {
+	lookup CountryLookup
+}
+
+// NewTranslatingLookup returns a CountryLookup that looks up the embedded
+// IPv4 address of translated IPv6 addresses with lookup, and every other
+// address as given. Closing it closes lookup.
+func NewTranslatingLookup(lookup CountryLookup) *TranslatingLookup {
+	return &TranslatingLookup{lookup: lookup}
+}
+
+// LookupCountry returns the ISO-3166 country code for the given IP address.
+func (t *TranslatingLookup) LookupCountry(ip net.IP) (string, error) {
+	result, err := t.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	return result.Country, nil
+}
+
+// Lookup looks up the embedded IPv4 address of a translated IPv6 address,
+// reporting the translation and the extracted address in the result, or
+// looks up ip itself.
+func (t *TranslatingLookup) Lookup(ip net.IP) (*LookupResult, error) {
+	embedded, translation := EmbeddedIPv4(ip)
+	if embedded == nil {
+		return t.lookup.Lookup(ip)
+	}
+	result, err := t.lookup.Lookup(embedded)
+	if err != nil {
+		return nil, err
+	}
+	result.Translation = translation
+	result.EmbeddedIP = embedded
+	return result, nil
+}
+
+// Close releases the wrapped lookup.
+func (t *TranslatingLookup) Close() error {
+	return t.lookup.Close()
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"net"
+	"testing"
+)
+
+func TestEmbeddedIPv4(t *testing.T) {
+	tests := []struct {
+		ip          string
+		embedded    string
+		translation Translation
+	}{
+		{"64:ff9b::102:304", "1.2.3.4", TranslationNAT64},
+		{"64:ff9b::216.160.83.56", "216.160.83.56", TranslationNAT64},
+		{"2002:d8a0:5338::1", "216.160.83.56", Translation6to4},
+		{"2002:102:304:1:2:3:4:5", "1.2.3.4", Translation6to4},
+		// RFC 4380 example: server 65.54.227.120, client 192.0.2.45:40000.
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", "192.0.2.45", TranslationTeredo},
+		{"2001:db8::1", "", ""},
+		{"2001:218::1", "", ""},
+		{"64:ff9b:1::102:304", "", ""},
+		{"216.160.83.56", "", ""},
+		{"::ffff:216.160.83.56", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			embedded, translation := EmbeddedIPv4(net.ParseIP(tt.ip))
+			if translation != tt.translation {
+				t.Errorf("expected translation %q, got %q", tt.translation, translation)
+			}
+			if got := ipString(embedded); got != tt.embedded {
+				t.Errorf("expected embedded IPv4 %q, got %q", tt.embedded, got)
+			}
+		})
+	}
+}
+
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+func TestTranslatingLookup_Lookup(t *testing.T) {
+	reader, err := NewCsvReader(writeCSV(t, dbipCSV), WithWatchMode(WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	l := NewTranslatingLookup(reader)
+	defer l.Close()
+
+	tests := []struct {
+		ip          string
+		country     string
+		network     string
+		translation Translation
+	}{
+		{"64:ff9b::1.0.0.1", "AU", "1.0.0.0/24", TranslationNAT64},
+		{"2002:27d:a0d8::1", "GB", "2.125.160.216/29", Translation6to4},
+		{"2001:0:4136:e378:8000:63bf:fd82:5f27", "GB", "2.125.160.216/29", TranslationTeredo},
+		{"2001:218::1", "JP", "2001:218::/48", ""},
+		{"1.0.0.1", "AU", "1.0.0.0/24", ""},
+	}
+	for _, tt := range tests {
+		result, err := l.Lookup(net.ParseIP(tt.ip))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.ip, err)
+		}
+		if result.Country != tt.country || result.Network.String() != tt.network {
+			t.Errorf("%s: expected %s in %s, got %s in %v", tt.ip, tt.country, tt.network, result.Country, result.Network)
+		}
+		if result.Translation != tt.translation {
+			t.Errorf("%s: expected translation %q, got %q", tt.ip, tt.translation, result.Translation)
+		}
+		if (tt.translation == "") != (result.EmbeddedIP == nil) {
+			t.Errorf("%s: unexpected embedded IP %v", tt.ip, result.EmbeddedIP)
+		}
+	}
+}
+
+func TestTranslatingLookup_ClassifiesEmbeddedIPv4(t *testing.T) {
+	inner := &countingLookup{country: "SE"}
+	l := NewTranslatingLookup(NewAddressClassifier(inner, nil))
+
+	// 6to4 site of 192.168.1.1
+	result, err := l.Lookup(net.ParseIP("2002:c0a8:101::1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.AddressClass != ClassPrivate || result.Translation != Translation6to4 {
+		t.Errorf("expected a private 6to4 address, got %q via %q", result.AddressClass, result.Translation)
+	}
+	if inner.calls != 0 {
+		t.Errorf("expected no lookup, got %d", inner.calls)
+	}
+}
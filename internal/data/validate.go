@@ -0,0 +1,160 @@
+package data
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Database types accepted by each kind of lookup. They mirror the editions
+// geoip2-golang supports for the corresponding record types.
+var (
+	CountryDatabaseTypes = []string{
+		"GeoLite2-Country", "GeoIP2-Country",
+		"GeoLite2-City", "GeoIP2-City", "GeoIP2-Precision-City",
+		"GeoIP2-City-Africa", "GeoIP2-City-Asia-Pacific", "GeoIP2-City-Europe",
+		"GeoIP2-City-North-America", "GeoIP2-City-South-America",
+		"GeoIP-City-Redacted-US", "GeoIP2-Enterprise", "GeoIP-Enterprise-Redacted-US",
+		"DBIP-Country-Lite", "DBIP-Country", "DBIP-City-Lite", "DBIP-Location (compat=City)",
+	}
+	ASNDatabaseTypes = []string{
+		"GeoLite2-ASN", "GeoIP2-ISP", "GeoIP2-Precision-ISP", "DBIP-ASN-Lite (compat=GeoLite2-ASN)",
+	}
+	AnonymousIPDatabaseTypes = []string{
+		"GeoIP2-Anonymous-IP",
+	}
+)
+
+// Probe is an IP address together with the country a valid database must
+// resolve it to.
+type Probe struct {
+	IP      net.IP
+	Country string
+}
+
+// ParseProbes parses a comma-separated list of ip=country pairs, for
+// example "2.125.160.216=GB,216.160.83.56=US". An empty string yields no
+// probes.
+func ParseProbes(s string) ([]Probe, error) {
+	var probes []Probe
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ipStr, country, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid probe %q: want ip=country", entry)
+		}
+		ip := net.ParseIP(strings.TrimSpace(ipStr))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid probe %q: bad IP address", entry)
+		}
+		country = strings.TrimSpace(country)
+		if country == "" {
+			return nil, fmt.Errorf("invalid probe %q: missing country", entry)
+		}
+		probes = append(probes, Probe{IP: ip, Country: country})
+	}
+	return probes, nil
+}
+
+// validate checks a candidate database before it is promoted. current is the
+// metadata of the database being replaced, or nil on the initial load.
+func (r *MmdbReader) validate(candidate *maxminddb.Reader, current *maxminddb.Metadata) error {
+	if err := checkDatabaseType(candidate.Metadata, r.databaseTypes); err != nil {
+		return err
+	}
+	if r.rejectOlderBuilds && current != nil {
+		if err := checkBuildEpoch(candidate.Metadata, *current); err != nil {
+			return err
+		}
+	}
+	return checkProbes(candidate, r.probes)
+}
+
+// ValidateMmdbFile checks the MMDB file at candidate the way an MmdbReader
+// configured with opts checks a reload before promoting it: database type,
+// probes and, with WithRejectOlderBuilds, the build epoch against the file
+// at current if there is one. It lets a file be validated before it is
+// moved into place.
+func ValidateMmdbFile(candidate, current string, opts ...Option) error {
+	r := &MmdbReader{path: candidate, options: defaultOptions()}
+	for _, opt := range opts {
+		opt(&r.options)
+	}
+
+	db, err := maxminddb.Open(candidate)
+	if err != nil {
+		return fmt.Errorf("failed to open MMDB file: %w", err)
+	}
+	defer db.Close()
+
+	var currentMeta *maxminddb.Metadata
+	if r.rejectOlderBuilds {
+		if cur, err := maxminddb.Open(current); err == nil {
+			currentMeta = &cur.Metadata
+			cur.Close()
+		}
+	}
+	return r.validate(db, currentMeta)
+}
+
+// checkDatabaseType rejects databases whose type is not in types. An empty
+// list accepts any type.
+func checkDatabaseType(meta maxminddb.Metadata, types []string) error {
+	if len(types) == 0 || slices.Contains(types, meta.DatabaseType) {
+		return nil
+	}
+	return fmt.Errorf("unexpected database type %q (want one of %s)", meta.DatabaseType, strings.Join(types, ", "))
+}
+
+// checkBuildEpoch rejects candidates built before the current database.
+func checkBuildEpoch(candidate, current maxminddb.Metadata) error {
+	if candidate.BuildEpoch < current.BuildEpoch {
+		return fmt.Errorf("build epoch %d is older than the loaded build %d", candidate.BuildEpoch, current.BuildEpoch)
+	}
+	return nil
+}
+
+// checkProbes verifies that every probe IP resolves to its expected country.
+func checkProbes(reader *maxminddb.Reader, probes []Probe) error {
+	for _, p := range probes {
+		var record geoip2.Country
+		if err := reader.Lookup(p.IP, &record); err != nil {
+			return fmt.Errorf("probe %s: %w", p.IP, err)
+		}
+		if record.Country.IsoCode != p.Country {
+			return fmt.Errorf("probe %s: expected country %s, got %q", p.IP, p.Country, record.Country.IsoCode)
+		}
+	}
+	return nil
+}
+
+// readyProbeIP is looked up by Ready when no probes are configured, so
+// that a database that can no longer be read still fails readiness. It
+// only has to decode; whether the database knows the address is irrelevant.
+var readyProbeIP = net.IPv4(1, 1, 1, 1)
+
+// Ready runs the configured probes against the current database, or a
+// single lookup of readyProbeIP without probes. It is meant for readiness
+// checks and fails once the reader is closed.
+func (r *MmdbReader) Ready() error {
+	db, err := r.acquire()
+	if err != nil {
+		return err
+	}
+	defer r.releaseDB(db)
+	if len(r.probes) == 0 {
+		var record geoip2.Country
+		if err := db.reader.Lookup(readyProbeIP, &record); err != nil {
+			return fmt.Errorf("lookup of %s failed: %w", readyProbeIP, err)
+		}
+		return nil
+	}
+	return checkProbes(db.reader, r.probes)
+}
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+func TestParseProbes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []Probe
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "2.125.160.216=GB", want: []Probe{{IP: net.ParseIP("2.125.160.216"), Country: "GB"}}},
+		{
+			in: " 2.125.160.216=GB, 2001:218::=JP ,",
+			want: []Probe{
+				{IP: net.ParseIP("2.125.160.216"), Country: "GB"},
+				{IP: net.ParseIP("2001:218::"), Country: "JP"},
+			},
+		},
+		{in: "2.125.160.216", wantErr: true},
+		{in: "not-an-ip=GB", wantErr: true},
+		{in: "2.125.160.216=", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseProbes(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d probes, got %d", len(tt.want), len(got))
+			}
+			for i := range got {
+				if !got[i].IP.Equal(tt.want[i].IP) || got[i].Country != tt.want[i].Country {
+					t.Errorf("probe %d: expected %v, got %v", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckBuildEpoch(t *testing.T) {
+	current := maxminddb.Metadata{BuildEpoch: 200}
+
+	if err := checkBuildEpoch(maxminddb.Metadata{BuildEpoch: 200}, current); err != nil {
+		t.Errorf("expected same build to be accepted, got %v", err)
+	}
+	if err := checkBuildEpoch(maxminddb.Metadata{BuildEpoch: 300}, current); err != nil {
+		t.Errorf("expected newer build to be accepted, got %v", err)
+	}
+	if err := checkBuildEpoch(maxminddb.Metadata{BuildEpoch: 100}, current); err == nil {
+		t.Error("expected older build to be rejected")
+	}
+}
+
+func TestNewMmdbReader_RejectsWrongDatabaseType(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	_, err := NewMmdbReader(testMMDBPath, WithDatabaseTypes(ASNDatabaseTypes...))
+	if err == nil {
+		t.Fatal("expected error for Country database when ASN types are required")
+	}
+	if !strings.Contains(err.Error(), "GeoLite2-Country") {
+		t.Errorf("expected error to name the database type, got %v", err)
+	}
+}
+
+func TestNewMmdbReader_RejectsFailedProbe(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	_, err := NewMmdbReader(testMMDBPath, WithProbes(Probe{IP: net.ParseIP("2.125.160.216"), Country: "US"}))
+	if err == nil {
+		t.Fatal("expected error for failing probe")
+	}
+}
+
+func TestMmdbReader_Ready(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	reader, err := NewMmdbReader(testMMDBPath, WithProbes(Probe{IP: net.ParseIP("2.125.160.216"), Country: "GB"}))
+	if err != nil {
+		t.Fatalf("failed to open MMDB: %v", err)
+	}
+
+	if err := reader.Ready(); err != nil {
+		t.Errorf("expected reader to be ready, got %v", err)
+	}
+
+	reader.Close()
+	if err := reader.Ready(); err == nil {
+		t.Error("expected closed reader not to be ready")
+	}
+}
+
+func TestMmdbReader_ReadyWithoutProbes(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	reader, err := NewMmdbReader(testMMDBPath)
+	if err != nil {
+		t.Fatalf("failed to open MMDB: %v", err)
+	}
+	defer reader.Close()
+
+	if err := reader.Ready(); err != nil {
+		t.Errorf("expected reader to be ready, got %v", err)
+	}
+
+	// A database that no longer decodes fails readiness.
+	db, err := reader.acquire()
+	if err != nil {
+		t.Fatalf("failed to acquire database: %v", err)
+	}
+	db.reader.Close()
+	reader.releaseDB(db)
+	if err := reader.Ready(); err == nil {
+		t.Error("expected an unreadable database not to be ready")
+	}
+}
+
+func TestValidateMmdbFile(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	probe := WithProbes(Probe{IP: net.ParseIP("2.125.160.216"), Country: "GB"})
+	if err := ValidateMmdbFile(testMMDBPath, testMMDBPath, probe, WithRejectOlderBuilds(true)); err != nil {
+		t.Errorf("expected the database to be valid, got %v", err)
+	}
+	if err := ValidateMmdbFile(testMMDBPath, testNextMMDBPath, WithRejectOlderBuilds(true)); err == nil {
+		t.Error("expected a build older than the current file to be rejected")
+	}
+	if err := ValidateMmdbFile(testMMDBPath, "", WithDatabaseTypes("GeoLite2-ASN")); err == nil {
+		t.Error("expected the wrong database type to be rejected")
+	}
+	if err := ValidateMmdbFile(testMMDBPath, "", WithProbes(Probe{IP: net.ParseIP("2.125.160.216"), Country: "US"})); err == nil {
+		t.Error("expected the failed probe to be rejected")
+	}
+
+	junk := filepath.Join(t.TempDir(), "junk.mmdb")
+	if err := os.WriteFile(junk, []byte("not an mmdb"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := ValidateMmdbFile(junk, ""); err == nil {
+		t.Error("expected an unreadable file to be rejected")
+	}
+}
+
+func TestReload_RejectsInvalidCandidate(t *testing.T) {
+	skipIfNoMMDB(t)
+
+	tmpFile := copyToTemp(t, testMMDBPath)
+	reader, err := NewMmdbReader(tmpFile, WithDatabaseTypes("GeoLite2-Country"))
+	if err != nil {
+		t.Fatalf("failed to open MMDB: %v", err)
+	}
+	defer reader.Close()
+
+	replaceFile(t, testNextMMDBPath, tmpFile)
+	if err := reader.reload(); err == nil {
+		t.Fatal("expected reload to reject City database")
+	}
+
+	// The Country database must still be serving lookups.
+	result, err := reader.Lookup(net.ParseIP("2.125.160.216"))
+	if err != nil {
+		t.Fatalf("lookup after rejected reload failed: %v", err)
+	}
+	if result.Country != "GB" {
+		t.Errorf("expected Country database to remain loaded, got country %q", result.Country)
+	}
+}
@@ -0,0 +1,228 @@
+package data
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadable is a data source loaded from a single file, kept up to date by
+// a fileWatch.
+type reloadable interface {
+	// reload loads the file again and swaps it in if it is valid.
+	reload() error
+	// loadedState returns the on-disk state of the loaded file.
+	loadedState() fileState
+}
+
+// reloadListeners holds the callbacks registered through OnReload.
+type reloadListeners struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// add registers fn.
+func (l *reloadListeners) add(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fns = append(l.fns, fn)
+}
+
+// notify calls every registered callback.
+func (l *reloadListeners) notify() {
+	l.mu.Lock()
+	fns := l.fns
+	l.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// fileWatch reloads a reloadable source when its file changes, using an
+// fsnotify watcher, a poller, or both depending on the WatchMode. A watch
+// of a directory reloads when any file in it changes.
+type fileWatch struct {
+	name   string // what is watched, e.g. "mmdb file", prefixing the log messages
+	path   string
+	dir    bool // path is a directory; see statDir
+	source reloadable
+	done   chan struct{} // signals the watcher and poller goroutines to stop
+}
+
+// newFileWatch returns a fileWatch for source, loaded from path, that logs
+// as name. Call start to begin watching.
+func newFileWatch(name, path string, source reloadable) *fileWatch {
+	return &fileWatch{name: name, path: path, source: source, done: make(chan struct{})}
+}
+
+// start launches the watcher and/or poller selected by mode.
+func (w *fileWatch) start(mode WatchMode, pollInterval time.Duration) {
+	switch mode {
+	case WatchPoll:
+		w.startPoller(pollInterval)
+	case WatchBoth:
+		if err := w.startWatcher(); err != nil {
+			slog.Warn(w.name+" watcher not started; relying on poller", "path", w.path, "error", err)
+		}
+		w.startPoller(pollInterval)
+	case WatchNone:
+	default:
+		if err := w.startWatcher(); err != nil {
+			// Watcher failure is non-fatal: fall back to polling the file.
+			slog.Warn(w.name+" watcher not started; falling back to polling", "path", w.path, "error", err)
+			w.startPoller(pollInterval)
+		}
+	}
+}
+
+// stop stops the watcher and poller goroutines.
+func (w *fileWatch) stop() {
+	close(w.done)
+}
+
+// startWatcher sets up an fsnotify watcher on the parent directory of the MMDB
+// file and spawns a goroutine that reloads the database when the file is
+// written or created. Watching the directory (not the file) correctly handles
+// both in-place writes and atomic rename-into-place strategies used by tools
+// like geoipupdate and Kubernetes volume mounts.
+//
+// NOTE: On macOS with Docker Desktop, host-side file changes on bind mounts are
+// proxied through gRPC-FUSE / VirtioFS and do NOT reliably generate inotify
+// events inside the container. This means the watcher will not fire when you
+// edit files on the host. It works correctly on native Linux (production).
+// A polling fallback (startPoller) covers this gap: select WatchPoll or
+// WatchBoth for such mounts.
+// To simulate file changes in development on macOS,
+// use docker cp to copy the updated MMDB file into the container, which triggers events correctly:
+//
+//	docker compose cp ./testdata/GeoLite2-Country-Test.mmdb geofence:/data/GeoLite2-Country-Test.mmdb
+//
+// You will need to change the volume mount in docker-compose.yaml to a read-write mount for this to work.
+func (w *fileWatch) startWatcher() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	dir := filepath.Dir(w.path)
+	if w.dir {
+		dir = w.path
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch directory: %w", err)
+	}
+
+	base := filepath.Base(w.path)
+	slog.Info(w.name+" watcher started", "path", w.path, "watching_dir", dir)
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-w.done:
+				return
+			case event, ok := <-watcher.Events:
+
+				slog.Info(w.name+" change detected", "event", event.Op.String(), "path", event.Name)
+
+				if !ok {
+					slog.Error(w.name+" watcher event channel closed")
+					return
+				}
+				// Only react to events on our specific file.
+				if !w.dir && filepath.Base(event.Name) != base {
+					continue
+				}
+				// Reload on write or create (covers both in-place updates
+				// and atomic rename-into-place strategies). In a directory,
+				// removing a file changes the content too.
+				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) ||
+					(w.dir && (event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename))) {
+					slog.Info(w.name+" change detected", "event", event.Op.String(), "path", event.Name)
+					if err := w.source.reload(); err != nil {
+						slog.Error(w.name+" hot-reload failed", "error", err)
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error(w.name+" watcher error", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// DirWatch keeps a source outside this package, such as the policy store,
+// up to date with the files of a directory.
+type DirWatch struct {
+	path   string
+	reload func() error
+	watch  *fileWatch
+
+	mu    sync.Mutex
+	state fileState // state of the directory when reload last succeeded
+}
+
+// WatchDir calls reload whenever a file in the directory at path is
+// written, created, removed or renamed, detecting changes as configured by
+// opts (see WithWatchMode and WithPollInterval). The watcher and poller log
+// as name, e.g. "policy directory". The caller loads the directory before
+// watching it; reload runs on the watcher and poller goroutines. Stop the
+// watch with Close.
+func WatchDir(name, path string, reload func() error, opts ...Option) (*DirWatch, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	state, err := statDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DirWatch{path: path, reload: reload, state: state}
+	d.watch = newFileWatch(name, path, dirSource{d})
+	d.watch.dir = true
+	d.watch.start(o.watchMode, o.pollInterval)
+	return d, nil
+}
+
+// Close stops the watcher and poller.
+func (d *DirWatch) Close() error {
+	d.watch.stop()
+	return nil
+}
+
+// dirSource adapts a DirWatch to the reloadable interface of fileWatch.
+type dirSource struct {
+	d *DirWatch
+}
+
+func (s dirSource) reload() error {
+	// Take the state first: a change racing the reload is picked up by the
+	// next poll instead of being recorded as loaded.
+	state, err := statDir(s.d.path)
+	if err != nil {
+		return err
+	}
+	if err := s.d.reload(); err != nil {
+		return err
+	}
+	s.d.mu.Lock()
+	s.d.state = state
+	s.d.mu.Unlock()
+	return nil
+}
+
+func (s dirSource) loadedState() fileState {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return s.d.state
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"net/http"
+
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/gin-gonic/gin"
+)
+
+// StatsResponse represents the JSON response describing the lookup cache.
+type StatsResponse struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+	Size     int     `json:"size"`
+	Capacity int     `json:"capacity"`
+}
+
+// Handler manages lookup cache endpoints.
+type Handler struct {
+	statsFn func() data.CacheStats
+}
+
+// NewHandler creates a new cache handler reporting the stats returned by
+// statsFn.
+func NewHandler(statsFn func() data.CacheStats) *Handler {
+	return &Handler{statsFn: statsFn}
+}
+
+// Get handles GET /api/v1/cache
+func (h *Handler) Get(c *gin.Context) {
+	stats := h.statsFn()
+	resp := StatsResponse{
+		Hits:     stats.Hits,
+		Misses:   stats.Misses,
+		Size:     stats.Size,
+		Capacity: stats.Capacity,
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		resp.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/gin-gonic/gin"
+)
+
+func setupRouter(stats data.CacheStats) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewHandler(func() data.CacheStats { return stats })
+	r.GET("/api/v1/cache", h.Get)
+	return r
+}
+
+func TestGet(t *testing.T) {
+	router := setupRouter(data.CacheStats{Hits: 3, Misses: 1, Size: 1, Capacity: 10000})
+
+	req, _ := http.NewRequest("GET", "/api/v1/cache", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp StatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	want := StatsResponse{Hits: 3, Misses: 1, HitRatio: 0.75, Size: 1, Capacity: 10000}
+	if resp != want {
+		t.Errorf("expected %+v, got %+v", want, resp)
+	}
+}
+
+func TestGet_Empty(t *testing.T) {
+	router := setupRouter(data.CacheStats{Capacity: 10000})
+
+	req, _ := http.NewRequest("GET", "/api/v1/cache", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp StatsResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.HitRatio != 0 {
+		t.Errorf("expected hit ratio 0 without lookups, got %v", resp.HitRatio)
+	}
+}
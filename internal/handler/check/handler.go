@@ -1,35 +1,100 @@
 package check
 
 import (
+	"errors"
 	"log/slog"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/TomasB/geofence/internal/data"
+	"github.com/TomasB/geofence/internal/policy"
 	"github.com/gin-gonic/gin"
 )
 
 // CheckRequest represents the JSON body for a country check.
 type CheckRequest struct {
-	IP               string   `json:"ip" binding:"required"`
-	AllowedCountries []string `json:"allowed_countries" binding:"required,min=1"`
+	IP                   string            `json:"ip" binding:"required"`
+	PolicyID             string            `json:"policy_id"`
+	AllowedCountries     []string          `json:"allowed_countries"`
+	BlockedCountries     []string          `json:"blocked_countries"`
+	AllowedSubdivisions  []string          `json:"allowed_subdivisions"`
+	BlockedSubdivisions  []string          `json:"blocked_subdivisions"`
+	AllowedCities        []string          `json:"allowed_cities"`
+	BlockedCities        []string          `json:"blocked_cities"`
+	AllowedASNs          []uint32          `json:"allowed_asns"`
+	BlockedASNs          []uint32          `json:"blocked_asns"`
+	DenyAnonymous        bool              `json:"deny_anonymous"`
+	DenyVPN              bool              `json:"deny_vpn"`
+	DenyTorExitNode      bool              `json:"deny_tor_exit_node"`
+	DenyHostingProvider  bool              `json:"deny_hosting_provider"`
+	DenyPublicProxy      bool              `json:"deny_public_proxy"`
+	DenyResidentialProxy bool              `json:"deny_residential_proxy"`
+	RequireUnanimous     bool              `json:"require_unanimous"`
+	Expression           string            `json:"expression"`
+	Attributes           map[string]string `json:"attributes"`
 }
 
 // CheckResponse represents the JSON response for a country check.
 type CheckResponse struct {
-	Allowed bool   `json:"allowed"`
-	Country string `json:"country"`
-	Error   string `json:"error"`
+	Allowed             bool               `json:"allowed"`
+	Reason              string             `json:"reason,omitempty"`
+	Country             string             `json:"country"`
+	Error               string             `json:"error"`
+	Continent           string             `json:"continent,omitempty"`
+	RegisteredCountry   string             `json:"registered_country,omitempty"`
+	RepresentedCountry  string             `json:"represented_country,omitempty"`
+	IsInEuropeanUnion   bool               `json:"is_in_european_union,omitempty"`
+	IsAnonymousProxy    bool               `json:"is_anonymous_proxy,omitempty"`
+	IsSatelliteProvider bool               `json:"is_satellite_provider,omitempty"`
+	Network             string             `json:"network,omitempty"`
+	Subdivision         string             `json:"subdivision,omitempty"`
+	City                string             `json:"city,omitempty"`
+	ASN                 uint32             `json:"asn,omitempty"`
+	ASOrganization      string             `json:"as_organization,omitempty"`
+	IsAnonymous         bool               `json:"is_anonymous,omitempty"`
+	IsVPN               bool               `json:"is_vpn,omitempty"`
+	IsHostingProvider   bool               `json:"is_hosting_provider,omitempty"`
+	IsPublicProxy       bool               `json:"is_public_proxy,omitempty"`
+	IsResidentialProxy  bool               `json:"is_residential_proxy,omitempty"`
+	IsTorExitNode       bool               `json:"is_tor_exit_node,omitempty"`
+	DatabaseVersion     string             `json:"database_version,omitempty"`
+	Source              string             `json:"source,omitempty"`
+	Override            *OverrideResponse  `json:"override,omitempty"`
+	Consensus           *ConsensusResponse `json:"consensus,omitempty"`
+	AddressClass        string             `json:"address_class,omitempty"`
+	Translation         string             `json:"translation,omitempty"`
+	EmbeddedIP          string             `json:"embedded_ip,omitempty"`
+	PolicyID            string             `json:"policy_id,omitempty"`
+	PolicyVersion       string             `json:"policy_version,omitempty"`
+	InvalidCountries    []string           `json:"invalid_countries,omitempty"`
+}
+
+// ConsensusResponse describes how the sources of a consensus lookup voted.
+type ConsensusResponse struct {
+	Agreement float64           `json:"agreement"`
+	Votes     map[string]string `json:"votes"`
+	Failed    []string          `json:"failed,omitempty"`
+}
+
+// OverrideResponse describes the override rule that set the country.
+type OverrideResponse struct {
+	Network   string     `json:"network"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // Handler manages IP geolocation check endpoints.
 type Handler struct {
-	lookup data.CountryLookup
+	lookup   data.CountryLookup
+	resolver *policy.Resolver
 }
 
-// NewHandler creates a new check handler with the given CountryLookup.
-func NewHandler(lookup data.CountryLookup) *Handler {
-	return &Handler{lookup: lookup}
+// NewHandler creates a new check handler with the given CountryLookup and
+// the Resolver for policy_id and country groups, which may be nil if
+// neither is configured.
+func NewHandler(lookup data.CountryLookup, resolver *policy.Resolver) *Handler {
+	return &Handler{lookup: lookup, resolver: resolver}
 }
 
 // Check handles POST /api/v1/check
@@ -42,7 +107,53 @@ func (h *Handler) Check(c *gin.Context) {
 		return
 	}
 
-	slog.Debug("check request received", "ip", req.IP, "allowed_countries", req.AllowedCountries)
+	slog.Debug("check request received", "ip", req.IP, "policy_id", req.PolicyID,
+		"allowed_countries", req.AllowedCountries, "blocked_countries", req.BlockedCountries)
+
+	var expr *policy.Expression
+	if req.Expression != "" {
+		var err error
+		if expr, err = h.resolver.Expression(req.Expression); err != nil {
+			c.JSON(http.StatusBadRequest, CheckResponse{
+				Error: "invalid request: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	rules, p, err := h.resolver.Resolve(req.PolicyID, policy.Rules{
+		AllowedCountries:     req.AllowedCountries,
+		BlockedCountries:     req.BlockedCountries,
+		AllowedSubdivisions:  req.AllowedSubdivisions,
+		BlockedSubdivisions:  req.BlockedSubdivisions,
+		AllowedCities:        req.AllowedCities,
+		BlockedCities:        req.BlockedCities,
+		AllowedASNs:          req.AllowedASNs,
+		BlockedASNs:          req.BlockedASNs,
+		DenyAnonymous:        req.DenyAnonymous,
+		DenyVPN:              req.DenyVPN,
+		DenyTorExitNode:      req.DenyTorExitNode,
+		DenyHostingProvider:  req.DenyHostingProvider,
+		DenyPublicProxy:      req.DenyPublicProxy,
+		DenyResidentialProxy: req.DenyResidentialProxy,
+		RequireUnanimous:     req.RequireUnanimous,
+		Expression:           expr,
+	})
+	if errors.Is(err, policy.ErrUnknownPolicy) {
+		c.JSON(http.StatusNotFound, CheckResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		resp := CheckResponse{Error: "invalid request: " + err.Error()}
+		var unknown *policy.UnknownCountriesError
+		if errors.As(err, &unknown) {
+			resp.InvalidCountries = unknown.Entries
+		}
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
 
 	ip := net.ParseIP(req.IP)
 	if ip == nil {
@@ -52,7 +163,7 @@ func (h *Handler) Check(c *gin.Context) {
 		return
 	}
 
-	country, err := h.lookup.LookupCountry(ip)
+	result, err := h.lookup.Lookup(ip)
 	if err != nil {
 		slog.Error("country lookup failed", "ip", req.IP, "error", err)
 		c.JSON(http.StatusInternalServerError, CheckResponse{
@@ -61,16 +172,70 @@ func (h *Handler) Check(c *gin.Context) {
 		return
 	}
 
-	allowed := false
-	for _, ac := range req.AllowedCountries {
-		if ac == country {
-			allowed = true
-			break
-		}
+	decision := policy.Evaluate(rules, result, req.Attributes)
+	if errors.Is(decision.Err, policy.ErrMissingAttribute) {
+		c.JSON(http.StatusBadRequest, CheckResponse{
+			Error: "invalid request: " + decision.Err.Error(),
+		})
+		return
+	}
+	if decision.Err != nil {
+		slog.Error("expression evaluation failed", "ip", req.IP, "error", decision.Err)
+		c.JSON(http.StatusInternalServerError, CheckResponse{
+			Error: decision.Err.Error(),
+		})
+		return
 	}
 
-	c.JSON(http.StatusOK, CheckResponse{
-		Allowed: allowed,
-		Country: country,
-	})
+	resp := newCheckResponse(result)
+	resp.Allowed = decision.Allowed
+	resp.Subdivision = decision.Subdivision
+	resp.Reason = string(decision.Reason)
+	if p != nil {
+		resp.PolicyID = p.ID
+		resp.PolicyVersion = p.Version
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// newCheckResponse copies the lookup attributes into a CheckResponse.
+func newCheckResponse(result *data.LookupResult) CheckResponse {
+	resp := CheckResponse{
+		Country:             result.Country,
+		Continent:           result.Continent,
+		RegisteredCountry:   result.RegisteredCountry,
+		RepresentedCountry:  result.RepresentedCountry,
+		IsInEuropeanUnion:   result.IsInEuropeanUnion,
+		IsAnonymousProxy:    result.IsAnonymousProxy,
+		IsSatelliteProvider: result.IsSatelliteProvider,
+		City:                result.City,
+		ASN:                 result.ASN,
+		ASOrganization:      result.ASOrganization,
+		IsAnonymous:         result.Anonymous.IsAnonymous,
+		IsVPN:               result.Anonymous.IsAnonymousVPN,
+		IsHostingProvider:   result.Anonymous.IsHostingProvider,
+		IsPublicProxy:       result.Anonymous.IsPublicProxy,
+		IsResidentialProxy:  result.Anonymous.IsResidentialProxy,
+		IsTorExitNode:       result.Anonymous.IsTorExitNode,
+		DatabaseVersion:     result.DatabaseVersion,
+		Source:              result.Source,
+		AddressClass:        string(result.AddressClass),
+		Translation:         string(result.Translation),
+	}
+	if result.Network != nil {
+		resp.Network = result.Network.String()
+	}
+	if result.EmbeddedIP != nil {
+		resp.EmbeddedIP = result.EmbeddedIP.String()
+	}
+	if cons := result.Consensus; cons != nil {
+		resp.Consensus = &ConsensusResponse{Agreement: cons.Agreement, Votes: cons.Votes, Failed: cons.Failed}
+	}
+	if o := result.Override; o != nil {
+		resp.Override = &OverrideResponse{Network: o.Network.String(), Reason: o.Reason}
+		if !o.ExpiresAt.IsZero() {
+			resp.Override.ExpiresAt = &o.ExpiresAt
+		}
+	}
+	return resp
 }
@@ -3,16 +3,51 @@ package check
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/TomasB/geofence/internal/data"
+	"github.com/TomasB/geofence/internal/mmdb"
 	"github.com/gin-gonic/gin"
 )
 
-const testMMDBPath = "../../../testdata/GeoLite2-Country-Test.mmdb"
+const testFixturePath = "../../../testdata/GeoLite2-Country-Test.json"
+
+// testMMDBPath is the MaxMind test database, or a database compiled from
+// testFixturePath by TestMain when it has not been downloaded.
+var testMMDBPath = "../../../testdata/GeoLite2-Country-Test.mmdb"
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	if _, err := os.Stat(testMMDBPath); os.IsNotExist(err) {
+		dir, err := os.MkdirTemp("", "geofence-testdata-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create fixture directory: %v\n", err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		records, err := mmdb.ReadFile(testFixturePath, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read test fixture: %v\n", err)
+			return 1
+		}
+		path := filepath.Join(dir, filepath.Base(testMMDBPath))
+		if _, err := mmdb.WriteFile(path, records, mmdb.Metadata{DatabaseType: "GeoLite2-Country"}); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compile test MMDB: %v\n", err)
+			return 1
+		}
+		testMMDBPath = path
+	}
+	return m.Run()
+}
 
 func skipIfNoMMDB(t *testing.T) {
 	t.Helper()
@@ -33,7 +68,7 @@ func setupIntegrationRouter(t *testing.T) *gin.Engine {
 	t.Cleanup(func() { reader.Close() })
 
 	r := gin.New()
-	h := NewHandler(reader)
+	h := NewHandler(reader, nil)
 	r.POST("/api/v1/check", h.Check)
 	return r
 }
@@ -7,14 +7,23 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/TomasB/geofence/internal/policy"
 	"github.com/gin-gonic/gin"
 )
 
 // mockLookup implements data.CountryLookup for testing.
 type mockLookup struct {
 	country string
+	result  *data.LookupResult
 	err     error
 }
 
@@ -22,6 +31,16 @@ func (m *mockLookup) LookupCountry(_ net.IP) (string, error) {
 	return m.country, m.err
 }
 
+func (m *mockLookup) Lookup(_ net.IP) (*data.LookupResult, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.result != nil {
+		return m.result, nil
+	}
+	return &data.LookupResult{Country: m.country}, nil
+}
+
 func (m *mockLookup) Close() error {
 	return nil
 }
@@ -29,7 +48,7 @@ func (m *mockLookup) Close() error {
 func setupRouter(lookup *mockLookup) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	h := NewHandler(lookup)
+	h := NewHandler(lookup, nil)
 	r.POST("/api/v1/check", h.Check)
 	return r
 }
@@ -237,3 +256,692 @@ func TestCheck_IPv6(t *testing.T) {
 		t.Errorf("expected country DE, got %s", resp.Country)
 	}
 }
+
+func TestCheck_LookupAttributes(t *testing.T) {
+	_, network, _ := net.ParseCIDR("67.43.156.0/24")
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		Country:             "DE",
+		Continent:           "EU",
+		RegisteredCountry:   "RO",
+		RepresentedCountry:  "US",
+		IsInEuropeanUnion:   true,
+		IsAnonymousProxy:    true,
+		IsSatelliteProvider: true,
+		Network:             network,
+		DatabaseVersion:     "GeoLite2-Country/1704728164/6f5e4490f425",
+		Source:              "GeoLite2-Country.mmdb",
+	}})
+
+	body, _ := json.Marshal(CheckRequest{
+		IP:               "67.43.156.1",
+		AllowedCountries: []string{"DE"},
+	})
+
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	want := CheckResponse{
+		Allowed:             true,
+		Reason:              "allow_match",
+		Country:             "DE",
+		Continent:           "EU",
+		RegisteredCountry:   "RO",
+		RepresentedCountry:  "US",
+		IsInEuropeanUnion:   true,
+		IsAnonymousProxy:    true,
+		IsSatelliteProvider: true,
+		Network:             "67.43.156.0/24",
+		DatabaseVersion:     "GeoLite2-Country/1704728164/6f5e4490f425",
+		Source:              "GeoLite2-Country.mmdb",
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("expected %+v, got %+v", want, resp)
+	}
+}
+
+func TestCheck_BlockedSubdivision(t *testing.T) {
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		Country:      "UA",
+		Subdivisions: []string{"UA-43"},
+		City:         "Sevastopol",
+	}})
+
+	body, _ := json.Marshal(CheckRequest{
+		IP:                  "1.2.3.4",
+		AllowedCountries:    []string{"UA"},
+		BlockedSubdivisions: []string{"UA-43"},
+	})
+
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if resp.Allowed {
+		t.Error("expected allowed to be false for blocked subdivision")
+	}
+	if resp.Subdivision != "UA-43" {
+		t.Errorf("expected subdivision UA-43, got %s", resp.Subdivision)
+	}
+	if resp.City != "Sevastopol" {
+		t.Errorf("expected city Sevastopol, got %s", resp.City)
+	}
+}
+
+func TestCheck_BlockedASN(t *testing.T) {
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		Country:        "DE",
+		ASN:            24940,
+		ASOrganization: "Hetzner Online GmbH",
+	}})
+
+	body, _ := json.Marshal(CheckRequest{
+		IP:               "1.2.3.4",
+		AllowedCountries: []string{"DE"},
+		BlockedASNs:      []uint32{24940},
+	})
+
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if resp.Allowed {
+		t.Error("expected allowed to be false for blocked ASN")
+	}
+	if resp.ASN != 24940 {
+		t.Errorf("expected ASN 24940, got %d", resp.ASN)
+	}
+	if resp.ASOrganization != "Hetzner Online GmbH" {
+		t.Errorf("expected organization Hetzner Online GmbH, got %s", resp.ASOrganization)
+	}
+}
+
+func TestCheck_DenyVPN(t *testing.T) {
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		Country:   "DE",
+		Anonymous: data.AnonymousIP{IsAnonymous: true, IsAnonymousVPN: true},
+	}})
+
+	body, _ := json.Marshal(CheckRequest{
+		IP:               "1.2.3.4",
+		AllowedCountries: []string{"DE"},
+		DenyVPN:          true,
+	})
+
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if resp.Allowed {
+		t.Error("expected allowed to be false for VPN")
+	}
+	if !resp.IsAnonymous || !resp.IsVPN {
+		t.Errorf("expected anonymous VPN flags, got %+v", resp)
+	}
+	if resp.IsTorExitNode || resp.IsHostingProvider {
+		t.Errorf("expected Tor and hosting flags to be false, got %+v", resp)
+	}
+}
+
+func TestCheck_Override(t *testing.T) {
+	_, network, _ := net.ParseCIDR("81.2.69.0/24")
+	expiresAt := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		Country: "DE",
+		Network: network,
+		Override: &data.Override{
+			Network:   network,
+			Country:   "DE",
+			Reason:    "Frankfurt VPN egress",
+			ExpiresAt: expiresAt,
+		},
+	}})
+
+	body, _ := json.Marshal(CheckRequest{
+		IP:               "81.2.69.1",
+		AllowedCountries: []string{"DE"},
+	})
+
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if !resp.Allowed {
+		t.Error("expected allowed to be true")
+	}
+	if resp.Override == nil {
+		t.Fatal("expected the override to be reported")
+	}
+	if resp.Override.Network != "81.2.69.0/24" || resp.Override.Reason != "Frankfurt VPN egress" {
+		t.Errorf("unexpected override %+v", resp.Override)
+	}
+	if resp.Override.ExpiresAt == nil || !resp.Override.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expected expires_at %v, got %v", expiresAt, resp.Override.ExpiresAt)
+	}
+}
+
+func TestCheck_RequireUnanimous(t *testing.T) {
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		Country: "US",
+		Source:  "GeoIP2-Country.mmdb",
+		Consensus: &data.Consensus{
+			Agreement: 2.0 / 3,
+			Votes:     map[string]string{"GeoIP2-Country.mmdb": "US", "dbip.csv": "US", "ip2location.csv": "CA"},
+		},
+	}})
+
+	for _, requireUnanimous := range []bool{false, true} {
+		body, _ := json.Marshal(CheckRequest{
+			IP:               "216.160.83.56",
+			AllowedCountries: []string{"US"},
+			RequireUnanimous: requireUnanimous,
+		})
+
+		req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var resp CheckResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+
+		if resp.Allowed == requireUnanimous {
+			t.Errorf("require_unanimous=%v: expected allowed=%v", requireUnanimous, !requireUnanimous)
+		}
+		if resp.Consensus == nil || resp.Consensus.Agreement != 2.0/3 || resp.Consensus.Votes["ip2location.csv"] != "CA" {
+			t.Errorf("unexpected consensus %+v", resp.Consensus)
+		}
+	}
+}
+
+func TestCheck_AddressClass(t *testing.T) {
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		AddressClass: data.ClassLoopback,
+		ClassAction:  data.ClassDeny,
+	}})
+
+	body, _ := json.Marshal(CheckRequest{
+		IP:               "127.0.0.1",
+		AllowedCountries: []string{"US"},
+	})
+
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if resp.Allowed {
+		t.Error("expected allowed to be false")
+	}
+	if resp.AddressClass != "loopback" {
+		t.Errorf("expected address_class loopback, got %q", resp.AddressClass)
+	}
+}
+
+func TestCheck_Translation(t *testing.T) {
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		Country:     "GB",
+		Network:     &net.IPNet{IP: net.IPv4(2, 125, 160, 216).To4(), Mask: net.CIDRMask(29, 32)},
+		Translation: data.TranslationTeredo,
+		EmbeddedIP:  net.ParseIP("2.125.160.216"),
+	}})
+
+	body, _ := json.Marshal(CheckRequest{
+		IP:               "2001:0:4136:e378:8000:63bf:fd82:5f27",
+		AllowedCountries: []string{"GB"},
+	})
+
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if !resp.Allowed {
+		t.Error("expected allowed to be true")
+	}
+	if resp.Translation != "teredo" || resp.EmbeddedIP != "2.125.160.216" {
+		t.Errorf("expected the Teredo translation of 2.125.160.216, got %q %q", resp.Translation, resp.EmbeddedIP)
+	}
+}
+
+func TestCheck_PolicyID(t *testing.T) {
+	dir := t.TempDir()
+	content := "version: \"2026-03-01\"\nallowed_countries: [US, CA]\n"
+	if err := os.WriteFile(filepath.Join(dir, "customers.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	store, err := policy.NewStore(dir, nil, data.WithWatchMode(data.WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create policy store: %v", err)
+	}
+	defer store.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/check", NewHandler(&mockLookup{country: "CA"}, policy.NewResolver(store, nil)).Check)
+
+	tests := []struct {
+		name   string
+		body   map[string]interface{}
+		status int
+		error  string
+	}{
+		{
+			name:   "policy",
+			body:   map[string]interface{}{"ip": "1.2.3.4", "policy_id": "customers"},
+			status: http.StatusOK,
+		},
+		{
+			name:   "unknown policy",
+			body:   map[string]interface{}{"ip": "1.2.3.4", "policy_id": "vendors"},
+			status: http.StatusNotFound,
+			error:  `unknown policy "vendors"`,
+		},
+		{
+			name:   "policy with inline rules",
+			body:   map[string]interface{}{"ip": "1.2.3.4", "policy_id": "customers", "deny_vpn": true},
+			status: http.StatusBadRequest,
+			error:  "invalid request: policy_id cannot be combined with inline rules",
+		},
+		{
+			name:   "neither",
+			body:   map[string]interface{}{"ip": "1.2.3.4"},
+			status: http.StatusBadRequest,
+			error:  "invalid request: at least one rule or policy_id is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			var resp CheckResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+
+			if resp.Error != tt.error {
+				t.Errorf("expected error %q, got %q", tt.error, resp.Error)
+			}
+			if tt.status == http.StatusOK && (!resp.Allowed || resp.PolicyID != "customers" || resp.PolicyVersion != "2026-03-01") {
+				t.Errorf("expected allowed by customers version 2026-03-01, got %+v", resp)
+			}
+		})
+	}
+}
+
+func TestCheck_BlockedCountries(t *testing.T) {
+	tests := []struct {
+		name    string
+		country string
+		req     CheckRequest
+		allowed bool
+		reason  string
+	}{
+		{
+			name:    "allow list match",
+			country: "US",
+			req:     CheckRequest{AllowedCountries: []string{"US"}},
+			allowed: true,
+			reason:  "allow_match",
+		},
+		{
+			name:    "allow list miss",
+			country: "RU",
+			req:     CheckRequest{AllowedCountries: []string{"US"}},
+			reason:  "default",
+		},
+		{
+			name:    "deny list match",
+			country: "KP",
+			req:     CheckRequest{BlockedCountries: []string{"KP", "IR"}},
+			reason:  "deny_match",
+		},
+		{
+			name:    "deny list miss",
+			country: "US",
+			req:     CheckRequest{BlockedCountries: []string{"KP", "IR"}},
+			allowed: true,
+			reason:  "default",
+		},
+		{
+			name:    "deny wins over allow",
+			country: "IR",
+			req:     CheckRequest{AllowedCountries: []string{"US", "IR"}, BlockedCountries: []string{"IR"}},
+			reason:  "deny_match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupRouter(&mockLookup{country: tt.country})
+			tt.req.IP = "1.2.3.4"
+			body, _ := json.Marshal(tt.req)
+
+			req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+
+			var resp CheckResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+
+			if resp.Allowed != tt.allowed || resp.Reason != tt.reason {
+				t.Errorf("expected allowed=%v reason %q, got allowed=%v reason %q", tt.allowed, tt.reason, resp.Allowed, resp.Reason)
+			}
+		})
+	}
+}
+
+func TestCheck_CountryGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	lookup := &mockLookup{result: &data.LookupResult{Country: "AT", Continent: "EU", IsInEuropeanUnion: true}}
+	resolver := policy.NewResolver(nil, policy.Groups{"DACH": {"DE", "AT", "CH"}})
+	router.POST("/api/v1/check", NewHandler(lookup, resolver).Check)
+
+	tests := []struct {
+		name    string
+		req     CheckRequest
+		allowed bool
+	}{
+		{"EU", CheckRequest{AllowedCountries: []string{"EU"}}, true},
+		{"continent", CheckRequest{AllowedCountries: []string{"CONTINENT:EU"}}, true},
+		{"custom group", CheckRequest{AllowedCountries: []string{"dach"}}, true},
+		{"blocked group", CheckRequest{AllowedCountries: []string{"EEA"}, BlockedCountries: []string{"DACH"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.IP = "1.2.3.4"
+			body, _ := json.Marshal(tt.req)
+			req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+			var resp CheckResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+
+			if resp.Allowed != tt.allowed {
+				t.Errorf("expected allowed=%v, got %v", tt.allowed, resp.Allowed)
+			}
+		})
+	}
+}
+
+func TestCheck_CountryCodes(t *testing.T) {
+	router := setupRouter(&mockLookup{country: "GB"})
+
+	body, _ := json.Marshal(CheckRequest{IP: "1.2.3.4", AllowedCountries: []string{"usa", " uk "}})
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !resp.Allowed {
+		t.Error("expected GB to be allowed through the UK alias")
+	}
+
+	body, _ = json.Marshal(CheckRequest{IP: "1.2.3.4", AllowedCountries: []string{"US", "USA1"}, BlockedCountries: []string{"XX"}})
+	req, _ = http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+	var errResp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	if want := `invalid request: unknown country codes: "USA1", "XX"`; errResp.Error != want {
+		t.Errorf("expected error %q, got %q", want, errResp.Error)
+	}
+	if want := []string{"USA1", "XX"}; !slices.Equal(errResp.InvalidCountries, want) {
+		t.Errorf("expected invalid countries %v, got %v", want, errResp.InvalidCountries)
+	}
+}
+
+func TestCheck_Expression(t *testing.T) {
+	router := setupRouter(&mockLookup{result: &data.LookupResult{Country: "US", ASN: 16509}})
+	expression := `country == "US" && (!(asn in [16509, 14061]) || attributes[?"tier"].orValue("") == "enterprise")`
+
+	tests := []struct {
+		name    string
+		req     CheckRequest
+		status  int
+		allowed bool
+		reason  string
+		error   string
+	}{
+		{
+			name:   "hosting ASN denied",
+			req:    CheckRequest{Expression: expression},
+			status: http.StatusOK,
+			reason: "deny_match",
+		},
+		{
+			name:    "allowed by attribute",
+			req:     CheckRequest{Expression: expression, Attributes: map[string]string{"tier": "enterprise"}},
+			status:  http.StatusOK,
+			allowed: true,
+			reason:  "allow_match",
+		},
+		{
+			name:   "missing attribute",
+			req:    CheckRequest{Expression: `attributes.tier == "enterprise"`},
+			status: http.StatusBadRequest,
+			error:  "invalid request: missing attribute: no such key: tier",
+		},
+		{
+			name:   "evaluation failure",
+			req:    CheckRequest{Expression: `asn * 9223372036854775807 > 0`},
+			status: http.StatusInternalServerError,
+			error:  "expression failed: integer overflow",
+		},
+		{
+			name:   "invalid expression",
+			req:    CheckRequest{Expression: `asn == "16509"`},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "oversize expression",
+			req:    CheckRequest{Expression: `country == "US"` + strings.Repeat(" ", policy.MaxExpressionLength)},
+			status: http.StatusBadRequest,
+			error:  fmt.Sprintf("invalid request: invalid expression: longer than %d bytes", policy.MaxExpressionLength),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.IP = "1.2.3.4"
+			body, _ := json.Marshal(tt.req)
+			req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			var resp CheckResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if tt.status == http.StatusBadRequest && tt.error == "" {
+				return
+			}
+
+			if resp.Allowed != tt.allowed || resp.Reason != tt.reason || resp.Error != tt.error {
+				t.Errorf("expected allowed=%v reason %q error %q, got allowed=%v reason %q error %q",
+					tt.allowed, tt.reason, tt.error, resp.Allowed, resp.Reason, resp.Error)
+			}
+		})
+	}
+}
+
+func TestCheck_UnknownCountryDenied(t *testing.T) {
+	router := setupRouter(&mockLookup{country: ""})
+
+	body, _ := json.Marshal(CheckRequest{IP: "1.2.3.4", BlockedCountries: []string{"RU"}})
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Allowed || resp.Reason != "default" {
+		t.Errorf("expected a default deny, got allowed=%v reason %q", resp.Allowed, resp.Reason)
+	}
+}
+
+func TestCheck_MissingDatabase(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	resolver := policy.NewResolver(nil, nil, policy.WithDatabases(false, false))
+	router.POST("/api/v1/check", NewHandler(&mockLookup{country: "US"}, resolver).Check)
+
+	body, _ := json.Marshal(CheckRequest{IP: "1.2.3.4", BlockedCountries: []string{"RU"}, DenyVPN: true})
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "deny_vpn need the Anonymous-IP database") {
+		t.Errorf("expected the missing database in the error, got %s", w.Body.String())
+	}
+}
+
+func TestCheck_DenyOnlyRules(t *testing.T) {
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		Country:   "US",
+		ASN:       16509,
+		Anonymous: data.AnonymousIP{IsAnonymousVPN: true},
+	}})
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"blocked ASNs only", map[string]interface{}{"ip": "1.2.3.4", "blocked_asns": []uint32{16509}}},
+		{"deny VPN only", map[string]interface{}{"ip": "1.2.3.4", "deny_vpn": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var resp CheckResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Allowed || resp.Reason != "deny_match" {
+				t.Errorf("expected a deny match, got allowed=%v reason %q", resp.Allowed, resp.Reason)
+			}
+		})
+	}
+}
+
+func TestCheck_ConsensusFailedSources(t *testing.T) {
+	router := setupRouter(&mockLookup{result: &data.LookupResult{
+		Country: "US",
+		Consensus: &data.Consensus{
+			Agreement: 2.0 / 3,
+			Votes:     map[string]string{"GeoIP2-Country.mmdb": "US", "dbip.csv": "US"},
+			Failed:    []string{"ip2location.csv"},
+		},
+	}})
+
+	body, _ := json.Marshal(CheckRequest{IP: "216.160.83.56", AllowedCountries: []string{"US"}})
+	req, _ := http.NewRequest("POST", "/api/v1/check", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp CheckResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Consensus == nil || !slices.Equal(resp.Consensus.Failed, []string{"ip2location.csv"}) {
+		t.Errorf("expected the failed source to be reported, got %+v", resp.Consensus)
+	}
+}
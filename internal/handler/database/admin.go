@@ -0,0 +1,93 @@
+package database
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/gin-gonic/gin"
+)
+
+// GenerationsResponse lists the current and retained database generations,
+// current first.
+type GenerationsResponse struct {
+	Generations []DatabaseResponse `json:"generations"`
+}
+
+// AdminHandler manages database administration endpoints. They change which
+// database generation is served and belong on the admin listener only.
+type AdminHandler struct {
+	generations data.GenerationManager
+}
+
+// NewAdminHandler creates a new admin handler with the given GenerationManager.
+func NewAdminHandler(generations data.GenerationManager) *AdminHandler {
+	return &AdminHandler{generations: generations}
+}
+
+// List handles GET /admin/v1/generations
+func (h *AdminHandler) List(c *gin.Context) {
+	generations, err := h.generations.Generations()
+	if err != nil {
+		slog.Error("database generations unavailable", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "database generations unavailable",
+		})
+		return
+	}
+
+	resp := GenerationsResponse{Generations: make([]DatabaseResponse, 0, len(generations))}
+	for i := range generations {
+		resp.Generations = append(resp.Generations, newDatabaseResponse(&generations[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revert handles POST /admin/v1/generations/:id/revert. The reverted
+// generation stays pinned until Unpin is called.
+func (h *AdminHandler) Revert(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid generation id",
+		})
+		return
+	}
+
+	if err := h.generations.Revert(id); err != nil {
+		if errors.Is(err, data.ErrGenerationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		slog.Error("database revert failed", "generation", id, "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "revert failed",
+		})
+		return
+	}
+
+	h.List(c)
+}
+
+// Pin handles POST /admin/v1/pin
+func (h *AdminHandler) Pin(c *gin.Context) {
+	h.generations.Pin()
+	h.List(c)
+}
+
+// Unpin handles POST /admin/v1/unpin. It reloads the database file on disk;
+// if that fails the current generation keeps serving and 500 is returned.
+func (h *AdminHandler) Unpin(c *gin.Context) {
+	if err := h.generations.Unpin(); err != nil {
+		slog.Error("database reload after unpin failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "reload failed: " + err.Error(),
+		})
+		return
+	}
+	h.List(c)
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/gin-gonic/gin"
+)
+
+// mockGenerations implements data.GenerationManager for testing.
+type mockGenerations struct {
+	generations []data.Metadata
+	pinned      bool
+	unpinErr    error
+}
+
+func (m *mockGenerations) Generations() ([]data.Metadata, error) {
+	out := append([]data.Metadata(nil), m.generations...)
+	out[0].Pinned = m.pinned
+	return out, nil
+}
+
+func (m *mockGenerations) Revert(id uint64) error {
+	for i, g := range m.generations {
+		if g.Generation == id {
+			m.generations[0], m.generations[i] = m.generations[i], m.generations[0]
+			m.pinned = true
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", data.ErrGenerationNotFound, id)
+}
+
+func (m *mockGenerations) Pin() {
+	m.pinned = true
+}
+
+func (m *mockGenerations) Unpin() error {
+	m.pinned = false
+	return m.unpinErr
+}
+
+func setupAdminRouter(generations *mockGenerations) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewAdminHandler(generations)
+	r.GET("/admin/v1/generations", h.List)
+	r.POST("/admin/v1/generations/:id/revert", h.Revert)
+	r.POST("/admin/v1/pin", h.Pin)
+	r.POST("/admin/v1/unpin", h.Unpin)
+	return r
+}
+
+func newMockGenerations() *mockGenerations {
+	return &mockGenerations{generations: []data.Metadata{
+		{Generation: 2, Version: "GeoLite2-Country/1704800000/bbbbbb"},
+		{Generation: 1, Version: "GeoLite2-Country/1704728164/aaaaaa"},
+	}}
+}
+
+func serveAdmin(t *testing.T, router *gin.Engine, method, path string) (int, GenerationsResponse) {
+	t.Helper()
+	req, _ := http.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp GenerationsResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestAdmin_List(t *testing.T) {
+	router := setupAdminRouter(newMockGenerations())
+
+	code, resp := serveAdmin(t, router, "GET", "/admin/v1/generations")
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if len(resp.Generations) != 2 || resp.Generations[0].Generation != 2 || resp.Generations[1].Generation != 1 {
+		t.Errorf("unexpected generations: %+v", resp.Generations)
+	}
+}
+
+func TestAdmin_Revert(t *testing.T) {
+	router := setupAdminRouter(newMockGenerations())
+
+	code, resp := serveAdmin(t, router, "POST", "/admin/v1/generations/1/revert")
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	current := resp.Generations[0]
+	if current.Generation != 1 || !current.Pinned {
+		t.Errorf("expected pinned generation 1, got %+v", current)
+	}
+}
+
+func TestAdmin_RevertErrors(t *testing.T) {
+	router := setupAdminRouter(newMockGenerations())
+
+	if code, _ := serveAdmin(t, router, "POST", "/admin/v1/generations/7/revert"); code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown generation, got %d", code)
+	}
+	if code, _ := serveAdmin(t, router, "POST", "/admin/v1/generations/latest/revert"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid id, got %d", code)
+	}
+}
+
+func TestAdmin_PinUnpin(t *testing.T) {
+	generations := newMockGenerations()
+	router := setupAdminRouter(generations)
+
+	code, resp := serveAdmin(t, router, "POST", "/admin/v1/pin")
+	if code != http.StatusOK || !resp.Generations[0].Pinned {
+		t.Fatalf("expected pinned current generation, got %d %+v", code, resp)
+	}
+
+	code, resp = serveAdmin(t, router, "POST", "/admin/v1/unpin")
+	if code != http.StatusOK || resp.Generations[0].Pinned {
+		t.Fatalf("expected unpinned current generation, got %d %+v", code, resp)
+	}
+
+	generations.unpinErr = errors.New("candidate MMDB rejected")
+	if code, _ := serveAdmin(t, router, "POST", "/admin/v1/unpin"); code != http.StatusInternalServerError {
+		t.Errorf("expected status 500 when reload fails, got %d", code)
+	}
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/gin-gonic/gin"
+)
+
+// DatabaseResponse represents the JSON response describing the loaded database.
+type DatabaseResponse struct {
+	Generation      uint64             `json:"generation"`
+	DatabaseType    string             `json:"database_type"`
+	BuildEpoch      uint               `json:"build_epoch"`
+	IPVersion       uint               `json:"ip_version"`
+	NodeCount       uint               `json:"node_count"`
+	Path            string             `json:"path"`
+	FileHash        string             `json:"file_hash"`
+	LoadedAt        time.Time          `json:"loaded_at"`
+	LastReloadError string             `json:"last_reload_error,omitempty"`
+	Pinned          bool               `json:"pinned,omitempty"`
+	Version         string             `json:"version"`
+	Source          string             `json:"source,omitempty"`
+	Sources         []DatabaseResponse `json:"sources,omitempty"`
+	Lookups         uint64             `json:"lookups,omitempty"`
+	Disagreements   uint64             `json:"disagreements,omitempty"`
+}
+
+// Handler manages database metadata endpoints.
+type Handler struct {
+	metadata data.MetadataProvider
+}
+
+// NewHandler creates a new database handler with the given MetadataProvider.
+// Without one, Get answers 501 Not Implemented.
+func NewHandler(metadata data.MetadataProvider) *Handler {
+	return &Handler{metadata: metadata}
+}
+
+// Get handles GET /api/v1/database
+func (h *Handler) Get(c *gin.Context) {
+	if h.metadata == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "database metadata not supported",
+		})
+		return
+	}
+	meta, err := h.metadata.Metadata()
+	if err != nil {
+		slog.Error("database metadata unavailable", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "database metadata unavailable",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, newDatabaseResponse(meta))
+}
+
+// newDatabaseResponse copies the database metadata into a DatabaseResponse.
+func newDatabaseResponse(meta *data.Metadata) DatabaseResponse {
+	resp := DatabaseResponse{
+		Generation:      meta.Generation,
+		DatabaseType:    meta.DatabaseType,
+		BuildEpoch:      meta.BuildEpoch,
+		IPVersion:       meta.IPVersion,
+		NodeCount:       meta.NodeCount,
+		Path:            meta.Path,
+		FileHash:        meta.FileHash,
+		LoadedAt:        meta.LoadedAt,
+		LastReloadError: meta.LastReloadError,
+		Pinned:          meta.Pinned,
+		Version:         meta.Version,
+		Source:          meta.Source,
+		Lookups:         meta.Lookups,
+		Disagreements:   meta.Disagreements,
+	}
+	for i := range meta.Sources {
+		resp.Sources = append(resp.Sources, newDatabaseResponse(&meta.Sources[i]))
+	}
+	return resp
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/gin-gonic/gin"
+)
+
+// mockMetadata implements data.MetadataProvider for testing.
+type mockMetadata struct {
+	meta *data.Metadata
+	err  error
+}
+
+func (m *mockMetadata) Metadata() (*data.Metadata, error) {
+	return m.meta, m.err
+}
+
+func setupRouter(metadata *mockMetadata) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewHandler(metadata)
+	r.GET("/api/v1/database", h.Get)
+	return r
+}
+
+func TestGet(t *testing.T) {
+	loadedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	router := setupRouter(&mockMetadata{meta: &data.Metadata{
+		Generation:      3,
+		Path:            "/data/GeoLite2-Country.mmdb",
+		DatabaseType:    "GeoLite2-Country",
+		BuildEpoch:      1704728164,
+		IPVersion:       6,
+		NodeCount:       1234,
+		FileHash:        "abc123",
+		LoadedAt:        loadedAt,
+		LastReloadError: "candidate MMDB rejected",
+		Pinned:          true,
+		Version:         "GeoLite2-Country/1704728164/abc123",
+	}})
+
+	req, _ := http.NewRequest("GET", "/api/v1/database", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp DatabaseResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	want := DatabaseResponse{
+		Generation:      3,
+		DatabaseType:    "GeoLite2-Country",
+		BuildEpoch:      1704728164,
+		IPVersion:       6,
+		NodeCount:       1234,
+		Path:            "/data/GeoLite2-Country.mmdb",
+		FileHash:        "abc123",
+		LoadedAt:        loadedAt,
+		LastReloadError: "candidate MMDB rejected",
+		Pinned:          true,
+		Version:         "GeoLite2-Country/1704728164/abc123",
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("expected %+v, got %+v", want, resp)
+	}
+}
+
+func TestGet_Sources(t *testing.T) {
+	loadedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	router := setupRouter(&mockMetadata{meta: &data.Metadata{
+		DatabaseType: data.CompositeDatabaseType,
+		LoadedAt:     loadedAt,
+		Version:      "CSV/1/aaa+GeoLite2-Country/1704728164/abc123",
+		Sources: []data.Metadata{
+			{Source: "corrections.csv", DatabaseType: "CSV", Version: "CSV/1/aaa", LoadedAt: loadedAt},
+			{Source: "GeoLite2-Country.mmdb", DatabaseType: "GeoLite2-Country", Version: "GeoLite2-Country/1704728164/abc123", LoadedAt: loadedAt},
+		},
+	}})
+
+	req, _ := http.NewRequest("GET", "/api/v1/database", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp DatabaseResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.DatabaseType != data.CompositeDatabaseType || len(resp.Sources) != 2 {
+		t.Fatalf("expected a composite with 2 sources, got %+v", resp)
+	}
+	if resp.Sources[0].Source != "corrections.csv" || resp.Sources[1].Source != "GeoLite2-Country.mmdb" {
+		t.Errorf("unexpected source order: %+v", resp.Sources)
+	}
+	if resp.Sources[1].Version != "GeoLite2-Country/1704728164/abc123" {
+		t.Errorf("unexpected source version %s", resp.Sources[1].Version)
+	}
+}
+
+func TestGet_Unavailable(t *testing.T) {
+	router := setupRouter(&mockMetadata{err: errors.New("mmdb reader is closed")})
+
+	req, _ := http.NewRequest("GET", "/api/v1/database", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", w.Code)
+	}
+}
+
+func TestGet_WithoutMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/database", NewHandler(nil).Get)
+
+	req, _ := http.NewRequest("GET", "/api/v1/database", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status 501, got %d", w.Code)
+	}
+}
@@ -2,10 +2,15 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"time"
 
 	"github.com/TomasB/geofence/internal/data"
+	"github.com/TomasB/geofence/internal/policy"
 	geofencev1 "github.com/TomasB/geofence/pkg/geofence/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -13,12 +18,17 @@ import (
 // Handler implements the gRPC GeofenceService.
 type Handler struct {
 	geofencev1.UnimplementedGeofenceServiceServer
-	lookup data.CountryLookup
+	lookup   data.CountryLookup
+	metadata data.MetadataProvider
+	resolver *policy.Resolver
 }
 
-// NewHandler creates a new gRPC handler with the given CountryLookup.
-func NewHandler(lookup data.CountryLookup) *Handler {
-	return &Handler{lookup: lookup}
+// NewHandler creates a new gRPC handler with the given CountryLookup, the
+// MetadataProvider describing its database and the Resolver for policy_id
+// and country groups, which may be nil if neither is configured. Without a
+// MetadataProvider GetDatabase answers Unimplemented.
+func NewHandler(lookup data.CountryLookup, metadata data.MetadataProvider, resolver *policy.Resolver) *Handler {
+	return &Handler{lookup: lookup, metadata: metadata, resolver: resolver}
 }
 
 // Check validates whether an IP is allowed for the given country list.
@@ -29,8 +39,36 @@ func (h *Handler) Check(_ context.Context, req *geofencev1.CheckRequest) (*geofe
 	if req.Ip == "" {
 		return nil, status.Error(codes.InvalidArgument, "ip is required")
 	}
-	if len(req.AllowedCountries) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "allowed_countries is required")
+	var expr *policy.Expression
+	if req.Expression != "" {
+		var err error
+		if expr, err = h.resolver.Expression(req.Expression); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	rules, p, err := h.resolver.Resolve(req.PolicyId, policy.Rules{
+		AllowedCountries:     req.AllowedCountries,
+		BlockedCountries:     req.BlockedCountries,
+		AllowedSubdivisions:  req.AllowedSubdivisions,
+		BlockedSubdivisions:  req.BlockedSubdivisions,
+		AllowedCities:        req.AllowedCities,
+		BlockedCities:        req.BlockedCities,
+		AllowedASNs:          req.AllowedAsns,
+		BlockedASNs:          req.BlockedAsns,
+		DenyAnonymous:        req.DenyAnonymous,
+		DenyVPN:              req.DenyVpn,
+		DenyTorExitNode:      req.DenyTorExitNode,
+		DenyHostingProvider:  req.DenyHostingProvider,
+		DenyPublicProxy:      req.DenyPublicProxy,
+		DenyResidentialProxy: req.DenyResidentialProxy,
+		RequireUnanimous:     req.RequireUnanimous,
+		Expression:           expr,
+	})
+	if errors.Is(err, policy.ErrUnknownPolicy) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, invalidRules(err)
 	}
 
 	ip := net.ParseIP(req.Ip)
@@ -38,25 +76,128 @@ func (h *Handler) Check(_ context.Context, req *geofencev1.CheckRequest) (*geofe
 		return nil, status.Error(codes.InvalidArgument, "invalid IP address")
 	}
 
-	country, err := h.lookup.LookupCountry(ip)
+	result, err := h.lookup.Lookup(ip)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "lookup failed")
 	}
-	if country == "" {
-		return nil, status.Error(codes.Internal, "lookup returned empty country")
+
+	decision := policy.Evaluate(rules, result, req.Attributes)
+	if errors.Is(decision.Err, policy.ErrMissingAttribute) {
+		return nil, status.Error(codes.InvalidArgument, decision.Err.Error())
+	}
+	if decision.Err != nil {
+		return nil, status.Error(codes.Internal, decision.Err.Error())
 	}
 
-	allowed := false
-	for _, ac := range req.AllowedCountries {
-		if ac == country {
-			allowed = true
-			break
-		}
+	resp := newCheckResponse(result)
+	resp.Allowed = decision.Allowed
+	resp.Subdivision = decision.Subdivision
+	resp.Reason = string(decision.Reason)
+	if p != nil {
+		resp.PolicyId = p.ID
+		resp.PolicyVersion = p.Version
 	}
+	return resp, nil
+}
 
-	return &geofencev1.CheckResponse{
-		Allowed: allowed,
-		Country: country,
-		Error:   "",
-	}, nil
+// invalidRules returns the InvalidArgument status for rules that failed to
+// resolve. Unknown country codes are attached as a BadRequest with one
+// field violation per entry.
+func invalidRules(err error) error {
+	st := status.New(codes.InvalidArgument, err.Error())
+	var unknown *policy.UnknownCountriesError
+	if !errors.As(err, &unknown) {
+		return st.Err()
+	}
+	br := &errdetails.BadRequest{}
+	for i, entry := range unknown.Entries {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       unknown.Fields[i],
+			Description: fmt.Sprintf("unknown country code %q", entry),
+		})
+	}
+	if withDetails, err := st.WithDetails(br); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// GetDatabase returns the metadata of the currently loaded database.
+func (h *Handler) GetDatabase(_ context.Context, _ *geofencev1.GetDatabaseRequest) (*geofencev1.GetDatabaseResponse, error) {
+	if h.metadata == nil {
+		return nil, status.Error(codes.Unimplemented, "database metadata not supported")
+	}
+	meta, err := h.metadata.Metadata()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, "database metadata unavailable")
+	}
+
+	return newGetDatabaseResponse(meta), nil
+}
+
+// newGetDatabaseResponse copies the database metadata into a
+// GetDatabaseResponse.
+func newGetDatabaseResponse(meta *data.Metadata) *geofencev1.GetDatabaseResponse {
+	resp := &geofencev1.GetDatabaseResponse{
+		DatabaseType:    meta.DatabaseType,
+		BuildEpoch:      uint64(meta.BuildEpoch),
+		IpVersion:       uint32(meta.IPVersion),
+		NodeCount:       uint64(meta.NodeCount),
+		Path:            meta.Path,
+		FileHash:        meta.FileHash,
+		LoadedAt:        meta.LoadedAt.Format(time.RFC3339),
+		LastReloadError: meta.LastReloadError,
+		Version:         meta.Version,
+		Generation:      meta.Generation,
+		Pinned:          meta.Pinned,
+		Source:          meta.Source,
+		Lookups:         meta.Lookups,
+		Disagreements:   meta.Disagreements,
+	}
+	for i := range meta.Sources {
+		resp.Sources = append(resp.Sources, newGetDatabaseResponse(&meta.Sources[i]))
+	}
+	return resp
+}
+
+// newCheckResponse copies the lookup attributes into a CheckResponse.
+func newCheckResponse(result *data.LookupResult) *geofencev1.CheckResponse {
+	resp := &geofencev1.CheckResponse{
+		Country:             result.Country,
+		Continent:           result.Continent,
+		RegisteredCountry:   result.RegisteredCountry,
+		RepresentedCountry:  result.RepresentedCountry,
+		IsInEuropeanUnion:   result.IsInEuropeanUnion,
+		IsAnonymousProxy:    result.IsAnonymousProxy,
+		IsSatelliteProvider: result.IsSatelliteProvider,
+		City:                result.City,
+		Asn:                 result.ASN,
+		AsOrganization:      result.ASOrganization,
+		IsAnonymous:         result.Anonymous.IsAnonymous,
+		IsVpn:               result.Anonymous.IsAnonymousVPN,
+		IsHostingProvider:   result.Anonymous.IsHostingProvider,
+		IsPublicProxy:       result.Anonymous.IsPublicProxy,
+		IsResidentialProxy:  result.Anonymous.IsResidentialProxy,
+		IsTorExitNode:       result.Anonymous.IsTorExitNode,
+		DatabaseVersion:     result.DatabaseVersion,
+		Source:              result.Source,
+		AddressClass:        string(result.AddressClass),
+		Translation:         string(result.Translation),
+	}
+	if result.Network != nil {
+		resp.Network = result.Network.String()
+	}
+	if result.EmbeddedIP != nil {
+		resp.EmbeddedIp = result.EmbeddedIP.String()
+	}
+	if cons := result.Consensus; cons != nil {
+		resp.Consensus = &geofencev1.Consensus{Agreement: cons.Agreement, Votes: cons.Votes, Failed: cons.Failed}
+	}
+	if o := result.Override; o != nil {
+		resp.Override = &geofencev1.Override{Network: o.Network.String(), Reason: o.Reason}
+		if !o.ExpiresAt.IsZero() {
+			resp.Override.ExpiresAt = o.ExpiresAt.Format(time.RFC3339)
+		}
+	}
+	return resp
 }
@@ -4,15 +4,24 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/TomasB/geofence/internal/policy"
 	geofencev1 "github.com/TomasB/geofence/pkg/geofence/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type mockLookup struct {
 	country string
+	result  *data.LookupResult
 	err     error
 }
 
@@ -20,12 +29,22 @@ func (m *mockLookup) LookupCountry(_ net.IP) (string, error) {
 	return m.country, m.err
 }
 
+func (m *mockLookup) Lookup(_ net.IP) (*data.LookupResult, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.result != nil {
+		return m.result, nil
+	}
+	return &data.LookupResult{Country: m.country}, nil
+}
+
 func (m *mockLookup) Close() error {
 	return nil
 }
 
 func TestCheckAllowed(t *testing.T) {
-	h := NewHandler(&mockLookup{country: "US"})
+	h := NewHandler(&mockLookup{country: "US"}, nil, nil)
 
 	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
 		Ip:               "1.2.3.4",
@@ -43,7 +62,7 @@ func TestCheckAllowed(t *testing.T) {
 }
 
 func TestCheckDenied(t *testing.T) {
-	h := NewHandler(&mockLookup{country: "RU"})
+	h := NewHandler(&mockLookup{country: "RU"}, nil, nil)
 
 	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
 		Ip:               "1.2.3.4",
@@ -61,7 +80,7 @@ func TestCheckDenied(t *testing.T) {
 }
 
 func TestCheckInvalidIP(t *testing.T) {
-	h := NewHandler(&mockLookup{country: "US"})
+	h := NewHandler(&mockLookup{country: "US"}, nil, nil)
 
 	_, err := h.Check(context.Background(), &geofencev1.CheckRequest{
 		Ip:               "not-an-ip",
@@ -71,7 +90,7 @@ func TestCheckInvalidIP(t *testing.T) {
 }
 
 func TestCheckMissingIP(t *testing.T) {
-	h := NewHandler(&mockLookup{country: "US"})
+	h := NewHandler(&mockLookup{country: "US"}, nil, nil)
 
 	_, err := h.Check(context.Background(), &geofencev1.CheckRequest{
 		AllowedCountries: []string{"US"},
@@ -80,7 +99,7 @@ func TestCheckMissingIP(t *testing.T) {
 }
 
 func TestCheckMissingAllowedCountries(t *testing.T) {
-	h := NewHandler(&mockLookup{country: "US"})
+	h := NewHandler(&mockLookup{country: "US"}, nil, nil)
 
 	_, err := h.Check(context.Background(), &geofencev1.CheckRequest{
 		Ip: "1.2.3.4",
@@ -88,15 +107,218 @@ func TestCheckMissingAllowedCountries(t *testing.T) {
 	assertCode(t, err, codes.InvalidArgument)
 }
 
+// newPolicyStore returns a Store holding a "customers" policy that allows
+// US and CA.
+func newPolicyStore(t *testing.T) *policy.Store {
+	t.Helper()
+	dir := t.TempDir()
+	content := "version: \"2026-03-01\"\nallowed_countries: [US, CA]\n"
+	if err := os.WriteFile(filepath.Join(dir, "customers.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	store, err := policy.NewStore(dir, nil, data.WithWatchMode(data.WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create policy store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestCheckPolicyID(t *testing.T) {
+	h := NewHandler(&mockLookup{country: "CA"}, nil, policy.NewResolver(newPolicyStore(t), nil))
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:       "1.2.3.4",
+		PolicyId: "customers",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Allowed {
+		t.Error("expected allowed to be true")
+	}
+	if resp.PolicyId != "customers" || resp.PolicyVersion != "2026-03-01" {
+		t.Errorf("expected customers version 2026-03-01, got %q version %q", resp.PolicyId, resp.PolicyVersion)
+	}
+}
+
+func TestCheckPolicyIDErrors(t *testing.T) {
+	h := NewHandler(&mockLookup{country: "CA"}, nil, policy.NewResolver(newPolicyStore(t), nil))
+
+	_, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:       "1.2.3.4",
+		PolicyId: "vendors",
+	})
+	assertCode(t, err, codes.NotFound)
+
+	_, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		PolicyId:         "customers",
+		AllowedCountries: []string{"CA"},
+	})
+	assertCode(t, err, codes.InvalidArgument)
+
+	// Without a store, no policy exists.
+	h = NewHandler(&mockLookup{country: "CA"}, nil, nil)
+	_, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:       "1.2.3.4",
+		PolicyId: "customers",
+	})
+	assertCode(t, err, codes.NotFound)
+}
+
+func TestCheckBlockedCountries(t *testing.T) {
+	h := NewHandler(&mockLookup{country: "IR"}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		BlockedCountries: []string{"KP", "IR"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Allowed || resp.Reason != "deny_match" {
+		t.Errorf("expected a deny match, got allowed=%v reason %q", resp.Allowed, resp.Reason)
+	}
+
+	h = NewHandler(&mockLookup{country: "US"}, nil, nil)
+	resp, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		BlockedCountries: []string{"KP", "IR"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Allowed || resp.Reason != "default" {
+		t.Errorf("expected allowed by default, got allowed=%v reason %q", resp.Allowed, resp.Reason)
+	}
+}
+
+func TestCheckCountryGroups(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{Country: "CH", Continent: "EU"}}, nil,
+		policy.NewResolver(nil, policy.Groups{"DACH": {"DE", "AT", "CH"}}))
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		AllowedCountries: []string{"EU", "DACH"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Allowed {
+		t.Error("expected CH to be allowed through DACH")
+	}
+
+	resp, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		AllowedCountries: []string{"EEA"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Allowed {
+		t.Error("expected CH to be outside the EEA")
+	}
+}
+
+func TestCheckCountryCodes(t *testing.T) {
+	h := NewHandler(&mockLookup{country: "BR"}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		AllowedCountries: []string{"bra"},
+		BlockedCountries: []string{"408"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Allowed {
+		t.Error("expected BR to be allowed through its alpha-3 code")
+	}
+
+	_, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		AllowedCountries: []string{"BR", "USA1"},
+		BlockedCountries: []string{"XX"},
+	})
+	assertCode(t, err, codes.InvalidArgument)
+	if want := `unknown country codes: "USA1", "XX"`; status.Convert(err).Message() != want {
+		t.Errorf("expected message %q, got %q", want, status.Convert(err).Message())
+	}
+
+	var violations []string
+	for _, detail := range status.Convert(err).Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				violations = append(violations, v.Field+": "+v.Description)
+			}
+		}
+	}
+	want := []string{`allowed_countries: unknown country code "USA1"`, `blocked_countries: unknown country code "XX"`}
+	if !slices.Equal(violations, want) {
+		t.Errorf("expected field violations %v, got %v", want, violations)
+	}
+}
+
+func TestCheckExpression(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{Country: "DE", Anonymous: data.AnonymousIP{IsAnonymousVPN: true}}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:         "1.2.3.4",
+		Expression: `country in ["DE", "AT"] && (!is_vpn || attributes[?"vpn"].orValue("") == "trusted")`,
+		Attributes: map[string]string{"vpn": "trusted"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Allowed || resp.Reason != "allow_match" {
+		t.Errorf("expected an allow match, got allowed=%v reason %q", resp.Allowed, resp.Reason)
+	}
+
+	resp, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:         "1.2.3.4",
+		Expression: `country in ["DE", "AT"] && !is_vpn`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Allowed || resp.Reason != "deny_match" {
+		t.Errorf("expected the VPN to be a deny match, got allowed=%v reason %q", resp.Allowed, resp.Reason)
+	}
+
+	_, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:         "1.2.3.4",
+		Expression: `country`,
+	})
+	assertCode(t, err, codes.InvalidArgument)
+	_, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:         "1.2.3.4",
+		Expression: strings.Repeat(" ", policy.MaxExpressionLength) + `country == "DE"`,
+	})
+	assertCode(t, err, codes.InvalidArgument)
+
+	// A missing attribute is the client's fault, a failed evaluation not.
+	_, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:         "1.2.3.4",
+		Expression: `attributes.tier == "gold"`,
+	})
+	assertCode(t, err, codes.InvalidArgument)
+	_, err = h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:         "1.2.3.4",
+		Expression: `size(country) * 9223372036854775807 > 0`,
+	})
+	assertCode(t, err, codes.Internal)
+}
+
 func TestCheckNilRequest(t *testing.T) {
-	h := NewHandler(&mockLookup{country: "US"})
+	h := NewHandler(&mockLookup{country: "US"}, nil, nil)
 
 	_, err := h.Check(context.Background(), nil)
 	assertCode(t, err, codes.InvalidArgument)
 }
 
 func TestCheckLookupError(t *testing.T) {
-	h := NewHandler(&mockLookup{err: fmt.Errorf("db failure")})
+	h := NewHandler(&mockLookup{err: fmt.Errorf("db failure")}, nil, nil)
 
 	_, err := h.Check(context.Background(), &geofencev1.CheckRequest{
 		Ip:               "1.2.3.4",
@@ -106,13 +328,301 @@ func TestCheckLookupError(t *testing.T) {
 }
 
 func TestCheckEmptyCountry(t *testing.T) {
-	h := NewHandler(&mockLookup{country: ""})
+	h := NewHandler(&mockLookup{country: ""}, nil, nil)
 
-	_, err := h.Check(context.Background(), &geofencev1.CheckRequest{
-		Ip:               "1.2.3.4",
+	// Unresolved IPs are denied like over REST, also by deny-only rules.
+	for _, req := range []*geofencev1.CheckRequest{
+		{Ip: "1.2.3.4", AllowedCountries: []string{"US"}},
+		{Ip: "1.2.3.4", BlockedCountries: []string{"RU"}},
+	} {
+		resp, err := h.Check(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Allowed || resp.Reason != "default" {
+			t.Errorf("expected a default deny, got allowed=%v reason %q", resp.Allowed, resp.Reason)
+		}
+	}
+}
+
+func TestCheckLookupAttributes(t *testing.T) {
+	_, network, _ := net.ParseCIDR("67.43.156.0/24")
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		Country:             "DE",
+		Continent:           "EU",
+		RegisteredCountry:   "RO",
+		RepresentedCountry:  "US",
+		IsInEuropeanUnion:   true,
+		IsAnonymousProxy:    true,
+		IsSatelliteProvider: true,
+		Network:             network,
+		DatabaseVersion:     "GeoLite2-Country/1704728164/6f5e4490f425",
+		Source:              "GeoLite2-Country.mmdb",
+	}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "67.43.156.1",
+		AllowedCountries: []string{"DE"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Allowed {
+		t.Error("expected allowed to be true")
+	}
+	if resp.Continent != "EU" || resp.RegisteredCountry != "RO" || resp.RepresentedCountry != "US" {
+		t.Errorf("unexpected country attributes: %v", resp)
+	}
+	if !resp.IsInEuropeanUnion || !resp.IsAnonymousProxy || !resp.IsSatelliteProvider {
+		t.Errorf("expected all traits to be true: %v", resp)
+	}
+	if resp.Network != "67.43.156.0/24" {
+		t.Errorf("expected network 67.43.156.0/24, got %s", resp.Network)
+	}
+	if resp.DatabaseVersion != "GeoLite2-Country/1704728164/6f5e4490f425" {
+		t.Errorf("unexpected database version %s", resp.DatabaseVersion)
+	}
+	if resp.Source != "GeoLite2-Country.mmdb" {
+		t.Errorf("expected source GeoLite2-Country.mmdb, got %s", resp.Source)
+	}
+}
+
+func TestCheckOverride(t *testing.T) {
+	_, network, _ := net.ParseCIDR("81.2.69.0/24")
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		Country: "DE",
+		Network: network,
+		Override: &data.Override{
+			Network:   network,
+			Country:   "DE",
+			Reason:    "Frankfurt VPN egress",
+			ExpiresAt: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "81.2.69.1",
+		AllowedCountries: []string{"DE"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Override == nil {
+		t.Fatal("expected the override to be reported")
+	}
+	if resp.Override.Network != "81.2.69.0/24" || resp.Override.Reason != "Frankfurt VPN egress" {
+		t.Errorf("unexpected override %v", resp.Override)
+	}
+	if resp.Override.ExpiresAt != "2026-06-01T00:00:00Z" {
+		t.Errorf("expected expires_at 2026-06-01T00:00:00Z, got %s", resp.Override.ExpiresAt)
+	}
+}
+
+func TestCheckRequireUnanimous(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		Country: "US",
+		Consensus: &data.Consensus{
+			Agreement: 0.5,
+			Votes:     map[string]string{"GeoIP2-Country.mmdb": "US", "dbip.csv": "CA"},
+		},
+	}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "216.160.83.56",
 		AllowedCountries: []string{"US"},
+		RequireUnanimous: true,
 	})
-	assertCode(t, err, codes.Internal)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Allowed {
+		t.Error("expected allowed to be false without unanimity")
+	}
+	if resp.Consensus.GetAgreement() != 0.5 || resp.Consensus.GetVotes()["dbip.csv"] != "CA" {
+		t.Errorf("unexpected consensus %v", resp.Consensus)
+	}
+}
+
+func TestCheckAddressClass(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		AddressClass: data.ClassPrivate,
+		ClassAction:  data.ClassAllow,
+	}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "10.0.0.1",
+		AllowedCountries: []string{"US"},
+	})
+	if err != nil {
+		t.Fatalf("expected a classified address not to fail, got %v", err)
+	}
+	if !resp.Allowed || resp.Country != "" || resp.AddressClass != "private" {
+		t.Errorf("expected an allowed private address, got %v", resp)
+	}
+}
+
+func TestCheckTranslation(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		Country:     "US",
+		Translation: data.TranslationNAT64,
+		EmbeddedIP:  net.ParseIP("216.160.83.56"),
+	}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "64:ff9b::d8a0:5338",
+		AllowedCountries: []string{"US"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Translation != "nat64" || resp.EmbeddedIp != "216.160.83.56" {
+		t.Errorf("expected the NAT64 translation of 216.160.83.56, got %q %q", resp.Translation, resp.EmbeddedIp)
+	}
+}
+
+func TestCheckAllowedSubdivision(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		Country:      "US",
+		Subdivisions: []string{"US-CA"},
+	}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:                  "1.2.3.4",
+		AllowedCountries:    []string{"US"},
+		AllowedSubdivisions: []string{"US-CA", "US-NY"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Allowed {
+		t.Error("expected allowed to be true")
+	}
+	if resp.Subdivision != "US-CA" {
+		t.Errorf("expected subdivision US-CA, got %s", resp.Subdivision)
+	}
+}
+
+func TestCheckAllowedASN(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		Country:        "DE",
+		ASN:            3320,
+		ASOrganization: "Deutsche Telekom AG",
+	}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		AllowedCountries: []string{"DE"},
+		AllowedAsns:      []uint32{3320},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.Allowed {
+		t.Error("expected allowed to be true")
+	}
+	if resp.Asn != 3320 || resp.AsOrganization != "Deutsche Telekom AG" {
+		t.Errorf("expected ASN 3320 Deutsche Telekom AG, got %d %s", resp.Asn, resp.AsOrganization)
+	}
+}
+
+func TestCheckDenyTorExitNode(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		Country:   "DE",
+		Anonymous: data.AnonymousIP{IsAnonymous: true, IsTorExitNode: true},
+	}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		AllowedCountries: []string{"DE"},
+		DenyTorExitNode:  true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Allowed {
+		t.Error("expected allowed to be false for Tor exit node")
+	}
+	if !resp.IsAnonymous || !resp.IsTorExitNode {
+		t.Errorf("expected anonymous Tor flags, got %v", resp)
+	}
+}
+
+type mockMetadata struct {
+	meta *data.Metadata
+	err  error
+}
+
+func (m *mockMetadata) Metadata() (*data.Metadata, error) {
+	return m.meta, m.err
+}
+
+func TestGetDatabase(t *testing.T) {
+	h := NewHandler(&mockLookup{}, &mockMetadata{meta: &data.Metadata{
+		Path:         "/data/GeoLite2-Country.mmdb",
+		DatabaseType: "GeoLite2-Country",
+		BuildEpoch:   1704728164,
+		IPVersion:    6,
+		NodeCount:    1234,
+		FileHash:     "abc123",
+		LoadedAt:     time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Version:      "GeoLite2-Country/1704728164/abc123",
+	}}, nil)
+
+	resp, err := h.GetDatabase(context.Background(), &geofencev1.GetDatabaseRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.DatabaseType != "GeoLite2-Country" || resp.BuildEpoch != 1704728164 || resp.IpVersion != 6 || resp.NodeCount != 1234 {
+		t.Errorf("unexpected metadata: %v", resp)
+	}
+	if resp.Path != "/data/GeoLite2-Country.mmdb" || resp.FileHash != "abc123" {
+		t.Errorf("unexpected file attributes: %v", resp)
+	}
+	if resp.LoadedAt != "2026-01-02T03:04:05Z" {
+		t.Errorf("expected loaded_at 2026-01-02T03:04:05Z, got %s", resp.LoadedAt)
+	}
+	if resp.Version != "GeoLite2-Country/1704728164/abc123" {
+		t.Errorf("unexpected version %s", resp.Version)
+	}
+}
+
+func TestGetDatabaseSources(t *testing.T) {
+	h := NewHandler(&mockLookup{}, &mockMetadata{meta: &data.Metadata{
+		DatabaseType: data.CompositeDatabaseType,
+		Version:      "CSV/1/aaa+GeoLite2-Country/1704728164/abc123",
+		Sources: []data.Metadata{
+			{Source: "corrections.csv", DatabaseType: "CSV", Version: "CSV/1/aaa"},
+			{Source: "GeoLite2-Country.mmdb", DatabaseType: "GeoLite2-Country", Version: "GeoLite2-Country/1704728164/abc123", Disagreements: 4},
+		},
+	}}, nil)
+
+	resp, err := h.GetDatabase(context.Background(), &geofencev1.GetDatabaseRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Sources) != 2 {
+		t.Fatalf("expected 2 sources, got %d", len(resp.Sources))
+	}
+	if resp.Sources[0].Source != "corrections.csv" || resp.Sources[1].DatabaseType != "GeoLite2-Country" {
+		t.Errorf("unexpected sources: %v", resp.Sources)
+	}
+	if resp.Sources[1].Disagreements != 4 {
+		t.Errorf("unexpected sources: %v", resp.Sources)
+	}
+}
+
+func TestGetDatabaseUnavailable(t *testing.T) {
+	h := NewHandler(&mockLookup{}, &mockMetadata{err: fmt.Errorf("mmdb reader is closed")}, nil)
+
+	_, err := h.GetDatabase(context.Background(), &geofencev1.GetDatabaseRequest{})
+	assertCode(t, err, codes.Unavailable)
+}
+
+func TestGetDatabaseWithoutMetadata(t *testing.T) {
+	h := NewHandler(&mockLookup{}, nil, nil)
+
+	_, err := h.GetDatabase(context.Background(), &geofencev1.GetDatabaseRequest{})
+	assertCode(t, err, codes.Unimplemented)
 }
 
 func assertCode(t *testing.T, err error, want codes.Code) {
@@ -124,3 +634,57 @@ func assertCode(t *testing.T, err error, want codes.Code) {
 		t.Fatalf("expected code %v, got %v", want, status.Code(err))
 	}
 }
+
+func TestCheckMissingDatabase(t *testing.T) {
+	h := NewHandler(&mockLookup{country: "US"}, nil, policy.NewResolver(nil, nil, policy.WithDatabases(false, true)))
+
+	_, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "1.2.3.4",
+		AllowedCountries: []string{"US"},
+		BlockedAsns:      []uint32{16509},
+	})
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestCheckDenyOnlyRules(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		Country:   "US",
+		ASN:       16509,
+		Anonymous: data.AnonymousIP{IsAnonymousVPN: true},
+	}}, nil, nil)
+
+	for _, req := range []*geofencev1.CheckRequest{
+		{Ip: "1.2.3.4", BlockedAsns: []uint32{16509}},
+		{Ip: "1.2.3.4", DenyVpn: true},
+	} {
+		resp, err := h.Check(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Allowed || resp.Reason != "deny_match" {
+			t.Errorf("expected a deny match, got allowed=%v reason %q", resp.Allowed, resp.Reason)
+		}
+	}
+}
+
+func TestCheckConsensusFailedSources(t *testing.T) {
+	h := NewHandler(&mockLookup{result: &data.LookupResult{
+		Country: "US",
+		Consensus: &data.Consensus{
+			Agreement: 2.0 / 3,
+			Votes:     map[string]string{"GeoIP2-Country.mmdb": "US", "dbip.csv": "US"},
+			Failed:    []string{"ip2location.csv"},
+		},
+	}}, nil, nil)
+
+	resp, err := h.Check(context.Background(), &geofencev1.CheckRequest{
+		Ip:               "216.160.83.56",
+		AllowedCountries: []string{"US"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(resp.Consensus.GetFailed(), []string{"ip2location.csv"}) {
+		t.Errorf("expected the failed source to be reported, got %v", resp.Consensus)
+	}
+}
@@ -0,0 +1,360 @@
+package mmdb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DefaultDatabaseType is the database type of compiled databases, accepted
+// by MmdbReader as a Country edition.
+const DefaultDatabaseType = "GeoIP2-Country"
+
+// Record maps a network to the attributes of a GeoIP2 Country record. Only
+// Network and Country are required; country codes are ISO-3166-1 alpha-2.
+type Record struct {
+	// Network is a CIDR network or a single IP address.
+	Network string `json:"network"`
+	// Country is the country the network is located in.
+	Country string `json:"country"`
+	// Continent is the two-letter continent code (e.g. "EU").
+	Continent string `json:"continent,omitempty"`
+	// RegisteredCountry is the country the network is registered in.
+	RegisteredCountry string `json:"registered_country,omitempty"`
+	// RepresentedCountry is the country represented by the users of the
+	// network, such as a military base abroad.
+	RepresentedCountry string `json:"represented_country,omitempty"`
+	// RepresentedCountryType is the kind of representation, e.g. "military".
+	RepresentedCountryType string `json:"represented_country_type,omitempty"`
+	// IsInEuropeanUnion marks Country as a member state of the EU.
+	IsInEuropeanUnion bool `json:"is_in_european_union,omitempty"`
+	// IsAnonymousProxy marks the network as an anonymous proxy.
+	IsAnonymousProxy bool `json:"is_anonymous_proxy,omitempty"`
+	// IsSatelliteProvider marks the network as a satellite provider.
+	IsSatelliteProvider bool `json:"is_satellite_provider,omitempty"`
+}
+
+// csvColumns are the CSV columns in the order used when the file has no
+// header row. A header row may list them in any order.
+var csvColumns = []string{
+	"network", "country", "continent", "registered_country",
+	"represented_country", "represented_country_type",
+	"is_in_european_union", "is_anonymous_proxy", "is_satellite_provider",
+}
+
+// ReadCSV reads records from CSV. Without a header row the columns are
+// network,country followed by the optional columns of Record in declaration
+// order; a header row names the columns (see the JSON field names of
+// Record). Lines starting with '#' are comments.
+func ReadCSV(in io.Reader) ([]Record, error) {
+	cr := csv.NewReader(in)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+
+	var records []Record
+	columns := csvColumns
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 1 && !isNetwork(row[0]) {
+			if columns, err = csvHeader(row); err != nil {
+				return nil, fmt.Errorf("line 1: %w", err)
+			}
+			continue
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("line %d: expected network,country", line)
+		}
+		if len(row) > len(columns) {
+			return nil, fmt.Errorf("line %d: expected at most %d columns, got %d", line, len(columns), len(row))
+		}
+
+		var rec Record
+		for i, value := range row {
+			if err := rec.set(columns[i], strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// csvHeader validates a header row and returns its columns.
+func csvHeader(row []string) ([]string, error) {
+	columns := make([]string, len(row))
+	seen := make(map[string]bool)
+	for i, name := range row {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(csvColumns, name) {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+	if !seen["network"] || !seen["country"] {
+		return nil, errors.New("header must name the network and country columns")
+	}
+	return columns, nil
+}
+
+func isNetwork(s string) bool {
+	_, err := parseNetwork(s)
+	return err == nil
+}
+
+// set assigns the CSV column name.
+func (r *Record) set(name, value string) error {
+	var err error
+	switch name {
+	case "network":
+		r.Network = value
+	case "country":
+		r.Country = value
+	case "continent":
+		r.Continent = value
+	case "registered_country":
+		r.RegisteredCountry = value
+	case "represented_country":
+		r.RepresentedCountry = value
+	case "represented_country_type":
+		r.RepresentedCountryType = value
+	case "is_in_european_union":
+		r.IsInEuropeanUnion, err = parseFlag(value)
+	case "is_anonymous_proxy":
+		r.IsAnonymousProxy, err = parseFlag(value)
+	case "is_satellite_provider":
+		r.IsSatelliteProvider, err = parseFlag(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// parseFlag parses a boolean column; empty means false.
+func parseFlag(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+// ReadJSON reads records from a JSON array of Record objects.
+func ReadJSON(in io.Reader) ([]Record, error) {
+	dec := json.NewDecoder(in)
+	dec.DisallowUnknownFields()
+	var records []Record
+	if err := dec.Decode(&records); err != nil {
+		return nil, fmt.Errorf("invalid JSON records: %w", err)
+	}
+	return records, nil
+}
+
+// Compile writes a GeoIP2-Country-compatible database holding records to
+// out. Records are inserted in order, so a record overrides the overlapping
+// parts of earlier ones. An empty meta.DatabaseType defaults to
+// DefaultDatabaseType.
+func Compile(out io.Writer, records []Record, meta Metadata) error {
+	if len(records) == 0 {
+		return errors.New("no records to compile")
+	}
+	if meta.DatabaseType == "" {
+		meta.DatabaseType = DefaultDatabaseType
+	}
+	if len(meta.Description) == 0 {
+		meta.Description = map[string]string{"en": "Compiled " + meta.DatabaseType + " database"}
+	}
+	if meta.Languages == nil {
+		meta.Languages = []string{"en"}
+	}
+
+	w := NewWriter(meta)
+	for i, rec := range records {
+		network, err := parseNetwork(rec.Network)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i+1, err)
+		}
+		value, err := rec.value()
+		if err != nil {
+			return fmt.Errorf("record %d (%s): %w", i+1, rec.Network, err)
+		}
+		if err := w.Insert(network, value); err != nil {
+			return fmt.Errorf("record %d: %w", i+1, err)
+		}
+	}
+	_, err := w.WriteTo(out)
+	return err
+}
+
+// parseNetwork parses a CIDR network or a single IP address.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid network %q", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network %q", s)
+	}
+	return network, nil
+}
+
+// value returns the GeoIP2 Country record for r.
+func (r Record) value() (map[string]any, error) {
+	country, err := countryCode("country", r.Country)
+	if err != nil {
+		return nil, err
+	}
+	if country == "" {
+		return nil, errors.New("country is required")
+	}
+
+	value := map[string]any{
+		"country": isoCountry(country, r.IsInEuropeanUnion),
+	}
+	if r.Continent != "" {
+		if len(r.Continent) != 2 {
+			return nil, fmt.Errorf("invalid continent code %q", r.Continent)
+		}
+		value["continent"] = map[string]any{"code": strings.ToUpper(r.Continent)}
+	}
+	if registered, err := countryCode("registered_country", r.RegisteredCountry); err != nil {
+		return nil, err
+	} else if registered != "" {
+		value["registered_country"] = isoCountry(registered, false)
+	}
+	if represented, err := countryCode("represented_country", r.RepresentedCountry); err != nil {
+		return nil, err
+	} else if represented != "" {
+		rc := isoCountry(represented, false)
+		if r.RepresentedCountryType != "" {
+			rc["type"] = r.RepresentedCountryType
+		}
+		value["represented_country"] = rc
+	}
+
+	traits := map[string]any{}
+	if r.IsAnonymousProxy {
+		traits["is_anonymous_proxy"] = true
+	}
+	if r.IsSatelliteProvider {
+		traits["is_satellite_provider"] = true
+	}
+	if len(traits) > 0 {
+		value["traits"] = traits
+	}
+	return value, nil
+}
+
+func isoCountry(code string, inEU bool) map[string]any {
+	c := map[string]any{"iso_code": code}
+	if inEU {
+		c["is_in_european_union"] = true
+	}
+	return c
+}
+
+// countryCode upper-cases an ISO-3166-1 alpha-2 code; empty is allowed.
+func countryCode(field, code string) (string, error) {
+	if code == "" {
+		return "", nil
+	}
+	if len(code) != 2 {
+		return "", fmt.Errorf("invalid %s code %q", field, code)
+	}
+	return strings.ToUpper(code), nil
+}
+
+// ReadFile reads the records of a CSV or JSON file. An empty format is
+// taken from the file extension.
+func ReadFile(path, format string) ([]Record, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	switch format {
+	case "csv":
+		records, err = ReadCSV(f)
+	case "json":
+		records, err = ReadJSON(f)
+	default:
+		return nil, fmt.Errorf("%s: unknown input format %q", path, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
+
+// WriteFile compiles records, verifies the result the way MmdbReader will
+// read it, and atomically replaces the file at path, so a watching service
+// never loads a partial file. It returns the metadata of the written
+// database.
+func WriteFile(path string, records []Record, meta Metadata) (*maxminddb.Metadata, error) {
+	var buf bytes.Buffer
+	if err := Compile(&buf, records, meta); err != nil {
+		return nil, err
+	}
+	reader, err := maxminddb.FromBytes(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("compiled database is unreadable: %w", err)
+	}
+	if err := reader.Verify(); err != nil {
+		return nil, fmt.Errorf("compiled database failed verification: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".compile-*.mmdb")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to write database: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return nil, fmt.Errorf("failed to write database: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write database: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to install database: %w", err)
+	}
+	return &reader.Metadata, nil
+}
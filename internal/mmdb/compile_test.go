@@ -0,0 +1,288 @@
+package mmdb
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// compile compiles records and opens the result.
+func compile(t *testing.T, records []Record, meta Metadata) *maxminddb.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Compile(&buf, records, meta); err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	reader, err := maxminddb.FromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to open compiled database: %v", err)
+	}
+	return reader
+}
+
+func TestCompile_Lookup(t *testing.T) {
+	reader := compile(t, []Record{
+		{Network: "2.125.160.216/29", Country: "gb", Continent: "EU", RegisteredCountry: "FR"},
+		{Network: "89.160.20.112/28", Country: "SE", Continent: "EU", RegisteredCountry: "DE", IsInEuropeanUnion: true},
+		{Network: "67.43.156.0/24", Country: "BT", IsAnonymousProxy: true},
+		{Network: "202.196.224.0/20", Country: "PH", RepresentedCountry: "US", RepresentedCountryType: "military"},
+		{Network: "2001:218::/32", Country: "JP", IsSatelliteProvider: true},
+		{Network: "10.0.0.1", Country: "ZZ"},
+	}, Metadata{})
+
+	tests := []struct {
+		ip      string
+		network string
+		check   func(geoip2.Country) bool
+	}{
+		{"2.125.160.220", "2.125.160.216/29", func(c geoip2.Country) bool {
+			return c.Country.IsoCode == "GB" && c.Continent.Code == "EU" && c.RegisteredCountry.IsoCode == "FR"
+		}},
+		{"89.160.20.112", "89.160.20.112/28", func(c geoip2.Country) bool {
+			return c.Country.IsoCode == "SE" && c.Country.IsInEuropeanUnion && c.RegisteredCountry.IsoCode == "DE"
+		}},
+		{"67.43.156.1", "67.43.156.0/24", func(c geoip2.Country) bool {
+			return c.Country.IsoCode == "BT" && c.Traits.IsAnonymousProxy
+		}},
+		{"202.196.224.1", "202.196.224.0/20", func(c geoip2.Country) bool {
+			return c.RepresentedCountry.IsoCode == "US" && c.RepresentedCountry.Type == "military"
+		}},
+		{"2001:218::1", "2001:218::/32", func(c geoip2.Country) bool {
+			return c.Country.IsoCode == "JP" && c.Traits.IsSatelliteProvider
+		}},
+		{"10.0.0.1", "10.0.0.1/32", func(c geoip2.Country) bool { return c.Country.IsoCode == "ZZ" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			var record geoip2.Country
+			network, ok, err := reader.LookupNetwork(net.ParseIP(tt.ip), &record)
+			if err != nil || !ok {
+				t.Fatalf("lookup failed: ok=%v err=%v", ok, err)
+			}
+			if network.String() != tt.network {
+				t.Errorf("expected network %s, got %s", tt.network, network)
+			}
+			if !tt.check(record) {
+				t.Errorf("unexpected record %+v", record)
+			}
+		})
+	}
+
+	var record geoip2.Country
+	if _, ok, err := reader.LookupNetwork(net.ParseIP("10.0.0.2"), &record); err != nil || ok {
+		t.Errorf("expected no record for 10.0.0.2, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestCompile_Overrides(t *testing.T) {
+	reader := compile(t, []Record{
+		{Network: "10.0.0.0/8", Country: "US"},
+		{Network: "10.1.0.0/16", Country: "CA"},
+		{Network: "10.1.2.0/24", Country: "MX"},
+		{Network: "10.2.0.0/16", Country: "GB"},
+		{Network: "10.2.0.0/15", Country: "FR"}, // replaces 10.2.0.0/16
+	}, Metadata{})
+
+	for ip, want := range map[string]string{
+		"10.0.0.1": "US",
+		"10.1.0.1": "CA",
+		"10.1.2.1": "MX",
+		"10.2.0.1": "FR",
+		"10.3.0.1": "FR",
+		"10.4.0.1": "US",
+	} {
+		var record geoip2.Country
+		if err := reader.Lookup(net.ParseIP(ip), &record); err != nil {
+			t.Fatalf("lookup %s failed: %v", ip, err)
+		}
+		if record.Country.IsoCode != want {
+			t.Errorf("%s: expected %s, got %s", ip, want, record.Country.IsoCode)
+		}
+	}
+}
+
+func TestCompile_IPv4MappedAlias(t *testing.T) {
+	reader := compile(t, []Record{{Network: "1.0.0.0/24", Country: "AU"}}, Metadata{})
+
+	// Walk the tree with a raw 16-byte address so the reader cannot convert
+	// it to IPv4 first.
+	var record geoip2.Country
+	networks := reader.NetworksWithin(&net.IPNet{IP: net.ParseIP("::ffff:1.0.0.0"), Mask: net.CIDRMask(120, 128)})
+	if !networks.Next() {
+		t.Fatalf("expected a network in ::ffff:1.0.0.0/120: %v", networks.Err())
+	}
+	if _, err := networks.Network(&record); err != nil {
+		t.Fatalf("failed to decode record: %v", err)
+	}
+	if record.Country.IsoCode != "AU" {
+		t.Errorf("expected AU, got %s", record.Country.IsoCode)
+	}
+}
+
+func TestCompile_Metadata(t *testing.T) {
+	epoch := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	reader := compile(t, []Record{{Network: "1.0.0.0/24", Country: "AU"}}, Metadata{
+		DatabaseType: "GeoLite2-Country",
+		Description:  map[string]string{"en": "test"},
+		BuildEpoch:   epoch,
+	})
+
+	meta := reader.Metadata
+	if meta.DatabaseType != "GeoLite2-Country" || meta.Description["en"] != "test" {
+		t.Errorf("unexpected type or description: %+v", meta)
+	}
+	if meta.BuildEpoch != uint(epoch.Unix()) {
+		t.Errorf("expected build epoch %d, got %d", epoch.Unix(), meta.BuildEpoch)
+	}
+	if meta.IPVersion != 6 || meta.RecordSize != 24 || meta.BinaryFormatMajorVersion != 2 {
+		t.Errorf("unexpected format metadata: %+v", meta)
+	}
+	if len(meta.Languages) != 1 || meta.Languages[0] != "en" {
+		t.Errorf("expected languages [en], got %v", meta.Languages)
+	}
+	if err := reader.Verify(); err != nil {
+		t.Errorf("compiled database failed verification: %v", err)
+	}
+
+	reader = compile(t, []Record{{Network: "1.0.0.0/24", Country: "AU"}}, Metadata{})
+	if reader.Metadata.DatabaseType != DefaultDatabaseType {
+		t.Errorf("expected default type %s, got %s", DefaultDatabaseType, reader.Metadata.DatabaseType)
+	}
+}
+
+func TestCompile_ManyRecords(t *testing.T) {
+	var records []Record
+	for i := 0; i < 1<<12; i++ {
+		records = append(records, Record{
+			Network:   fmt.Sprintf("2001:db8:%x::/48", i),
+			Country:   "JP",
+			Continent: fmt.Sprintf("%c%c", 'A'+i%26, 'A'+i/26%26),
+		})
+	}
+	records = append(records, Record{Network: "1.0.0.0/8", Country: "AU"})
+	reader := compile(t, records, Metadata{})
+
+	if err := reader.Verify(); err != nil {
+		t.Fatalf("compiled database failed verification: %v", err)
+	}
+	var record geoip2.Country
+	if err := reader.Lookup(net.ParseIP("2001:db8:fff::1"), &record); err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if record.Country.IsoCode != "JP" || record.Continent.Code != "NB" {
+		t.Errorf("expected JP/NB, got %+v", record)
+	}
+}
+
+func TestPutNode(t *testing.T) {
+	// Decode the records the way the MaxMind DB specification describes.
+	decode := map[int]func(b []byte) (uint64, uint64){
+		24: func(b []byte) (uint64, uint64) {
+			return uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2]),
+				uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
+		},
+		28: func(b []byte) (uint64, uint64) {
+			return uint64(b[3]&0xf0)<<20 | uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2]),
+				uint64(b[3]&0x0f)<<24 | uint64(b[4])<<16 | uint64(b[5])<<8 | uint64(b[6])
+		},
+		32: func(b []byte) (uint64, uint64) {
+			return uint64(b[0])<<24 | uint64(b[1])<<16 | uint64(b[2])<<8 | uint64(b[3]),
+				uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
+		},
+	}
+
+	for size, dec := range decode {
+		left, right := uint64(1)<<size-2, uint64(1)<<(size-1)+3
+		b := make([]byte, size/4)
+		putNode(b, size, left, right)
+		if l, r := dec(b); l != left || r != right {
+			t.Errorf("record size %d: expected %d/%d, got %d/%d", size, left, right, l, r)
+		}
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := map[string][]Record{
+		"no records":       nil,
+		"invalid network":  {{Network: "1.0.0.x/24", Country: "AU"}},
+		"missing country":  {{Network: "1.0.0.0/24"}},
+		"invalid country":  {{Network: "1.0.0.0/24", Country: "AUS"}},
+		"default route":    {{Network: "::/0", Country: "AU"}},
+		"invalid registry": {{Network: "1.0.0.0/24", Country: "AU", RegisteredCountry: "X"}},
+	}
+
+	for name, records := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := Compile(&bytes.Buffer{}, records, Metadata{}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []Record
+		wantErr bool
+	}{
+		{
+			name: "positional",
+			in:   "# corrections\n1.0.0.0/24,AU\n2001:218::/32,JP,AS,JP,,,false,true\n",
+			want: []Record{
+				{Network: "1.0.0.0/24", Country: "AU"},
+				{Network: "2001:218::/32", Country: "JP", Continent: "AS", RegisteredCountry: "JP", IsAnonymousProxy: true},
+			},
+		},
+		{
+			name: "header",
+			in:   "country,is_in_european_union,network\nSE,true,89.160.20.112/28\n",
+			want: []Record{{Network: "89.160.20.112/28", Country: "SE", IsInEuropeanUnion: true}},
+		},
+		{name: "unknown column", in: "network,country,city\n", wantErr: true},
+		{name: "header without country", in: "network,continent\n", wantErr: true},
+		{name: "missing country", in: "1.0.0.0/24\n", wantErr: true},
+		{name: "too many columns", in: "1.0.0.0/24,AU,OC,AU,,,,,,extra\n", wantErr: true},
+		{name: "invalid flag", in: "1.0.0.0/24,AU,OC,AU,,,maybe\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadCSV(strings.NewReader(tt.in))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	got, err := ReadJSON(strings.NewReader(`[{"network": "1.0.0.0/24", "country": "AU", "is_anonymous_proxy": true}]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0] != (Record{Network: "1.0.0.0/24", Country: "AU", IsAnonymousProxy: true}) {
+		t.Errorf("unexpected records %+v", got)
+	}
+
+	if _, err := ReadJSON(strings.NewReader(`[{"network": "1.0.0.0/24", "cc": "AU"}]`)); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
@@ -0,0 +1,252 @@
+package mmdb
+
+import (
+	"math/big"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Change is a network whose country differs between two databases. An empty
+// country means the database has no record for the network.
+type Change struct {
+	Network      string `json:"network"`
+	OldCountry   string `json:"old_country"`
+	NewCountry   string `json:"new_country"`
+	PrefixLength int    `json:"prefix_length"`
+}
+
+// CountrySummary counts the addresses a country gained and lost between two
+// databases. IPv4 and IPv6 are counted separately; IPv6 counts do not fit
+// in 64 bits.
+type CountrySummary struct {
+	Country    string   `json:"country"`
+	GainedIPv4 uint64   `json:"gained_ipv4"`
+	LostIPv4   uint64   `json:"lost_ipv4"`
+	GainedIPv6 *big.Int `json:"gained_ipv6"`
+	LostIPv6   *big.Int `json:"lost_ipv6"`
+}
+
+// DiffReport lists the networks whose country changed, in address order, and
+// a summary per affected country, sorted by country code.
+type DiffReport struct {
+	Changes []Change         `json:"changes"`
+	Summary []CountrySummary `json:"summary"`
+}
+
+// span is an inclusive address range mapped to one country. IPv4 addresses
+// are held in their IPv4-mapped form so both families sort together.
+type span struct {
+	start, end netip.Addr
+	country    string
+}
+
+var (
+	firstAddr = netip.IPv6Unspecified()
+	lastAddr  = netip.AddrFrom16([16]byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	})
+)
+
+// Diff walks the search trees of both databases and reports the networks
+// whose country ISO code changed. If countries is not empty, only changes
+// into or out of one of those countries are reported.
+func Diff(oldDB, newDB *maxminddb.Reader, countries []string) (*DiffReport, error) {
+	oldSpans, err := countrySpans(oldDB)
+	if err != nil {
+		return nil, err
+	}
+	newSpans, err := countrySpans(newDB)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DiffReport{Changes: []Change{}, Summary: []CountrySummary{}}
+	summaries := make(map[string]*CountrySummary)
+	summary := func(country string) *CountrySummary {
+		s, ok := summaries[country]
+		if !ok {
+			s = &CountrySummary{Country: country, GainedIPv6: new(big.Int), LostIPv6: new(big.Int)}
+			summaries[country] = s
+		}
+		return s
+	}
+
+	for _, c := range changedSpans(oldSpans, newSpans) {
+		if len(countries) > 0 && !slices.Contains(countries, c.old) && !slices.Contains(countries, c.new) {
+			continue
+		}
+		for _, p := range rangePrefixes(c.start, c.end) {
+			network, length := p.Addr(), p.Bits()
+			if network.Is4In6() {
+				network, length = network.Unmap(), length-96
+			}
+			report.Changes = append(report.Changes, Change{
+				Network:      netip.PrefixFrom(network, length).String(),
+				OldCountry:   c.old,
+				NewCountry:   c.new,
+				PrefixLength: length,
+			})
+
+			size := new(big.Int).Lsh(big.NewInt(1), uint(network.BitLen()-length))
+			if c.old != "" {
+				s := summary(c.old)
+				if network.Is4() {
+					s.LostIPv4 += size.Uint64()
+				} else {
+					s.LostIPv6.Add(s.LostIPv6, size)
+				}
+			}
+			if c.new != "" {
+				s := summary(c.new)
+				if network.Is4() {
+					s.GainedIPv4 += size.Uint64()
+				} else {
+					s.GainedIPv6.Add(s.GainedIPv6, size)
+				}
+			}
+		}
+	}
+
+	for _, s := range summaries {
+		report.Summary = append(report.Summary, *s)
+	}
+	slices.SortFunc(report.Summary, func(a, b CountrySummary) int {
+		return strings.Compare(a.Country, b.Country)
+	})
+	return report, nil
+}
+
+// countrySpans returns the networks of db as spans covering the whole
+// address space in order; gaps get an empty country.
+func countrySpans(db *maxminddb.Reader) ([]span, error) {
+	var record struct {
+		Country struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+
+	var spans []span
+	networks := db.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		record.Country.IsoCode = ""
+		network, err := networks.Network(&record)
+		if err != nil {
+			return nil, err
+		}
+		start, end := networkRange(network)
+		spans = append(spans, span{start: start, end: end, country: record.Country.IsoCode})
+	}
+	if err := networks.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(spans, func(a, b span) int { return a.start.Compare(b.start) })
+
+	// Fill the gaps so the spans are contiguous from :: to the last address.
+	filled := make([]span, 0, 2*len(spans)+1)
+	next := firstAddr
+	for _, s := range spans {
+		if next.Less(s.start) {
+			filled = append(filled, span{start: next, end: s.start.Prev()})
+		}
+		filled = append(filled, s)
+		next = s.end.Next()
+		if s.end == lastAddr {
+			return filled, nil
+		}
+	}
+	return append(filled, span{start: next, end: lastAddr}), nil
+}
+
+// networkRange returns the first and last address of network in the
+// IPv4-mapped form for IPv4 networks.
+func networkRange(network *net.IPNet) (netip.Addr, netip.Addr) {
+	ones, bits := network.Mask.Size()
+	addr, _ := netip.AddrFromSlice(network.IP)
+	if bits == 32 {
+		ones += 96
+	}
+	prefix := netip.PrefixFrom(netip.AddrFrom16(addr.As16()), ones).Masked()
+	return prefix.Addr(), prefixLast(prefix)
+}
+
+// prefixLast returns the last address of prefix.
+func prefixLast(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().As16()
+	for i := prefix.Bits(); i < 128; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	return netip.AddrFrom16(b)
+}
+
+// countryChange is a maximal address range whose country changed from old
+// to new.
+type countryChange struct {
+	start, end netip.Addr
+	old, new   string
+}
+
+// changedSpans merges two contiguous span lists and returns the ranges
+// where their countries differ, coalescing adjacent ranges with the same
+// change.
+func changedSpans(oldSpans, newSpans []span) []countryChange {
+	var changes []countryChange
+	start := firstAddr
+	for i, j := 0, 0; i < len(oldSpans) && j < len(newSpans); {
+		o, n := oldSpans[i], newSpans[j]
+		end := o.end
+		if n.end.Less(end) {
+			end = n.end
+		}
+
+		if o.country != n.country {
+			last := len(changes) - 1
+			if last >= 0 && changes[last].old == o.country && changes[last].new == n.country && changes[last].end.Next() == start {
+				changes[last].end = end
+			} else {
+				changes = append(changes, countryChange{start: start, end: end, old: o.country, new: n.country})
+			}
+		}
+
+		if end == lastAddr {
+			break
+		}
+		if end == o.end {
+			i++
+		}
+		if end == n.end {
+			j++
+		}
+		start = end.Next()
+	}
+	return changes
+}
+
+// rangePrefixes returns the minimal list of prefixes covering the inclusive
+// range [start, end].
+func rangePrefixes(start, end netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for {
+		// Widen the prefix while it stays aligned at start and within end.
+		bits := 128
+		for bits > 0 {
+			wider := netip.PrefixFrom(start, bits-1)
+			if wider.Masked().Addr() != start || end.Less(prefixLast(wider)) {
+				break
+			}
+			bits--
+		}
+		prefix := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, prefix)
+
+		last := prefixLast(prefix)
+		if last == end || last == lastAddr {
+			return prefixes
+		}
+		start = last.Next()
+	}
+}
@@ -0,0 +1,105 @@
+package mmdb
+
+import (
+	"math/big"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	oldDB := compile(t, []Record{
+		{Network: "10.0.0.0/8", Country: "US"},
+		{Network: "10.1.0.0/16", Country: "CA"},
+		{Network: "192.0.2.0/24", Country: "GB"},
+		{Network: "198.51.100.0/24", Country: "FR"},
+		{Network: "2001:db8::/32", Country: "JP"},
+	}, Metadata{})
+	newDB := compile(t, []Record{
+		{Network: "10.0.0.0/8", Country: "US"},
+		{Network: "10.1.0.0/17", Country: "CA"},
+		{Network: "10.1.128.0/17", Country: "MX"},
+		{Network: "192.0.2.0/25", Country: "GB"},
+		{Network: "203.0.113.0/24", Country: "DE"},
+		{Network: "2001:db8::/33", Country: "JP"},
+		{Network: "2001:db8:8000::/33", Country: "KR"},
+	}, Metadata{})
+
+	report, err := Diff(oldDB, newDB, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantChanges := []Change{
+		{Network: "10.1.128.0/17", OldCountry: "CA", NewCountry: "MX", PrefixLength: 17},
+		{Network: "192.0.2.128/25", OldCountry: "GB", NewCountry: "", PrefixLength: 25},
+		{Network: "198.51.100.0/24", OldCountry: "FR", NewCountry: "", PrefixLength: 24},
+		{Network: "203.0.113.0/24", OldCountry: "", NewCountry: "DE", PrefixLength: 24},
+		{Network: "2001:db8:8000::/33", OldCountry: "JP", NewCountry: "KR", PrefixLength: 33},
+	}
+	if !reflect.DeepEqual(report.Changes, wantChanges) {
+		t.Errorf("expected changes %+v, got %+v", wantChanges, report.Changes)
+	}
+
+	ipv6 := new(big.Int).Lsh(big.NewInt(1), 95)
+	wantSummary := []CountrySummary{
+		{Country: "CA", LostIPv4: 1 << 15, GainedIPv6: new(big.Int), LostIPv6: new(big.Int)},
+		{Country: "DE", GainedIPv4: 256, GainedIPv6: new(big.Int), LostIPv6: new(big.Int)},
+		{Country: "FR", LostIPv4: 256, GainedIPv6: new(big.Int), LostIPv6: new(big.Int)},
+		{Country: "GB", LostIPv4: 128, GainedIPv6: new(big.Int), LostIPv6: new(big.Int)},
+		{Country: "JP", GainedIPv6: new(big.Int), LostIPv6: ipv6},
+		{Country: "KR", GainedIPv6: ipv6, LostIPv6: new(big.Int)},
+		{Country: "MX", GainedIPv4: 1 << 15, GainedIPv6: new(big.Int), LostIPv6: new(big.Int)},
+	}
+	if len(report.Summary) != len(wantSummary) {
+		t.Fatalf("expected %d summaries, got %+v", len(wantSummary), report.Summary)
+	}
+	for i, want := range wantSummary {
+		got := report.Summary[i]
+		if got.Country != want.Country || got.GainedIPv4 != want.GainedIPv4 || got.LostIPv4 != want.LostIPv4 ||
+			got.GainedIPv6.Cmp(want.GainedIPv6) != 0 || got.LostIPv6.Cmp(want.LostIPv6) != 0 {
+			t.Errorf("expected summary %+v, got %+v", want, got)
+		}
+	}
+
+	filtered, err := Diff(oldDB, newDB, []string{"MX", "FR"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered.Changes) != 2 || filtered.Changes[0].NewCountry != "MX" || filtered.Changes[1].OldCountry != "FR" {
+		t.Errorf("expected only MX and FR changes, got %+v", filtered.Changes)
+	}
+}
+
+func TestDiff_Identical(t *testing.T) {
+	records := []Record{{Network: "10.0.0.0/8", Country: "US"}, {Network: "2001:db8::/32", Country: "JP"}}
+	report, err := Diff(compile(t, records, Metadata{}), compile(t, records, Metadata{}), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Changes) != 0 || len(report.Summary) != 0 {
+		t.Errorf("expected no changes, got %+v", report)
+	}
+}
+
+func TestRangePrefixes(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       []string
+	}{
+		{"::ffff:10.0.0.0", "::ffff:10.0.0.255", []string{"::ffff:10.0.0.0/120"}},
+		{"::ffff:10.0.0.1", "::ffff:10.0.0.6", []string{"::ffff:10.0.0.1/128", "::ffff:10.0.0.2/127", "::ffff:10.0.0.4/127", "::ffff:10.0.0.6/128"}},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"::/0"}},
+		{"8000::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"8000::/1"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, p := range rangePrefixes(netip.MustParseAddr(tt.start), netip.MustParseAddr(tt.end)) {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s-%s: expected %v, got %v", tt.start, tt.end, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+// Package mmdb builds and compares MaxMind DB (MMDB) files. It is used by the
+// geofence-mmdb tool and by tests that generate their own fixtures.
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net"
+	"slices"
+	"time"
+)
+
+// metadataMarker separates the data section from the metadata map.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree
+// and the data section.
+const dataSectionSeparator = 16
+
+// ipv4Mapped is ::ffff:0:0/96, aliased to the IPv4 subtree so readers that
+// do not convert IPv4-mapped addresses still find IPv4 networks.
+var ipv4Mapped = net.ParseIP("::ffff:0:0")
+
+// Metadata describes the database written by a Writer.
+type Metadata struct {
+	// DatabaseType is the edition name readers check, e.g. "GeoIP2-Country".
+	DatabaseType string
+	// Description maps language codes to a human-readable description.
+	Description map[string]string
+	// Languages lists the locales the records carry names for.
+	Languages []string
+	// BuildEpoch is the build time recorded in the database; the zero value
+	// means the time the database is written.
+	BuildEpoch time.Time
+}
+
+// Writer builds an IPv6 MMDB (IPv4 networks live in ::/96) in memory.
+// Networks are inserted in order; a network overrides the parts of
+// previously inserted networks it overlaps.
+type Writer struct {
+	meta   Metadata
+	root   *treeNode
+	values [][]byte // encoded values, referenced by index+1 from the tree
+	index  map[string]int
+	ipv4   bool
+}
+
+type treeNode struct {
+	children [2]treeRecord
+}
+
+// treeRecord points to a subtree, a value (index+1) or, if both are zero,
+// to nothing.
+type treeRecord struct {
+	node  *treeNode
+	value int
+}
+
+// NewWriter returns an empty Writer for a database described by meta.
+func NewWriter(meta Metadata) *Writer {
+	return &Writer{
+		meta:  meta,
+		root:  &treeNode{},
+		index: make(map[string]int),
+	}
+}
+
+// Insert maps network to value. Values are maps, slices, strings, booleans
+// and unsigned integers, nested arbitrarily; identical values are stored
+// once.
+func (w *Writer) Insert(network *net.IPNet, value map[string]any) error {
+	ones, size := network.Mask.Size()
+	addr := network.IP.To16()
+	if size == 128 && ones >= 96 && network.IP.To4() != nil {
+		// An IPv4-mapped network is stored with the IPv4 networks.
+		ones, size = ones-96, 32
+	}
+	switch {
+	case size == 32 && network.IP.To4() != nil:
+		addr = append(make(net.IP, 12), network.IP.To4()...)
+		ones += 96
+		w.ipv4 = true
+	case size != 128 || addr == nil:
+		return fmt.Errorf("invalid network %v", network)
+	}
+	if ones == 0 {
+		return fmt.Errorf("network %v: a /0 network is not supported", network)
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, value); err != nil {
+		return fmt.Errorf("network %v: %w", network, err)
+	}
+	key := buf.String()
+	v, ok := w.index[key]
+	if !ok {
+		w.values = append(w.values, buf.Bytes())
+		v = len(w.values)
+		w.index[key] = v
+	}
+
+	w.root.insert(addr, 0, ones, treeRecord{value: v})
+	return nil
+}
+
+// insert sets the record for the prefix of length bits of addr, splitting
+// values it falls inside and replacing subtrees it covers.
+func (n *treeNode) insert(addr net.IP, depth, length int, rec treeRecord) {
+	r := &n.children[bit(addr, depth)]
+	if depth == length-1 {
+		*r = rec
+		return
+	}
+	if r.node == nil {
+		r.node = &treeNode{children: [2]treeRecord{{value: r.value}, {value: r.value}}}
+		r.value = 0
+	}
+	r.node.insert(addr, depth+1, length, rec)
+}
+
+// bit returns bit i of addr, counted from the most significant bit.
+func bit(addr net.IP, i int) int {
+	return int(addr[i/8]>>(7-i%8)) & 1
+}
+
+// WriteTo writes the database to out.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	if w.ipv4 {
+		w.aliasIPv4()
+	}
+
+	// Number the nodes breadth-first; the root is node 0.
+	ids := map[*treeNode]int{w.root: 0}
+	nodes := []*treeNode{w.root}
+	for i := 0; i < len(nodes); i++ {
+		for _, r := range nodes[i].children {
+			if r.node == nil {
+				continue
+			}
+			if _, ok := ids[r.node]; !ok {
+				ids[r.node] = len(nodes)
+				nodes = append(nodes, r.node)
+			}
+		}
+	}
+	nodeCount := len(nodes)
+
+	var data bytes.Buffer
+	offsets := make([]int, len(w.values))
+	for i, v := range w.values {
+		offsets[i] = data.Len()
+		data.Write(v)
+	}
+
+	recordValue := func(r treeRecord) uint64 {
+		switch {
+		case r.node != nil:
+			return uint64(ids[r.node])
+		case r.value != 0:
+			return uint64(nodeCount + dataSectionSeparator + offsets[r.value-1])
+		default:
+			return uint64(nodeCount)
+		}
+	}
+
+	maxValue := uint64(nodeCount + dataSectionSeparator + data.Len())
+	var recordSize int
+	switch {
+	case maxValue < 1<<24:
+		recordSize = 24
+	case maxValue < 1<<28:
+		recordSize = 28
+	case maxValue < 1<<32:
+		recordSize = 32
+	default:
+		return 0, errors.New("database too large")
+	}
+
+	var buf bytes.Buffer
+	node := make([]byte, recordSize/4)
+	for _, n := range nodes {
+		putNode(node, recordSize, recordValue(n.children[0]), recordValue(n.children[1]))
+		buf.Write(node)
+	}
+	buf.Write(make([]byte, dataSectionSeparator))
+	buf.Write(data.Bytes())
+	buf.Write(metadataMarker)
+
+	buildEpoch := w.meta.BuildEpoch
+	if buildEpoch.IsZero() {
+		buildEpoch = time.Now()
+	}
+	languages := make([]any, len(w.meta.Languages))
+	for i, l := range w.meta.Languages {
+		languages[i] = l
+	}
+	description := make(map[string]any, len(w.meta.Description))
+	for k, v := range w.meta.Description {
+		description[k] = v
+	}
+	if err := encode(&buf, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(buildEpoch.Unix()),
+		"database_type":               w.meta.DatabaseType,
+		"description":                 description,
+		"ip_version":                  uint16(6),
+		"languages":                   languages,
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+	}); err != nil {
+		return 0, err
+	}
+
+	n, err := out.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// aliasIPv4 points ::ffff:0:0/96 at the IPv4 subtree (::/96).
+func (w *Writer) aliasIPv4() {
+	n := w.root
+	for depth := 0; depth < 95; depth++ {
+		r := &n.children[0]
+		if r.node == nil {
+			r.node = &treeNode{children: [2]treeRecord{{value: r.value}, {value: r.value}}}
+			r.value = 0
+		}
+		n = r.node
+	}
+	ipv4 := n.children[0]
+	w.root.insert(ipv4Mapped, 0, 96, ipv4)
+}
+
+// putNode encodes the left and right records of a node into b.
+func putNode(b []byte, recordSize int, left, right uint64) {
+	switch recordSize {
+	case 24:
+		b[0], b[1], b[2] = byte(left>>16), byte(left>>8), byte(left)
+		b[3], b[4], b[5] = byte(right>>16), byte(right>>8), byte(right)
+	case 28:
+		b[0], b[1], b[2] = byte(left>>16), byte(left>>8), byte(left)
+		b[3] = byte(left>>24&0x0f)<<4 | byte(right>>24&0x0f)
+		b[4], b[5], b[6] = byte(right>>16), byte(right>>8), byte(right)
+	case 32:
+		binary.BigEndian.PutUint32(b[0:4], uint32(left))
+		binary.BigEndian.PutUint32(b[4:8], uint32(right))
+	}
+}
+
+// Data section types, as defined by the MaxMind DB format specification.
+const (
+	typeString  = 2
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeUint64  = 9
+	typeArray   = 11
+	typeBoolean = 14
+)
+
+// encode appends the data section encoding of v to buf. Map keys are written
+// in sorted order so equal values encode identically.
+func encode(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case string:
+		writeControl(buf, typeString, len(v))
+		buf.WriteString(v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		writeControl(buf, typeBoolean, size)
+	case uint16:
+		writeUint(buf, typeUint16, uint64(v))
+	case uint32:
+		writeUint(buf, typeUint32, uint64(v))
+	case uint64:
+		writeUint(buf, typeUint64, v)
+	case uint:
+		writeUint(buf, typeUint64, uint64(v))
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		writeControl(buf, typeMap, len(keys))
+		for _, k := range keys {
+			if err := encode(buf, k); err != nil {
+				return err
+			}
+			if err := encode(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		writeControl(buf, typeArray, len(v))
+		for _, item := range v {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported value type %T", v)
+	}
+	return nil
+}
+
+// writeUint writes v with the fewest big-endian bytes.
+func writeUint(buf *bytes.Buffer, typ int, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	size := (64 - bits.LeadingZeros64(v) + 7) / 8
+	writeControl(buf, typ, size)
+	buf.Write(b[8-size:])
+}
+
+// writeControl writes the control byte, the extended type byte and the
+// size bytes of a field.
+func writeControl(buf *bytes.Buffer, typ, size int) {
+	var sizeBits byte
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		sizeBits = byte(size)
+	case size < 29+256:
+		sizeBits = 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 285+65536:
+		sizeBits = 30
+		sizeBytes = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	default:
+		size -= 65821
+		sizeBits = 31
+		sizeBytes = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+	}
+
+	if typ < 8 {
+		buf.WriteByte(byte(typ)<<5 | sizeBits)
+	} else {
+		buf.WriteByte(sizeBits)
+		buf.WriteByte(byte(typ - 7))
+	}
+	buf.Write(sizeBytes)
+}
@@ -0,0 +1,224 @@
+package policy
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/google/cel-go/cel"
+)
+
+// Errors wrapped by Expression.Eval, telling a request that lacks an
+// attribute apart from an expression that failed on valid input.
+var (
+	ErrMissingAttribute = errors.New("missing attribute")
+	ErrExpressionFailed = errors.New("expression failed")
+)
+
+// MaxExpressionLength is the longest expression source, in bytes, that is
+// compiled. Longer sources are rejected before parsing.
+const MaxExpressionLength = 4096
+
+// DefaultExpressionCacheSize is how many compiled inline expressions a
+// Resolver keeps.
+const DefaultExpressionCacheSize = 256
+
+// expressionCostLimit bounds the evaluation cost of an expression, so that
+// an inline expression cannot tie up a check with huge comprehensions.
+const expressionCostLimit = 100000
+
+// expressionEnv declares the variables of the lookup context that
+// expressions are evaluated over. The names are those of the check
+// response fields.
+var expressionEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.OptionalTypes(),
+		cel.Variable("country", cel.StringType),
+		cel.Variable("continent", cel.StringType),
+		cel.Variable("registered_country", cel.StringType),
+		cel.Variable("represented_country", cel.StringType),
+		cel.Variable("is_in_european_union", cel.BoolType),
+		cel.Variable("is_anonymous_proxy", cel.BoolType),
+		cel.Variable("is_satellite_provider", cel.BoolType),
+		cel.Variable("subdivisions", cel.ListType(cel.StringType)),
+		cel.Variable("city", cel.StringType),
+		cel.Variable("asn", cel.IntType),
+		cel.Variable("as_organization", cel.StringType),
+		cel.Variable("is_anonymous", cel.BoolType),
+		cel.Variable("is_vpn", cel.BoolType),
+		cel.Variable("is_hosting_provider", cel.BoolType),
+		cel.Variable("is_public_proxy", cel.BoolType),
+		cel.Variable("is_residential_proxy", cel.BoolType),
+		cel.Variable("is_tor_exit_node", cel.BoolType),
+		cel.Variable("attributes", cel.MapType(cel.StringType, cel.StringType)),
+	)
+})
+
+// Expression is a compiled CEL expression over the lookup result of a check
+// and the attributes supplied by the client, e.g.
+//
+//	country in ["DE", "AT"] && !is_anonymous ||
+//	country == "US" && !(asn in [16509, 14061])
+//
+// It must evaluate to a bool; true allows the IP.
+type Expression struct {
+	source  string
+	program cel.Program
+}
+
+// CompileExpression parses and type-checks a CEL expression of at most
+// MaxExpressionLength bytes.
+func CompileExpression(source string) (*Expression, error) {
+	if len(source) > MaxExpressionLength {
+		return nil, fmt.Errorf("invalid expression: longer than %d bytes", MaxExpressionLength)
+	}
+	env, err := expressionEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.Compile(source)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("invalid expression: %w", iss.Err())
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("invalid expression: must evaluate to a bool, not %s", ast.OutputType())
+	}
+	program, err := env.Program(ast, cel.CostLimit(expressionCostLimit))
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %w", err)
+	}
+	return &Expression{source: source, program: program}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// UnmarshalYAML compiles the expression of a policy file, so that invalid
+// expressions are rejected when the policy is loaded.
+func (e *Expression) UnmarshalYAML(unmarshal func(any) error) error {
+	var source string
+	if err := unmarshal(&source); err != nil {
+		return err
+	}
+	compiled, err := CompileExpression(source)
+	if err != nil {
+		return err
+	}
+	*e = *compiled
+	return nil
+}
+
+// Eval evaluates the expression against the lookup result and the client
+// attributes. Reading a missing attribute fails with ErrMissingAttribute
+// unless the expression tests for it, e.g. with has(attributes.tier) or
+// attributes[?"tier"]; any other runtime error, such as an overflow or
+// exceeding the cost limit, fails with ErrExpressionFailed.
+func (e *Expression) Eval(result *data.LookupResult, attributes map[string]string) (bool, error) {
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	subdivisions := result.Subdivisions
+	if subdivisions == nil {
+		subdivisions = []string{}
+	}
+	continent, inEU := region(result)
+	a := result.Anonymous
+	out, _, err := e.program.Eval(map[string]any{
+		"country":               result.Country,
+		"continent":             continent,
+		"registered_country":    result.RegisteredCountry,
+		"represented_country":   result.RepresentedCountry,
+		"is_in_european_union":  inEU,
+		"is_anonymous_proxy":    result.IsAnonymousProxy,
+		"is_satellite_provider": result.IsSatelliteProvider,
+		"subdivisions":          subdivisions,
+		"city":                  result.City,
+		"asn":                   int64(result.ASN),
+		"as_organization":       result.ASOrganization,
+		"is_anonymous":          a.IsAnonymous || result.IsAnonymousProxy,
+		"is_vpn":                a.IsAnonymousVPN,
+		"is_hosting_provider":   a.IsHostingProvider,
+		"is_public_proxy":       a.IsPublicProxy,
+		"is_residential_proxy":  a.IsResidentialProxy,
+		"is_tor_exit_node":      a.IsTorExitNode,
+		"attributes":            attributes,
+	})
+	if err != nil {
+		// attributes is the only map the expression can index, so a
+		// missing key is always an attribute the client did not send.
+		if strings.HasPrefix(err.Error(), "no such key") {
+			return false, fmt.Errorf("%w: %v", ErrMissingAttribute, err)
+		}
+		return false, fmt.Errorf("%w: %v", ErrExpressionFailed, err)
+	}
+	allowed, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: result is not a bool", ErrExpressionFailed)
+	}
+	return allowed, nil
+}
+
+// expressionCache keeps the most recently used compiled expressions in a
+// fixed-size LRU keyed by source, so that clients sending the same inline
+// expression with every check compile it once. Compile errors are not
+// cached.
+type expressionCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // values are *Expression
+	lru     *list.List               // most recently used first
+}
+
+func newExpressionCache(size int) *expressionCache {
+	return &expressionCache{
+		size:    max(size, 1),
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// compile returns the cached expression for source, or compiles and caches
+// it.
+func (c *expressionCache) compile(source string) (*Expression, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[source]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*Expression), nil
+	}
+	c.mu.Unlock()
+
+	// Compile outside the lock; concurrent misses of the same source just
+	// compile it twice.
+	expr, err := CompileExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[source]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*Expression), nil
+	}
+	c.entries[source] = c.lru.PushFront(expr)
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*Expression).source)
+	}
+	return expr, nil
+}
+
+// len returns the number of cached expressions.
+func (c *expressionCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,133 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TomasB/geofence/internal/data"
+)
+
+func TestCompileExpression_Invalid(t *testing.T) {
+	for _, source := range []string{
+		`country ==`,           // syntax error
+		`country`,              // not a bool
+		`region == "EU"`,       // undeclared variable
+		`asn == "16509"`,       // type mismatch
+		`attributes.tier == 1`, // attributes are strings
+	} {
+		if _, err := CompileExpression(source); err == nil {
+			t.Errorf("expected an error for %q", source)
+		}
+	}
+}
+
+func TestExpression_Eval(t *testing.T) {
+	expr, err := CompileExpression(`country in ["DE", "AT"] && !is_anonymous ||
+		country == "US" && !(asn in [16509, 14061])`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		result *data.LookupResult
+		want   bool
+	}{
+		{"allowed country", &data.LookupResult{Country: "AT"}, true},
+		{"anonymous proxy", &data.LookupResult{Country: "DE", IsAnonymousProxy: true}, false},
+		{"anonymizer", &data.LookupResult{Country: "DE", Anonymous: data.AnonymousIP{IsAnonymous: true}}, false},
+		{"US residential ASN", &data.LookupResult{Country: "US", ASN: 7922}, true},
+		{"US hosting ASN", &data.LookupResult{Country: "US", ASN: 16509}, false},
+		{"other country", &data.LookupResult{Country: "FR"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expr.Eval(tt.result, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExpression_EvalAttributes(t *testing.T) {
+	result := &data.LookupResult{Country: "GB", Subdivisions: []string{"GB-ENG"}}
+
+	expr, err := CompileExpression(`attributes.tier == "gold" && "GB-ENG" in subdivisions`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	if ok, err := expr.Eval(result, map[string]string{"tier": "gold"}); err != nil || !ok {
+		t.Errorf("expected gold to be allowed, got %v, %v", ok, err)
+	}
+	if _, err := expr.Eval(result, nil); err == nil {
+		t.Error("expected an error for a missing attribute")
+	}
+
+	expr, err = CompileExpression(`attributes[?"tier"].orValue("free") != "free"`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	if ok, err := expr.Eval(result, nil); err != nil || ok {
+		t.Errorf("expected the default tier to be denied, got %v, %v", ok, err)
+	}
+}
+
+func TestExpression_EvalStaticRegion(t *testing.T) {
+	expr, err := CompileExpression(`is_in_european_union && continent == "EU"`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	// An override carries only the country.
+	override := &data.LookupResult{Country: "DE", Override: &data.Override{Country: "DE"}}
+	if got, err := expr.Eval(override, nil); err != nil || !got {
+		t.Errorf("expected the override to be in the EU, got %v (%v)", got, err)
+	}
+	if got, err := expr.Eval(&data.LookupResult{Country: "CH"}, nil); err != nil || got {
+		t.Errorf("expected CH to be outside the EU, got %v (%v)", got, err)
+	}
+}
+
+func TestCompileExpression_TooLong(t *testing.T) {
+	source := `country == "US"` + strings.Repeat(" ", MaxExpressionLength)
+	if _, err := CompileExpression(source); err == nil || !strings.Contains(err.Error(), "longer than") {
+		t.Errorf("expected the oversize expression to be rejected, got %v", err)
+	}
+}
+
+func TestResolver_ExpressionCache(t *testing.T) {
+	r := NewResolver(nil, nil, WithExpressionCacheSize(2))
+
+	first, err := r.Expression(`country == "US"`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	if again, _ := r.Expression(`country == "US"`); again != first {
+		t.Error("expected the cached expression to be reused")
+	}
+	if _, err := r.Expression(`country`); err == nil {
+		t.Error("expected an error for a non-bool expression")
+	}
+	if n := r.expressions.len(); n != 1 {
+		t.Errorf("expected errors not to be cached, got %d entries", n)
+	}
+
+	// Two more expressions evict the least recently used one.
+	r.Expression(`country == "DE"`)
+	r.Expression(`country == "FR"`)
+	if n := r.expressions.len(); n != 2 {
+		t.Errorf("expected 2 cached expressions, got %d", n)
+	}
+	if again, _ := r.Expression(`country == "US"`); again == first {
+		t.Error("expected the evicted expression to be compiled again")
+	}
+
+	var none *Resolver
+	if _, err := none.Expression(`country == "US"`); err != nil {
+		t.Errorf("expected a nil resolver to compile, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/TomasB/geofence/internal/data"
+)
+
+// Built-in group tokens, accepted wherever a country code is. They are
+// matched against the attributes of the lookup result rather than expanded,
+// so they follow the database: a country that joins the EU matches "EU" as
+// soon as the database says so. Results without a database record, such as
+// overrides and class countries, are matched against static tables.
+const (
+	// GroupEU matches the member states of the European Union, as flagged
+	// by the database (LookupResult.IsInEuropeanUnion).
+	GroupEU = "EU"
+	// GroupEEA matches the European Economic Area: the EU plus Iceland,
+	// Liechtenstein and Norway.
+	GroupEEA = "EEA"
+	// GroupContinentPrefix followed by a continent code (AF, AN, AS, EU,
+	// NA, OC, SA) matches the countries of that continent, e.g.
+	// "CONTINENT:EU" for Europe.
+	GroupContinentPrefix = "CONTINENT:"
+)
+
+// eeaNonEU lists the EEA members outside the EU.
+var eeaNonEU = []string{"IS", "LI", "NO"}
+
+// continents lists the continent codes of the MaxMind databases.
+var continents = []string{"AF", "AN", "AS", "EU", "NA", "OC", "SA"}
+
+// isBuiltinGroup reports whether entry is a built-in group token.
+func isBuiltinGroup(entry string) bool {
+	entry = strings.ToUpper(entry)
+	if entry == GroupEU || entry == GroupEEA {
+		return true
+	}
+	code, ok := strings.CutPrefix(entry, GroupContinentPrefix)
+	return ok && slices.Contains(continents, code)
+}
+
+// matchesCountry reports whether any entry of list, a country code or a
+// built-in group, contains the country of the result.
+func matchesCountry(list []string, result *data.LookupResult) bool {
+	continent, inEU := region(result)
+	for _, entry := range list {
+		if entry == result.Country {
+			return true
+		}
+		switch upper := strings.ToUpper(entry); {
+		case upper == GroupEU:
+			if inEU {
+				return true
+			}
+		case upper == GroupEEA:
+			if inEU || slices.Contains(eeaNonEU, result.Country) {
+				return true
+			}
+		case strings.HasPrefix(upper, GroupContinentPrefix):
+			if continent != "" && upper[len(GroupContinentPrefix):] == continent {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Groups maps the names of custom country groups, such as "DACH", to their
+// member countries. Names are upper case.
+type Groups map[string][]string
+
+// ParseGroups parses a semicolon-separated list of name=countries pairs,
+// with comma-separated countries, e.g.
+// "DACH=DE,AT,CH;NORDICS=DK,FI,IS,NO,SE". Members are country codes in any
+// form data.NormalizeCountry accepts. Names are case-insensitive and must
+// not be a country code or a built-in group, so that they never shadow one.
+func ParseGroups(s string) (Groups, error) {
+	groups := make(Groups)
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, members, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid country group %q: expected name=countries", entry)
+		}
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if _, isCountry := data.NormalizeCountry(name); len(name) <= 2 || isCountry || isBuiltinGroup(name) {
+			return nil, fmt.Errorf("invalid country group %q: name must be longer than two letters and not a country code or a built-in group", entry)
+		}
+		if _, dup := groups[name]; dup {
+			return nil, fmt.Errorf("invalid country group %q: duplicate name", entry)
+		}
+
+		var countries []string
+		for _, c := range strings.Split(members, ",") {
+			country, ok := data.NormalizeCountry(c)
+			if !ok {
+				return nil, fmt.Errorf("invalid country group %q: unknown country code %q", entry, strings.TrimSpace(c))
+			}
+			countries = append(countries, country)
+		}
+		groups[name] = countries
+	}
+	return groups, nil
+}
+
+// normalize returns list with country codes in their alpha-2 form,
+// built-in groups in upper case and custom groups replaced by their
+// members, and the entries that are none of these.
+func (g Groups) normalize(list []string) (normalized, invalid []string) {
+	normalized = make([]string, 0, len(list))
+	for _, entry := range list {
+		upper := strings.ToUpper(strings.TrimSpace(entry))
+		if country, ok := data.NormalizeCountry(upper); ok {
+			normalized = append(normalized, country)
+		} else if isBuiltinGroup(upper) {
+			normalized = append(normalized, upper)
+		} else if members, ok := g[upper]; ok {
+			normalized = append(normalized, members...)
+		} else {
+			invalid = append(invalid, entry)
+		}
+	}
+	return normalized, invalid
+}
+
+// normalizeRules normalizes the country lists of rules. It fails with an
+// *UnknownCountriesError listing every unknown entry of both lists.
+func (g Groups) normalizeRules(rules Rules) (Rules, error) {
+	var allowedInvalid, blockedInvalid []string
+	if rules.AllowedCountries != nil {
+		rules.AllowedCountries, allowedInvalid = g.normalize(rules.AllowedCountries)
+	}
+	if rules.BlockedCountries != nil {
+		rules.BlockedCountries, blockedInvalid = g.normalize(rules.BlockedCountries)
+	}
+	if invalid := append(allowedInvalid, blockedInvalid...); len(invalid) > 0 {
+		fields := slices.Concat(
+			slices.Repeat([]string{"allowed_countries"}, len(allowedInvalid)),
+			slices.Repeat([]string{"blocked_countries"}, len(blockedInvalid)),
+		)
+		return Rules{}, &UnknownCountriesError{Entries: invalid, Fields: fields}
+	}
+	return rules, nil
+}
@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/TomasB/geofence/internal/data"
+)
+
+func TestMatchesCountry(t *testing.T) {
+	germany := &data.LookupResult{Country: "DE", Continent: "EU", IsInEuropeanUnion: true}
+	norway := &data.LookupResult{Country: "NO", Continent: "EU"}
+	swiss := &data.LookupResult{Country: "CH", Continent: "EU"}
+	japan := &data.LookupResult{Country: "JP", Continent: "AS"}
+	csvOnly := &data.LookupResult{Country: "DE"}
+	override := &data.LookupResult{Country: "DE", Override: &data.Override{Country: "DE"}}
+	classCountry := &data.LookupResult{Country: "NO", AddressClass: data.ClassCGNAT, ClassAction: data.ClassCountry}
+	// The database record wins over the static tables.
+	recorded := &data.LookupResult{Country: "DE", Continent: "EU"}
+
+	tests := []struct {
+		name   string
+		list   []string
+		result *data.LookupResult
+		want   bool
+	}{
+		{"country", []string{"US", "DE"}, germany, true},
+		{"EU member", []string{"EU"}, germany, true},
+		{"EU non-member", []string{"EU"}, norway, false},
+		{"EEA via EU", []string{"EEA"}, germany, true},
+		{"EEA outside EU", []string{"eea"}, norway, true},
+		{"not EEA", []string{"EEA"}, swiss, false},
+		{"continent", []string{"CONTINENT:EU"}, swiss, true},
+		{"continent case-insensitive", []string{"continent:as"}, japan, true},
+		{"other continent", []string{"CONTINENT:EU"}, japan, false},
+		{"CSV result in EU", []string{"EU"}, csvOnly, true},
+		{"override in EU", []string{"EU"}, override, true},
+		{"override on continent", []string{"CONTINENT:EU"}, override, true},
+		{"override on other continent", []string{"CONTINENT:NA"}, override, false},
+		{"class country in EEA", []string{"EEA"}, classCountry, true},
+		{"class country outside EU", []string{"EU"}, classCountry, false},
+		{"database record wins", []string{"EU"}, recorded, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesCountry(tt.list, tt.result); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	groups, err := ParseGroups("dach=de, AUT,756 ; NORDICS=DK,FI,IS,NO,SE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %v", groups)
+	}
+	if !slices.Equal(groups["DACH"], []string{"DE", "AT", "CH"}) {
+		t.Errorf("unexpected DACH members %v", groups["DACH"])
+	}
+
+	if groups, err := ParseGroups(""); err != nil || len(groups) != 0 {
+		t.Errorf("expected no groups, got %v, %v", groups, err)
+	}
+
+	for _, invalid := range []string{"DACH", "DA=DE,AT", "EEA=IS,LI,NO", "continent:eu=DE", "DACH=DE,AUX", "USA=US", "DACH=DE;DACH=AT"} {
+		if _, err := ParseGroups(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestContinentCountries(t *testing.T) {
+	for _, country := range data.CountryCodes() {
+		if countryContinent[country] == "" {
+			t.Errorf("%s has no continent", country)
+		}
+	}
+	for _, country := range euMembers {
+		if countryContinent[country] != "EU" {
+			t.Errorf("EU member %s is not in Europe", country)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, countries := range continentCountries {
+		for _, country := range countries {
+			if seen[country] {
+				t.Errorf("%s is listed twice", country)
+			}
+			seen[country] = true
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package policy evaluates geofence rules against lookup results. It is
+// shared by the REST and gRPC handlers so both APIs make identical decisions.
+package policy
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/TomasB/geofence/internal/data"
+)
+
+// Rules holds the allow/deny constraints of a single check request. The
+// yaml tags name the fields of policy files (see Store).
+type Rules struct {
+	// AllowedCountries lists the ISO-3166-1 alpha-2 codes that are allowed.
+	// When it is empty, every country that is not blocked is allowed.
+	AllowedCountries []string `yaml:"allowed_countries"`
+	// BlockedCountries lists the ISO-3166-1 alpha-2 codes that are always
+	// denied, even if they are also allowed.
+	BlockedCountries []string `yaml:"blocked_countries"`
+	// AllowedSubdivisions lists ISO-3166-2 codes (e.g. "US-CA"). An entry
+	// narrows its country: once a country has subdivision entries, only
+	// those subdivisions of it are allowed.
+	AllowedSubdivisions []string `yaml:"allowed_subdivisions"`
+	// BlockedSubdivisions lists ISO-3166-2 codes that are always denied.
+	BlockedSubdivisions []string `yaml:"blocked_subdivisions"`
+	// AllowedCities lists city names; when set, the IP must be in one of them.
+	AllowedCities []string `yaml:"allowed_cities"`
+	// BlockedCities lists city names that are always denied.
+	BlockedCities []string `yaml:"blocked_cities"`
+	// AllowedASNs lists autonomous system numbers; when set, the IP must be
+	// announced by one of them.
+	AllowedASNs []uint32 `yaml:"allowed_asns"`
+	// BlockedASNs lists autonomous system numbers that are always denied.
+	BlockedASNs []uint32 `yaml:"blocked_asns"`
+	// DenyAnonymous denies any anonymizing network, including IPs flagged
+	// as anonymous proxies by the Country database.
+	DenyAnonymous bool `yaml:"deny_anonymous"`
+	// DenyVPN denies anonymous VPN providers.
+	DenyVPN bool `yaml:"deny_vpn"`
+	// DenyTorExitNode denies Tor exit nodes.
+	DenyTorExitNode bool `yaml:"deny_tor_exit_node"`
+	// DenyHostingProvider denies hosting and cloud providers.
+	DenyHostingProvider bool `yaml:"deny_hosting_provider"`
+	// DenyPublicProxy denies public proxies.
+	DenyPublicProxy bool `yaml:"deny_public_proxy"`
+	// DenyResidentialProxy denies residential proxy networks.
+	DenyResidentialProxy bool `yaml:"deny_residential_proxy"`
+	// RequireUnanimous denies IPs whose country the sources of a consensus
+	// lookup disagree on. It has no effect on single-source lookups.
+	RequireUnanimous bool `yaml:"require_unanimous"`
+	// Expression, when set, must also allow the IP. It is checked after
+	// every other rule and counts as an allow rule; false is a deny match.
+	// Like every other rule, it does not apply to special-purpose addresses
+	// whose class policy allows or denies them.
+	Expression *Expression `yaml:"expression"`
+}
+
+// IsZero reports whether no rule is set.
+func (r *Rules) IsZero() bool {
+	return reflect.ValueOf(*r).IsZero()
+}
+
+// IsEmpty reports whether the rules constrain nothing: every list is empty
+// and every flag is off. Unlike IsZero, it treats empty lists as unset.
+func (r *Rules) IsEmpty() bool {
+	return len(r.AllowedCountries) == 0 && len(r.BlockedCountries) == 0 &&
+		len(r.AllowedSubdivisions) == 0 && len(r.BlockedSubdivisions) == 0 &&
+		len(r.AllowedCities) == 0 && len(r.BlockedCities) == 0 &&
+		len(r.AllowedASNs) == 0 && len(r.BlockedASNs) == 0 &&
+		!r.DenyAnonymous && !r.DenyVPN && !r.DenyTorExitNode &&
+		!r.DenyHostingProvider && !r.DenyPublicProxy && !r.DenyResidentialProxy &&
+		!r.RequireUnanimous && r.Expression == nil
+}
+
+// Reason says which kind of rule decided a check.
+type Reason string
+
+const (
+	// ReasonAllowMatch means the IP matched the allow lists.
+	ReasonAllowMatch Reason = "allow_match"
+	// ReasonDenyMatch means the IP matched a deny rule, such as a blocked
+	// country or a denied anonymizer.
+	ReasonDenyMatch Reason = "deny_match"
+	// ReasonDefault means no rule matched: the IP is denied if an allow
+	// list missed it or its country is unknown, and allowed if only deny
+	// rules were given.
+	ReasonDefault Reason = "default"
+)
+
+// Decision is the outcome of evaluating Rules against a lookup result.
+type Decision struct {
+	Allowed bool
+	Reason  Reason
+	// Subdivision is the ISO-3166-2 code that matched a subdivision rule,
+	// or the most general subdivision of the result when no rule matched.
+	Subdivision string
+	// Err is set if the expression could not be evaluated, wrapping
+	// ErrMissingAttribute or ErrExpressionFailed. No decision was made
+	// then: callers must report the error instead of Allowed.
+	Err error
+}
+
+// Evaluate decides whether the lookup result satisfies the rules, with
+// attributes being the client attributes the expression may refer to. Deny
+// rules win over allow lists: a country that is both allowed and blocked
+// is denied. IPs without a country are denied with ReasonDefault.
+// Special-purpose addresses with an allow or deny class policy are decided
+// by it alone, before any rule including the expression: the operator's
+// class configuration wins over per-request rules.
+func Evaluate(rules Rules, result *data.LookupResult, attributes map[string]string) Decision {
+	d := Decision{Reason: ReasonDefault}
+	if len(result.Subdivisions) > 0 {
+		d.Subdivision = result.Subdivisions[0]
+	}
+
+	// Special-purpose addresses are allowed or denied by their class
+	// policy, unless it maps them to a country.
+	if result.AddressClass != "" {
+		switch result.ClassAction {
+		case data.ClassAllow:
+			d.Allowed, d.Reason = true, ReasonAllowMatch
+			return d
+		case data.ClassDeny:
+			d.Reason = ReasonDenyMatch
+			return d
+		}
+	}
+
+	// An IP the database has no country for cannot be checked against any
+	// country rule, so it is denied even by deny-only rules: a sanctions
+	// list must not fail open.
+	if result.Country == "" {
+		return d
+	}
+	if matchesCountry(rules.BlockedCountries, result) {
+		d.Reason = ReasonDenyMatch
+		return d
+	}
+	if len(rules.AllowedCountries) > 0 && !matchesCountry(rules.AllowedCountries, result) {
+		return d
+	}
+	if rules.RequireUnanimous && result.Consensus != nil && !result.Consensus.Unanimous() {
+		d.Reason = ReasonDenyMatch
+		return d
+	}
+
+	for _, sub := range result.Subdivisions {
+		if containsFold(rules.BlockedSubdivisions, sub) {
+			d.Subdivision = sub
+			d.Reason = ReasonDenyMatch
+			return d
+		}
+	}
+	if (result.City != "" && containsFold(rules.BlockedCities, result.City)) ||
+		(result.ASN != 0 && slices.Contains(rules.BlockedASNs, result.ASN)) ||
+		deniesAnonymity(rules, result) {
+		d.Reason = ReasonDenyMatch
+		return d
+	}
+
+	// The IP passed every deny rule; it is allowed by a match if any allow
+	// list applied, and by default otherwise.
+	allowMatch := len(rules.AllowedCountries) > 0
+	if restrictsCountry(rules.AllowedSubdivisions, result.Country) {
+		matched := ""
+		for _, sub := range result.Subdivisions {
+			if containsFold(rules.AllowedSubdivisions, sub) {
+				matched = sub
+				break
+			}
+		}
+		if matched == "" {
+			return d
+		}
+		d.Subdivision = matched
+		allowMatch = true
+	}
+	if len(rules.AllowedCities) > 0 {
+		if !containsFold(rules.AllowedCities, result.City) {
+			return d
+		}
+		allowMatch = true
+	}
+	if len(rules.AllowedASNs) > 0 {
+		if !slices.Contains(rules.AllowedASNs, result.ASN) {
+			return d
+		}
+		allowMatch = true
+	}
+	if rules.Expression != nil {
+		allowed, err := rules.Expression.Eval(result, attributes)
+		if err != nil {
+			d.Err = err
+			return d
+		}
+		if !allowed {
+			d.Reason = ReasonDenyMatch
+			return d
+		}
+		allowMatch = true
+	}
+
+	d.Allowed = true
+	if allowMatch {
+		d.Reason = ReasonAllowMatch
+	}
+	return d
+}
+
+// deniesAnonymity reports whether any anonymizer flag of the result is
+// denied by the rules.
+func deniesAnonymity(rules Rules, result *data.LookupResult) bool {
+	a := result.Anonymous
+	return (rules.DenyAnonymous && (a.IsAnonymous || result.IsAnonymousProxy)) ||
+		(rules.DenyVPN && a.IsAnonymousVPN) ||
+		(rules.DenyTorExitNode && a.IsTorExitNode) ||
+		(rules.DenyHostingProvider && a.IsHostingProvider) ||
+		(rules.DenyPublicProxy && a.IsPublicProxy) ||
+		(rules.DenyResidentialProxy && a.IsResidentialProxy)
+}
+
+// restrictsCountry reports whether any ISO-3166-2 code in subdivisions
+// belongs to the given country.
+func restrictsCountry(subdivisions []string, country string) bool {
+	if country == "" {
+		return false
+	}
+	prefix := country + "-"
+	for _, s := range subdivisions {
+		if len(s) > len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/TomasB/geofence/internal/data"
+)
+
+func TestEvaluate(t *testing.T) {
+	boxford := &data.LookupResult{Country: "GB", Subdivisions: []string{"GB-ENG", "GB-WBK"}, City: "Boxford"}
+	milton := &data.LookupResult{Country: "US", Subdivisions: []string{"US-WA"}, City: "Milton"}
+	countryOnly := &data.LookupResult{Country: "US"}
+	hosted := &data.LookupResult{Country: "DE", ASN: 24940, ASOrganization: "Hetzner Online GmbH"}
+	tor := &data.LookupResult{Country: "DE", Anonymous: data.AnonymousIP{IsAnonymous: true, IsTorExitNode: true}}
+	proxy := &data.LookupResult{Country: "BT", IsAnonymousProxy: true}
+	disputed := &data.LookupResult{Country: "US", Consensus: &data.Consensus{Agreement: 2.0 / 3}}
+	agreed := &data.LookupResult{Country: "US", Consensus: &data.Consensus{Agreement: 1}}
+	private := &data.LookupResult{AddressClass: data.ClassPrivate, ClassAction: data.ClassAllow}
+	loopback := &data.LookupResult{AddressClass: data.ClassLoopback, ClassAction: data.ClassDeny}
+	cgnat := &data.LookupResult{Country: "US", AddressClass: data.ClassCGNAT, ClassAction: data.ClassCountry}
+
+	tests := []struct {
+		name            string
+		rules           Rules
+		result          *data.LookupResult
+		wantAllowed     bool
+		wantSubdivision string
+	}{
+		{
+			name:            "country allowed",
+			rules:           Rules{AllowedCountries: []string{"GB"}},
+			result:          boxford,
+			wantAllowed:     true,
+			wantSubdivision: "GB-ENG",
+		},
+		{
+			name:            "country denied",
+			rules:           Rules{AllowedCountries: []string{"US"}},
+			result:          boxford,
+			wantSubdivision: "GB-ENG",
+		},
+		{
+			name:            "subdivision allowed",
+			rules:           Rules{AllowedCountries: []string{"US"}, AllowedSubdivisions: []string{"US-CA", "US-WA"}},
+			result:          milton,
+			wantAllowed:     true,
+			wantSubdivision: "US-WA",
+		},
+		{
+			name:            "subdivision not in allow list",
+			rules:           Rules{AllowedCountries: []string{"US"}, AllowedSubdivisions: []string{"US-CA", "US-NY"}},
+			result:          milton,
+			wantSubdivision: "US-WA",
+		},
+		{
+			name:            "nested subdivision allowed case-insensitively",
+			rules:           Rules{AllowedCountries: []string{"GB"}, AllowedSubdivisions: []string{"gb-wbk"}},
+			result:          boxford,
+			wantAllowed:     true,
+			wantSubdivision: "GB-WBK",
+		},
+		{
+			name:            "subdivision entries of other countries do not restrict",
+			rules:           Rules{AllowedCountries: []string{"US", "GB"}, AllowedSubdivisions: []string{"US-CA"}},
+			result:          boxford,
+			wantAllowed:     true,
+			wantSubdivision: "GB-ENG",
+		},
+		{
+			name:            "subdivision blocked",
+			rules:           Rules{AllowedCountries: []string{"GB"}, BlockedSubdivisions: []string{"GB-WBK"}},
+			result:          boxford,
+			wantSubdivision: "GB-WBK",
+		},
+		{
+			name:   "country-only result fails subdivision allow list",
+			rules:  Rules{AllowedCountries: []string{"US"}, AllowedSubdivisions: []string{"US-WA"}},
+			result: countryOnly,
+		},
+		{
+			name:            "city allowed",
+			rules:           Rules{AllowedCountries: []string{"US"}, AllowedCities: []string{"milton"}},
+			result:          milton,
+			wantAllowed:     true,
+			wantSubdivision: "US-WA",
+		},
+		{
+			name:            "city not in allow list",
+			rules:           Rules{AllowedCountries: []string{"US"}, AllowedCities: []string{"Seattle"}},
+			result:          milton,
+			wantSubdivision: "US-WA",
+		},
+		{
+			name:            "city blocked",
+			rules:           Rules{AllowedCountries: []string{"GB"}, BlockedCities: []string{"Boxford"}},
+			result:          boxford,
+			wantSubdivision: "GB-ENG",
+		},
+		{
+			name:        "asn allowed",
+			rules:       Rules{AllowedCountries: []string{"DE"}, AllowedASNs: []uint32{3320, 24940}},
+			result:      hosted,
+			wantAllowed: true,
+		},
+		{
+			name:   "asn not in allow list",
+			rules:  Rules{AllowedCountries: []string{"DE"}, AllowedASNs: []uint32{3320}},
+			result: hosted,
+		},
+		{
+			name:   "asn blocked while country allowed",
+			rules:  Rules{AllowedCountries: []string{"DE"}, BlockedASNs: []uint32{24940}},
+			result: hosted,
+		},
+		{
+			name:   "unknown asn fails asn allow list",
+			rules:  Rules{AllowedCountries: []string{"US"}, AllowedASNs: []uint32{3320}},
+			result: countryOnly,
+		},
+		{
+			name:   "tor exit node denied",
+			rules:  Rules{AllowedCountries: []string{"DE"}, DenyTorExitNode: true},
+			result: tor,
+		},
+		{
+			name:        "tor exit node allowed when only vpn denied",
+			rules:       Rules{AllowedCountries: []string{"DE"}, DenyVPN: true},
+			result:      tor,
+			wantAllowed: true,
+		},
+		{
+			name:   "any anonymizer denied",
+			rules:  Rules{AllowedCountries: []string{"DE"}, DenyAnonymous: true},
+			result: tor,
+		},
+		{
+			name:   "country database anonymous proxy denied",
+			rules:  Rules{AllowedCountries: []string{"BT"}, DenyAnonymous: true},
+			result: proxy,
+		},
+		{
+			name:        "majority country allowed",
+			rules:       Rules{AllowedCountries: []string{"US"}},
+			result:      disputed,
+			wantAllowed: true,
+		},
+		{
+			name:   "unanimity required",
+			rules:  Rules{AllowedCountries: []string{"US"}, RequireUnanimous: true},
+			result: disputed,
+		},
+		{
+			name:        "unanimous sources allowed",
+			rules:       Rules{AllowedCountries: []string{"US"}, RequireUnanimous: true},
+			result:      agreed,
+			wantAllowed: true,
+		},
+		{
+			name:        "unanimity ignored without consensus",
+			rules:       Rules{AllowedCountries: []string{"US"}, RequireUnanimous: true},
+			result:      countryOnly,
+			wantAllowed: true,
+		},
+		{
+			name:   "country blocked",
+			rules:  Rules{BlockedCountries: []string{"US"}},
+			result: countryOnly,
+		},
+		{
+			name:        "country not blocked",
+			rules:       Rules{BlockedCountries: []string{"RU"}},
+			result:      countryOnly,
+			wantAllowed: true,
+		},
+		{
+			name:   "blocked country wins over allowed",
+			rules:  Rules{AllowedCountries: []string{"US"}, BlockedCountries: []string{"US"}},
+			result: countryOnly,
+		},
+		{
+			name:            "deny list with allowed city",
+			rules:           Rules{BlockedCountries: []string{"RU"}, AllowedCities: []string{"Milton"}},
+			result:          milton,
+			wantAllowed:     true,
+			wantSubdivision: "US-WA",
+		},
+		{
+			name:        "address class allowed",
+			rules:       Rules{AllowedCountries: []string{"US"}},
+			result:      private,
+			wantAllowed: true,
+		},
+		{
+			name:   "address class denied",
+			rules:  Rules{AllowedCountries: []string{"US"}},
+			result: loopback,
+		},
+		{
+			name:        "address class country allowed",
+			rules:       Rules{AllowedCountries: []string{"US"}},
+			result:      cgnat,
+			wantAllowed: true,
+		},
+		{
+			name:   "address class country denied",
+			rules:  Rules{AllowedCountries: []string{"GB"}},
+			result: cgnat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Evaluate(tt.rules, tt.result, nil)
+			if d.Allowed != tt.wantAllowed {
+				t.Errorf("expected allowed=%v, got %v", tt.wantAllowed, d.Allowed)
+			}
+			if d.Subdivision != tt.wantSubdivision {
+				t.Errorf("expected subdivision %q, got %q", tt.wantSubdivision, d.Subdivision)
+			}
+		})
+	}
+}
+
+func TestEvaluate_Reason(t *testing.T) {
+	milton := &data.LookupResult{Country: "US", Subdivisions: []string{"US-WA"}, City: "Milton", ASN: 7922}
+
+	tests := []struct {
+		name  string
+		rules Rules
+		want  Reason
+	}{
+		{"allowed country", Rules{AllowedCountries: []string{"US"}}, ReasonAllowMatch},
+		{"country not allowed", Rules{AllowedCountries: []string{"GB"}}, ReasonDefault},
+		{"blocked country", Rules{BlockedCountries: []string{"US"}}, ReasonDenyMatch},
+		{"country not blocked", Rules{BlockedCountries: []string{"RU"}}, ReasonDefault},
+		{"blocked over allowed", Rules{AllowedCountries: []string{"US"}, BlockedCountries: []string{"US"}}, ReasonDenyMatch},
+		{"blocked subdivision", Rules{AllowedCountries: []string{"US"}, BlockedSubdivisions: []string{"US-WA"}}, ReasonDenyMatch},
+		{"blocked ASN", Rules{BlockedCountries: []string{"RU"}, BlockedASNs: []uint32{7922}}, ReasonDenyMatch},
+		{"subdivision not allowed", Rules{AllowedCountries: []string{"US"}, AllowedSubdivisions: []string{"US-CA"}}, ReasonDefault},
+		{"allowed city without allowed countries", Rules{BlockedCountries: []string{"RU"}, AllowedCities: []string{"Milton"}}, ReasonAllowMatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := Evaluate(tt.rules, milton, nil); d.Reason != tt.want {
+				t.Errorf("expected reason %q, got %q", tt.want, d.Reason)
+			}
+		})
+	}
+
+	private := &data.LookupResult{AddressClass: data.ClassPrivate, ClassAction: data.ClassAllow}
+	if d := Evaluate(Rules{AllowedCountries: []string{"US"}}, private, nil); d.Reason != ReasonAllowMatch {
+		t.Errorf("expected the class policy to be an allow match, got %q", d.Reason)
+	}
+}
+
+func TestEvaluate_UnknownCountry(t *testing.T) {
+	unknown := &data.LookupResult{}
+	for name, rules := range map[string]Rules{
+		"allow list":  {AllowedCountries: []string{"US"}},
+		"deny list":   {BlockedCountries: []string{"RU"}},
+		"blocked ASN": {BlockedASNs: []uint32{7922}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if d := Evaluate(rules, unknown, nil); d.Allowed || d.Reason != ReasonDefault {
+				t.Errorf("expected a default deny, got %+v", d)
+			}
+		})
+	}
+
+	// A class policy that maps the address to a country is evaluated.
+	cgnat := &data.LookupResult{Country: "US", AddressClass: data.ClassCGNAT, ClassAction: data.ClassCountry}
+	if d := Evaluate(Rules{BlockedCountries: []string{"RU"}}, cgnat, nil); !d.Allowed {
+		t.Errorf("expected the class country to be allowed, got %+v", d)
+	}
+}
+
+func TestEvaluate_Expression(t *testing.T) {
+	expr, err := CompileExpression(`!is_vpn && attributes[?"tier"].orValue("") == "gold"`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	gold := map[string]string{"tier": "gold"}
+	us := &data.LookupResult{Country: "US"}
+
+	if d := Evaluate(Rules{Expression: expr}, us, gold); !d.Allowed || d.Reason != ReasonAllowMatch {
+		t.Errorf("expected an allow match, got %+v", d)
+	}
+	if d := Evaluate(Rules{Expression: expr}, us, nil); d.Allowed || d.Reason != ReasonDenyMatch {
+		t.Errorf("expected the expression to deny, got %+v", d)
+	}
+	if d := Evaluate(Rules{BlockedCountries: []string{"US"}, Expression: expr}, us, gold); d.Allowed || d.Reason != ReasonDenyMatch {
+		t.Errorf("expected deny rules to win over the expression, got %+v", d)
+	}
+
+	strict, err := CompileExpression(`attributes.tier == "gold"`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	if d := Evaluate(Rules{Expression: strict}, us, nil); d.Allowed || !errors.Is(d.Err, ErrMissingAttribute) {
+		t.Errorf("expected a missing attribute error, got %+v", d)
+	}
+	overflow, err := CompileExpression(`size(country) * 9223372036854775807 > 0`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	if d := Evaluate(Rules{Expression: overflow}, us, nil); d.Allowed || !errors.Is(d.Err, ErrExpressionFailed) {
+		t.Errorf("expected a failed expression, got %+v", d)
+	}
+
+	// Class policies decide before the expression.
+	private := &data.LookupResult{AddressClass: data.ClassPrivate, ClassAction: data.ClassAllow}
+	if d := Evaluate(Rules{Expression: expr}, private, nil); !d.Allowed {
+		t.Errorf("expected the class policy to allow, got %+v", d)
+	}
+}
+
+func TestEvaluate_GroupsWithoutDatabaseRecord(t *testing.T) {
+	// A Frankfurt VPN overridden to DE.
+	override := &data.LookupResult{Country: "DE", Override: &data.Override{Country: "DE"}}
+	if d := Evaluate(Rules{AllowedCountries: []string{"EU"}}, override, nil); !d.Allowed {
+		t.Errorf("expected the override to match EU, got %+v", d)
+	}
+
+	cgnat := &data.LookupResult{Country: "FR", AddressClass: data.ClassCGNAT, ClassAction: data.ClassCountry}
+	if d := Evaluate(Rules{BlockedCountries: []string{"CONTINENT:EU"}}, cgnat, nil); d.Allowed || d.Reason != ReasonDenyMatch {
+		t.Errorf("expected the class country to match CONTINENT:EU, got %+v", d)
+	}
+}
@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"slices"
+
+	"github.com/TomasB/geofence/internal/data"
+)
+
+// euMembers lists the member states of the European Union.
+var euMembers = []string{
+	"AT", "BE", "BG", "CY", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU",
+	"IE", "IT", "LT", "LU", "LV", "MT", "NL", "PL", "PT", "RO", "SE", "SI", "SK",
+}
+
+// continentCountries lists the countries of each continent, as assigned by
+// the MaxMind databases.
+var continentCountries = map[string][]string{
+	"AF": {
+		"AO", "BF", "BI", "BJ", "BW", "CD", "CF", "CG", "CI", "CM", "CV", "DJ", "DZ", "EG",
+		"EH", "ER", "ET", "GA", "GH", "GM", "GN", "GQ", "GW", "KE", "KM", "LR", "LS", "LY",
+		"MA", "MG", "ML", "MR", "MU", "MW", "MZ", "NA", "NE", "NG", "RE", "RW", "SC", "SD",
+		"SH", "SL", "SN", "SO", "SS", "ST", "SZ", "TD", "TG", "TN", "TZ", "UG", "YT", "ZA",
+		"ZM", "ZW",
+	},
+	"AN": {"AQ", "BV", "GS", "HM", "TF"},
+	"AS": {
+		"AE", "AF", "AM", "AZ", "BD", "BH", "BN", "BT", "CC", "CN", "CX", "GE", "HK", "ID",
+		"IL", "IN", "IO", "IQ", "IR", "JO", "JP", "KG", "KH", "KP", "KR", "KW", "KZ", "LA",
+		"LB", "LK", "MM", "MN", "MO", "MV", "MY", "NP", "OM", "PH", "PK", "PS", "QA", "SA",
+		"SG", "SY", "TH", "TJ", "TL", "TM", "TW", "UZ", "VN", "YE",
+	},
+	"EU": {
+		"AD", "AL", "AT", "AX", "BA", "BE", "BG", "BY", "CH", "CY", "CZ", "DE", "DK", "EE",
+		"ES", "FI", "FO", "FR", "GB", "GG", "GI", "GR", "HR", "HU", "IE", "IM", "IS", "IT",
+		"JE", "LI", "LT", "LU", "LV", "MC", "MD", "ME", "MK", "MT", "NL", "NO", "PL", "PT",
+		"RO", "RS", "RU", "SE", "SI", "SJ", "SK", "SM", "TR", "UA", "VA", "XK",
+	},
+	"NA": {
+		"AG", "AI", "AW", "BB", "BL", "BM", "BQ", "BS", "BZ", "CA", "CR", "CU", "CW", "DM",
+		"DO", "GD", "GL", "GP", "GT", "HN", "HT", "JM", "KN", "KY", "LC", "MF", "MQ", "MS",
+		"MX", "NI", "PA", "PM", "PR", "SV", "SX", "TC", "TT", "US", "VC", "VG", "VI",
+	},
+	"OC": {
+		"AS", "AU", "CK", "FJ", "FM", "GU", "KI", "MH", "MP", "NC", "NF", "NR", "NU", "NZ",
+		"PF", "PG", "PN", "PW", "SB", "TK", "TO", "TV", "UM", "VU", "WF", "WS",
+	},
+	"SA": {"AR", "BO", "BR", "CL", "CO", "EC", "FK", "GF", "GY", "PE", "PY", "SR", "UY", "VE"},
+}
+
+// countryContinent maps every country code to its continent.
+var countryContinent = func() map[string]string {
+	index := make(map[string]string)
+	for continent, countries := range continentCountries {
+		for _, country := range countries {
+			index[country] = continent
+		}
+	}
+	return index
+}()
+
+// region returns the continent of the result and whether it lies in the
+// EU. Both come from the database record when there is one; results that
+// only carry a country, such as overrides, class countries and CSV
+// lookups, fall back to the static tables.
+func region(result *data.LookupResult) (continent string, inEU bool) {
+	if result.Continent != "" {
+		return result.Continent, result.IsInEuropeanUnion
+	}
+	return countryContinent[result.Country], slices.Contains(euMembers, result.Country)
+}
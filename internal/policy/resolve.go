@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Errors returned by Resolver.Resolve for invalid check requests.
+var (
+	ErrNoRules         = errors.New("at least one rule or policy_id is required")
+	ErrPolicyWithRules = errors.New("policy_id cannot be combined with inline rules")
+	ErrUnknownPolicy   = errors.New("unknown policy")
+	ErrMissingDatabase = errors.New("rules need a database that is not loaded")
+)
+
+// UnknownCountriesError lists the entries of the country lists of a request
+// or policy that are neither a country code nor a group.
+type UnknownCountriesError struct {
+	// Entries are the unknown entries, those of allowed_countries first.
+	Entries []string
+	// Fields names the list each entry is from, e.g. "blocked_countries".
+	Fields []string
+}
+
+func (e *UnknownCountriesError) Error() string {
+	quoted := make([]string, len(e.Entries))
+	for i, entry := range e.Entries {
+		quoted[i] = strconv.Quote(entry)
+	}
+	return "unknown country codes: " + strings.Join(quoted, ", ")
+}
+
+// Resolver turns the rules of a check request into the rules to evaluate,
+// for both handlers: it looks up policies by ID, and normalizes and
+// validates the country codes and groups of inline rules.
+type Resolver struct {
+	store       *Store
+	groups      Groups
+	expressions *expressionCache
+
+	checkDatabases bool
+	asn            bool
+	anonymousIP    bool
+}
+
+// ResolverOption configures a Resolver.
+type ResolverOption func(*Resolver)
+
+// WithDatabases declares which optional databases back the lookups. Rules
+// that need a missing one, which would otherwise never match, are then
+// rejected with ErrMissingDatabase: ASN lists without an ASN database and
+// deny_* flags without an Anonymous-IP database. deny_anonymous is the
+// exception, as it also matches the Country database's anonymous proxy
+// trait. Without this option the rules are not checked.
+func WithDatabases(asn, anonymousIP bool) ResolverOption {
+	return func(r *Resolver) {
+		r.checkDatabases = true
+		r.asn = asn
+		r.anonymousIP = anonymousIP
+	}
+}
+
+// WithExpressionCacheSize sets how many compiled inline expressions the
+// Resolver keeps (DefaultExpressionCacheSize by default).
+func WithExpressionCacheSize(size int) ResolverOption {
+	return func(r *Resolver) {
+		r.expressions = newExpressionCache(size)
+	}
+}
+
+// NewResolver returns a Resolver for the policies of store and the custom
+// groups. Either may be nil.
+func NewResolver(store *Store, groups Groups, opts ...ResolverOption) *Resolver {
+	r := &Resolver{store: store, groups: groups, expressions: newExpressionCache(DefaultExpressionCacheSize)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Expression returns the compiled inline expression of a check request,
+// from the cache of recently used expressions if possible. Sources longer
+// than MaxExpressionLength are rejected without being parsed. A nil
+// Resolver compiles every expression.
+func (r *Resolver) Expression(source string) (*Expression, error) {
+	if r == nil || r.expressions == nil {
+		return CompileExpression(source)
+	}
+	return r.expressions.compile(source)
+}
+
+// Resolve returns the rules a check request asks for: those of the policy
+// with the given ID if it is set, and the inline rules of the request
+// otherwise, together with the policy (nil for inline rules). Country codes
+// in the inline lists are normalized to ISO-3166-1 alpha-2 and custom groups
+// are replaced by their members; unknown entries fail with an
+// *UnknownCountriesError. Policies were normalized when they were loaded.
+// Rules that need a database that is not loaded fail with
+// ErrMissingDatabase (see WithDatabases). A nil Resolver has no policies and
+// no custom groups.
+func (r *Resolver) Resolve(id string, inline Rules) (Rules, *Policy, error) {
+	if r == nil {
+		r = &Resolver{}
+	}
+
+	if id != "" {
+		if !inline.IsZero() {
+			return Rules{}, nil, ErrPolicyWithRules
+		}
+		p, ok := r.store.Policy(id)
+		if !ok {
+			return Rules{}, nil, fmt.Errorf("%w %q", ErrUnknownPolicy, id)
+		}
+		if err := r.checkRules(p.Rules); err != nil {
+			return Rules{}, nil, fmt.Errorf("policy %q: %w", id, err)
+		}
+		return p.Rules, p, nil
+	}
+	if inline.IsEmpty() {
+		return Rules{}, nil, ErrNoRules
+	}
+
+	rules, err := r.groups.normalizeRules(inline)
+	if err != nil {
+		return Rules{}, nil, err
+	}
+	if err := r.checkRules(rules); err != nil {
+		return Rules{}, nil, err
+	}
+	return rules, nil, nil
+}
+
+// checkRules rejects rules that need an optional database that is not
+// loaded.
+func (r *Resolver) checkRules(rules Rules) error {
+	if !r.checkDatabases {
+		return nil
+	}
+	if !r.asn {
+		if fields := setFields(map[string]bool{
+			"allowed_asns": len(rules.AllowedASNs) > 0,
+			"blocked_asns": len(rules.BlockedASNs) > 0,
+		}); len(fields) > 0 {
+			return fmt.Errorf("%w: %s need the ASN database", ErrMissingDatabase, strings.Join(fields, ", "))
+		}
+	}
+	if !r.anonymousIP {
+		// deny_anonymous is left out: the Country database's
+		// is_anonymous_proxy trait satisfies it on its own.
+		if fields := setFields(map[string]bool{
+			"deny_vpn":               rules.DenyVPN,
+			"deny_tor_exit_node":     rules.DenyTorExitNode,
+			"deny_hosting_provider":  rules.DenyHostingProvider,
+			"deny_public_proxy":      rules.DenyPublicProxy,
+			"deny_residential_proxy": rules.DenyResidentialProxy,
+		}); len(fields) > 0 {
+			return fmt.Errorf("%w: %s need the Anonymous-IP database", ErrMissingDatabase, strings.Join(fields, ", "))
+		}
+	}
+	return nil
+}
+
+// setFields returns the sorted names of the fields that are set.
+func setFields(fields map[string]bool) []string {
+	var names []string
+	for name, set := range fields {
+		if set {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,164 @@
+package policy
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/TomasB/geofence/internal/data"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	s, err := NewStore(writePolicies(t, map[string]string{
+		"customers.yaml": customerPolicy,
+		"dach.yaml":      "allowed_countries: [dach]\n",
+	}), Groups{"DACH": {"DE", "AT", "CH"}}, data.WithWatchMode(data.WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer s.Close()
+	r := NewResolver(s, Groups{"DACH": {"DE", "AT", "CH"}})
+	inline := Rules{AllowedCountries: []string{"GB"}}
+
+	rules, p, err := r.Resolve("", inline)
+	if err != nil || p != nil || rules.AllowedCountries[0] != "GB" {
+		t.Errorf("expected the inline rules, got %+v, %v, %v", rules, p, err)
+	}
+	rules, p, err = r.Resolve("customers", Rules{})
+	if err != nil || p == nil || p.ID != "customers" || !rules.DenyVPN {
+		t.Errorf("expected the customers policy, got %+v, %v, %v", rules, p, err)
+	}
+
+	if _, _, err := r.Resolve("", Rules{AllowedCountries: []string{}}); !errors.Is(err, ErrNoRules) {
+		t.Errorf("expected ErrNoRules, got %v", err)
+	}
+	// Deny-only rules need no country list.
+	for _, rules := range []Rules{{DenyVPN: true}, {BlockedASNs: []uint32{16509}}, {BlockedCities: []string{"Boxford"}}} {
+		if _, _, err := r.Resolve("", rules); err != nil {
+			t.Errorf("expected %+v to resolve, got %v", rules, err)
+		}
+	}
+	if _, _, err := r.Resolve("customers", inline); !errors.Is(err, ErrPolicyWithRules) {
+		t.Errorf("expected ErrPolicyWithRules, got %v", err)
+	}
+	if _, _, err := r.Resolve("vendors", Rules{}); !errors.Is(err, ErrUnknownPolicy) {
+		t.Errorf("expected ErrUnknownPolicy, got %v", err)
+	}
+
+	var none *Resolver
+	if _, _, err := none.Resolve("customers", Rules{}); !errors.Is(err, ErrUnknownPolicy) {
+		t.Errorf("expected ErrUnknownPolicy without a resolver, got %v", err)
+	}
+	if _, _, err := NewResolver(nil, nil).Resolve("customers", Rules{}); !errors.Is(err, ErrUnknownPolicy) {
+		t.Errorf("expected ErrUnknownPolicy without a store, got %v", err)
+	}
+}
+
+func TestResolver_ExpandsGroups(t *testing.T) {
+	groups := Groups{"DACH": {"DE", "AT", "CH"}, "NORDICS": {"DK", "FI", "IS", "NO", "SE"}}
+	s, err := NewStore(writePolicies(t, map[string]string{"dach.yaml": "allowed_countries: [dach]\n"}), groups, data.WithWatchMode(data.WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer s.Close()
+	r := NewResolver(s, groups)
+
+	rules, _, err := r.Resolve("", Rules{AllowedCountries: []string{"Nordics", "EU"}, BlockedCountries: []string{"dach"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(rules.AllowedCountries, []string{"DK", "FI", "IS", "NO", "SE", "EU"}) {
+		t.Errorf("unexpected allowed countries %v", rules.AllowedCountries)
+	}
+	if !slices.Equal(rules.BlockedCountries, []string{"DE", "AT", "CH"}) {
+		t.Errorf("unexpected blocked countries %v", rules.BlockedCountries)
+	}
+
+	rules, _, err = r.Resolve("dach", Rules{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(rules.AllowedCountries, []string{"DE", "AT", "CH"}) {
+		t.Errorf("expected the policy's group to be expanded, got %v", rules.AllowedCountries)
+	}
+}
+
+func TestResolver_NormalizesCountries(t *testing.T) {
+	r := NewResolver(nil, Groups{"DACH": {"DE", "AT", "CH"}})
+
+	rules, _, err := r.Resolve("", Rules{
+		AllowedCountries: []string{"us", " GB ", "deu", "076", "UK", "continent:eu"},
+		BlockedCountries: []string{"408"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(rules.AllowedCountries, []string{"US", "GB", "DE", "BR", "GB", "CONTINENT:EU"}) {
+		t.Errorf("unexpected allowed countries %v", rules.AllowedCountries)
+	}
+	if !slices.Equal(rules.BlockedCountries, []string{"KP"}) {
+		t.Errorf("unexpected blocked countries %v", rules.BlockedCountries)
+	}
+
+	_, _, err = r.Resolve("", Rules{
+		AllowedCountries: []string{"US", "USA1", "dach"},
+		BlockedCountries: []string{"XX", "CONTINENT:ZZ"},
+	})
+	var unknown *UnknownCountriesError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("expected an UnknownCountriesError, got %v", err)
+	}
+	if !slices.Equal(unknown.Entries, []string{"USA1", "XX", "CONTINENT:ZZ"}) {
+		t.Errorf("unexpected unknown entries %v", unknown.Entries)
+	}
+	if want := `unknown country codes: "USA1", "XX", "CONTINENT:ZZ"`; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
+
+func TestResolver_MissingDatabases(t *testing.T) {
+	s, err := NewStore(writePolicies(t, map[string]string{"customers.yaml": customerPolicy}), nil, data.WithWatchMode(data.WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer s.Close()
+	r := NewResolver(s, nil, WithDatabases(false, false))
+
+	tests := []struct {
+		name  string
+		rules Rules
+		want  string
+	}{
+		{"countries only", Rules{AllowedCountries: []string{"US"}}, ""},
+		{"blocked ASNs", Rules{AllowedCountries: []string{"US"}, BlockedASNs: []uint32{16509}}, "blocked_asns need the ASN database"},
+		{"anonymizer flags", Rules{BlockedCountries: []string{"RU"}, DenyVPN: true, DenyTorExitNode: true}, "deny_tor_exit_node, deny_vpn need the Anonymous-IP database"},
+		{"anonymous proxies", Rules{BlockedCountries: []string{"RU"}, DenyAnonymous: true}, ""},
+		{"anonymous proxies and VPNs", Rules{DenyAnonymous: true, DenyVPN: true}, "deny_vpn need the Anonymous-IP database"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := r.Resolve("", tt.rules)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrMissingDatabase) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Policies are checked too.
+	if _, _, err := r.Resolve("customers", Rules{}); !errors.Is(err, ErrMissingDatabase) {
+		t.Errorf("expected ErrMissingDatabase for the policy, got %v", err)
+	}
+	if _, _, err := NewResolver(s, nil, WithDatabases(false, true)).Resolve("customers", Rules{}); err != nil {
+		t.Errorf("expected the policy to resolve with the Anonymous-IP database, got %v", err)
+	}
+	if _, _, err := NewResolver(s, nil).Resolve("", Rules{AllowedCountries: []string{"US"}, DenyVPN: true}); err != nil {
+		t.Errorf("expected no checks without WithDatabases, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/TomasB/geofence/internal/data"
+	"github.com/goccy/go-yaml"
+)
+
+// errStoreClosed is returned by reloads of a closed Store.
+var errStoreClosed = errors.New("policy store is closed")
+
+// Policy is a named set of rules kept on the server, so that callers
+// reference it by ID instead of sending the rules with every check.
+type Policy struct {
+	// ID is the file name of the policy without its extension.
+	ID string
+	// Version is the version declared in the file, or a hash of its
+	// content if it declares none.
+	Version string
+	Rules   Rules
+}
+
+// policyFile is the content of a policy file.
+type policyFile struct {
+	Version string `yaml:"version"`
+	Rules   `yaml:",inline"`
+}
+
+// Store holds the policies of a directory of YAML (.yaml, .yml) or JSON
+// (.json) files, one policy per file, and reloads them when the directory
+// changes. A directory with an invalid file is rejected as a whole and the
+// previous policies keep applying.
+type Store struct {
+	dir      string
+	groups   Groups
+	policies atomic.Pointer[map[string]*Policy] // nil once closed
+	watch    *data.DirWatch
+
+	mu sync.Mutex // serializes reloads
+}
+
+// NewStore loads the policies in dir and starts watching it as configured
+// by opts (see data.WithWatchMode and data.WithPollInterval). The country
+// lists of the policies may name the custom groups, which are expanded when
+// a policy is loaded.
+func NewStore(dir string, groups Groups, opts ...data.Option) (*Store, error) {
+	s := &Store{dir: dir, groups: groups}
+	policies, err := loadPolicies(dir, groups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+	s.policies.Store(&policies)
+
+	if s.watch, err = data.WatchDir("policy directory", dir, s.Reload, opts...); err != nil {
+		return nil, fmt.Errorf("failed to watch policy directory: %w", err)
+	}
+	return s, nil
+}
+
+// Policy returns the policy with the given ID. A nil Store has no
+// policies.
+func (s *Store) Policy(id string) (*Policy, bool) {
+	if s == nil {
+		return nil, false
+	}
+	policies := s.policies.Load()
+	if policies == nil {
+		return nil, false
+	}
+	p, ok := (*policies)[id]
+	return p, ok
+}
+
+// Len returns the number of loaded policies.
+func (s *Store) Len() int {
+	if policies := s.policies.Load(); policies != nil {
+		return len(*policies)
+	}
+	return 0
+}
+
+// Reload loads the directory again, as the watcher and poller do, and swaps
+// the policies in if every file is valid.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policies.Load() == nil {
+		return errStoreClosed
+	}
+
+	policies, err := loadPolicies(s.dir, s.groups)
+	if err != nil {
+		return fmt.Errorf("candidate policies rejected: %w", err)
+	}
+	s.policies.Store(&policies)
+
+	slog.Info("policies reloaded", "path", s.dir, "policies", len(policies))
+	return nil
+}
+
+// Close stops the watcher. Policies are not found afterwards.
+func (s *Store) Close() error {
+	s.watch.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies.Store(nil)
+	return nil
+}
+
+// loadPolicies parses every policy file in dir. Hidden files and files of
+// other types are ignored.
+func loadPolicies(dir string, groups Groups) (map[string]*Policy, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]*Policy)
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if strings.HasPrefix(name, ".") || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		buf, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		p, err := parsePolicy(strings.TrimSuffix(name, ext), buf, groups)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if _, dup := policies[p.ID]; dup {
+			return nil, fmt.Errorf("%s: duplicate policy %q", name, p.ID)
+		}
+		policies[p.ID] = p
+	}
+	return policies, nil
+}
+
+// parsePolicy parses a policy file. JSON is parsed as the YAML subset it
+// is; unknown fields and unknown country codes are rejected so that typos do
+// not silently loosen a policy.
+func parsePolicy(id string, buf []byte, groups Groups) (*Policy, error) {
+	var f policyFile
+	if err := yaml.UnmarshalWithOptions(buf, &f, yaml.DisallowUnknownField()); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if f.IsEmpty() {
+		return nil, errors.New("at least one rule is required")
+	}
+	rules, err := groups.normalizeRules(f.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	version := f.Version
+	if version == "" {
+		sum := sha256.Sum256(buf)
+		version = hex.EncodeToString(sum[:6])
+	}
+	return &Policy{ID: id, Version: version, Rules: rules}, nil
+}
@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TomasB/geofence/internal/data"
+)
+
+// writePolicies writes the given files into a fresh directory and returns
+// its path.
+func writePolicies(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write policy file: %v", err)
+		}
+	}
+	return dir
+}
+
+const customerPolicy = `version: "2026-03-01"
+allowed_countries: [us, CA]
+blocked_subdivisions: [US-TX]
+deny_vpn: true
+`
+
+func TestNewStore(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"customers.yaml": customerPolicy,
+		"partners.json":  `{"allowed_countries": ["DE"], "allowed_asns": [24940]}`,
+		"sanctions.yml":  "blocked_countries: [kp, ir]\n",
+		"us-direct.yaml": "expression: country == \"US\" && !is_hosting_provider\n",
+		"README.md":      "not a policy",
+	})
+	s, err := NewStore(dir, nil, data.WithWatchMode(data.WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer s.Close()
+
+	if s.Len() != 4 {
+		t.Fatalf("expected 4 policies, got %d", s.Len())
+	}
+	customers, ok := s.Policy("customers")
+	if !ok {
+		t.Fatal("expected the customers policy")
+	}
+	if customers.Version != "2026-03-01" {
+		t.Errorf("expected the declared version, got %q", customers.Version)
+	}
+	if got := strings.Join(customers.Rules.AllowedCountries, ","); got != "US,CA" {
+		t.Errorf("expected US,CA, got %s", got)
+	}
+	if !customers.Rules.DenyVPN || customers.Rules.BlockedSubdivisions[0] != "US-TX" {
+		t.Errorf("unexpected rules %+v", customers.Rules)
+	}
+
+	partners, ok := s.Policy("partners")
+	if !ok {
+		t.Fatal("expected the partners policy")
+	}
+	if len(partners.Version) != 12 {
+		t.Errorf("expected a content hash as version, got %q", partners.Version)
+	}
+	if partners.Rules.AllowedASNs[0] != 24940 {
+		t.Errorf("unexpected rules %+v", partners.Rules)
+	}
+
+	sanctions, _ := s.Policy("sanctions")
+	if got := strings.Join(sanctions.Rules.BlockedCountries, ","); got != "KP,IR" {
+		t.Errorf("expected KP,IR, got %s", got)
+	}
+
+	direct, _ := s.Policy("us-direct")
+	if direct.Rules.Expression == nil || direct.Rules.Expression.String() != `country == "US" && !is_hosting_provider` {
+		t.Errorf("expected the compiled expression, got %+v", direct.Rules)
+	}
+}
+
+func TestNewStore_Invalid(t *testing.T) {
+	tests := map[string]map[string]string{
+		"unknown field":       {"a.yaml": "allowed_countries: [US]\ndeny_vpns: true\n"},
+		"no rules":            {"a.yaml": "version: \"1\"\n"},
+		"duplicate policy ID": {"a.yaml": "allowed_countries: [US]\n", "a.json": `{"allowed_countries": ["US"]}`},
+		"malformed":           {"a.json": `{"allowed_countries": [`},
+		"unknown country":     {"a.yaml": "allowed_countries: [US, USA1]\n"},
+		"unknown group":       {"a.yaml": "blocked_countries: [DACH]\n"},
+		"invalid expression":  {"a.yaml": "expression: country ==\n"},
+	}
+	for name, files := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewStore(writePolicies(t, files), nil, data.WithWatchMode(data.WatchNone)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestStore_Reload(t *testing.T) {
+	dir := writePolicies(t, map[string]string{"customers.yaml": customerPolicy})
+	s, err := NewStore(dir, nil, data.WithWatchMode(data.WatchNone))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer s.Close()
+
+	path := filepath.Join(dir, "customers.yaml")
+	os.WriteFile(path, []byte("allowed_countries: [US]\ndeny_vpns: true\n"), 0644)
+	if err := s.Reload(); err == nil {
+		t.Fatal("expected the invalid policy to be rejected")
+	}
+	if p, _ := s.Policy("customers"); p.Version != "2026-03-01" {
+		t.Errorf("expected the previous policy to stay, got version %q", p.Version)
+	}
+
+	os.WriteFile(path, []byte(strings.Replace(customerPolicy, "2026-03-01", "2026-04-01", 1)), 0644)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if p, _ := s.Policy("customers"); p.Version != "2026-04-01" {
+		t.Errorf("expected the new version, got %q", p.Version)
+	}
+
+	os.Remove(path)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if _, ok := s.Policy("customers"); ok {
+		t.Error("expected the removed policy to be gone")
+	}
+}
+
+func TestStore_Poll(t *testing.T) {
+	dir := writePolicies(t, map[string]string{"customers.yaml": customerPolicy})
+	s, err := NewStore(dir, nil, data.WithWatchMode(data.WatchPoll), data.WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer s.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, "sanctions.yaml"), []byte("blocked_countries: [KP]\n"), 0644); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, ok := s.Policy("sanctions"); ok {
+			return
+		}
+	}
+	t.Fatal("expected the poller to load the new policy")
+}
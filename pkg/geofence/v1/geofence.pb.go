@@ -22,11 +22,28 @@ const (
 )
 
 type CheckRequest struct {
-	state            protoimpl.MessageState `protogen:"open.v1"`
-	Ip               string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
-	AllowedCountries []string               `protobuf:"bytes,2,rep,name=allowed_countries,json=allowedCountries,proto3" json:"allowed_countries,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	Ip                   string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	AllowedCountries     []string               `protobuf:"bytes,2,rep,name=allowed_countries,json=allowedCountries,proto3" json:"allowed_countries,omitempty"`
+	AllowedSubdivisions  []string               `protobuf:"bytes,3,rep,name=allowed_subdivisions,json=allowedSubdivisions,proto3" json:"allowed_subdivisions,omitempty"`
+	BlockedSubdivisions  []string               `protobuf:"bytes,4,rep,name=blocked_subdivisions,json=blockedSubdivisions,proto3" json:"blocked_subdivisions,omitempty"`
+	AllowedCities        []string               `protobuf:"bytes,5,rep,name=allowed_cities,json=allowedCities,proto3" json:"allowed_cities,omitempty"`
+	BlockedCities        []string               `protobuf:"bytes,6,rep,name=blocked_cities,json=blockedCities,proto3" json:"blocked_cities,omitempty"`
+	AllowedAsns          []uint32               `protobuf:"varint,7,rep,packed,name=allowed_asns,json=allowedAsns,proto3" json:"allowed_asns,omitempty"`
+	BlockedAsns          []uint32               `protobuf:"varint,8,rep,packed,name=blocked_asns,json=blockedAsns,proto3" json:"blocked_asns,omitempty"`
+	DenyAnonymous        bool                   `protobuf:"varint,9,opt,name=deny_anonymous,json=denyAnonymous,proto3" json:"deny_anonymous,omitempty"`
+	DenyVpn              bool                   `protobuf:"varint,10,opt,name=deny_vpn,json=denyVpn,proto3" json:"deny_vpn,omitempty"`
+	DenyTorExitNode      bool                   `protobuf:"varint,11,opt,name=deny_tor_exit_node,json=denyTorExitNode,proto3" json:"deny_tor_exit_node,omitempty"`
+	DenyHostingProvider  bool                   `protobuf:"varint,12,opt,name=deny_hosting_provider,json=denyHostingProvider,proto3" json:"deny_hosting_provider,omitempty"`
+	DenyPublicProxy      bool                   `protobuf:"varint,13,opt,name=deny_public_proxy,json=denyPublicProxy,proto3" json:"deny_public_proxy,omitempty"`
+	DenyResidentialProxy bool                   `protobuf:"varint,14,opt,name=deny_residential_proxy,json=denyResidentialProxy,proto3" json:"deny_residential_proxy,omitempty"`
+	RequireUnanimous     bool                   `protobuf:"varint,15,opt,name=require_unanimous,json=requireUnanimous,proto3" json:"require_unanimous,omitempty"`                                      // deny if the sources of a consensus lookup disagree
+	PolicyId             string                 `protobuf:"bytes,16,opt,name=policy_id,json=policyId,proto3" json:"policy_id,omitempty"`                                                               // server-side policy to evaluate instead of the inline rules
+	BlockedCountries     []string               `protobuf:"bytes,17,rep,name=blocked_countries,json=blockedCountries,proto3" json:"blocked_countries,omitempty"`                                       // always denied, even if also allowed
+	Expression           string                 `protobuf:"bytes,18,opt,name=expression,proto3" json:"expression,omitempty"`                                                                           // CEL expression over the lookup result that must also allow the IP
+	Attributes           map[string]string      `protobuf:"bytes,19,rep,name=attributes,proto3" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // client attributes the expression may refer to
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
 }
 
 func (x *CheckRequest) Reset() {
@@ -73,13 +90,159 @@ func (x *CheckRequest) GetAllowedCountries() []string {
 	return nil
 }
 
+func (x *CheckRequest) GetAllowedSubdivisions() []string {
+	if x != nil {
+		return x.AllowedSubdivisions
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetBlockedSubdivisions() []string {
+	if x != nil {
+		return x.BlockedSubdivisions
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetAllowedCities() []string {
+	if x != nil {
+		return x.AllowedCities
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetBlockedCities() []string {
+	if x != nil {
+		return x.BlockedCities
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetAllowedAsns() []uint32 {
+	if x != nil {
+		return x.AllowedAsns
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetBlockedAsns() []uint32 {
+	if x != nil {
+		return x.BlockedAsns
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetDenyAnonymous() bool {
+	if x != nil {
+		return x.DenyAnonymous
+	}
+	return false
+}
+
+func (x *CheckRequest) GetDenyVpn() bool {
+	if x != nil {
+		return x.DenyVpn
+	}
+	return false
+}
+
+func (x *CheckRequest) GetDenyTorExitNode() bool {
+	if x != nil {
+		return x.DenyTorExitNode
+	}
+	return false
+}
+
+func (x *CheckRequest) GetDenyHostingProvider() bool {
+	if x != nil {
+		return x.DenyHostingProvider
+	}
+	return false
+}
+
+func (x *CheckRequest) GetDenyPublicProxy() bool {
+	if x != nil {
+		return x.DenyPublicProxy
+	}
+	return false
+}
+
+func (x *CheckRequest) GetDenyResidentialProxy() bool {
+	if x != nil {
+		return x.DenyResidentialProxy
+	}
+	return false
+}
+
+func (x *CheckRequest) GetRequireUnanimous() bool {
+	if x != nil {
+		return x.RequireUnanimous
+	}
+	return false
+}
+
+func (x *CheckRequest) GetPolicyId() string {
+	if x != nil {
+		return x.PolicyId
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetBlockedCountries() []string {
+	if x != nil {
+		return x.BlockedCountries
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetExpression() string {
+	if x != nil {
+		return x.Expression
+	}
+	return ""
+}
+
+func (x *CheckRequest) GetAttributes() map[string]string {
+	if x != nil {
+		return x.Attributes
+	}
+	return nil
+}
+
 type CheckResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Allowed       bool                   `protobuf:"varint,1,opt,name=allowed,proto3" json:"allowed,omitempty"`
-	Country       string                 `protobuf:"bytes,2,opt,name=country,proto3" json:"country,omitempty"`
-	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Allowed             bool                   `protobuf:"varint,1,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	Country             string                 `protobuf:"bytes,2,opt,name=country,proto3" json:"country,omitempty"`
+	Error               string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	Continent           string                 `protobuf:"bytes,4,opt,name=continent,proto3" json:"continent,omitempty"`
+	RegisteredCountry   string                 `protobuf:"bytes,5,opt,name=registered_country,json=registeredCountry,proto3" json:"registered_country,omitempty"`
+	RepresentedCountry  string                 `protobuf:"bytes,6,opt,name=represented_country,json=representedCountry,proto3" json:"represented_country,omitempty"`
+	IsInEuropeanUnion   bool                   `protobuf:"varint,7,opt,name=is_in_european_union,json=isInEuropeanUnion,proto3" json:"is_in_european_union,omitempty"`
+	IsAnonymousProxy    bool                   `protobuf:"varint,8,opt,name=is_anonymous_proxy,json=isAnonymousProxy,proto3" json:"is_anonymous_proxy,omitempty"`
+	IsSatelliteProvider bool                   `protobuf:"varint,9,opt,name=is_satellite_provider,json=isSatelliteProvider,proto3" json:"is_satellite_provider,omitempty"`
+	Network             string                 `protobuf:"bytes,10,opt,name=network,proto3" json:"network,omitempty"`
+	Subdivision         string                 `protobuf:"bytes,11,opt,name=subdivision,proto3" json:"subdivision,omitempty"`
+	City                string                 `protobuf:"bytes,12,opt,name=city,proto3" json:"city,omitempty"`
+	Asn                 uint32                 `protobuf:"varint,13,opt,name=asn,proto3" json:"asn,omitempty"`
+	AsOrganization      string                 `protobuf:"bytes,14,opt,name=as_organization,json=asOrganization,proto3" json:"as_organization,omitempty"`
+	IsAnonymous         bool                   `protobuf:"varint,15,opt,name=is_anonymous,json=isAnonymous,proto3" json:"is_anonymous,omitempty"`
+	IsVpn               bool                   `protobuf:"varint,16,opt,name=is_vpn,json=isVpn,proto3" json:"is_vpn,omitempty"`
+	IsHostingProvider   bool                   `protobuf:"varint,17,opt,name=is_hosting_provider,json=isHostingProvider,proto3" json:"is_hosting_provider,omitempty"`
+	IsPublicProxy       bool                   `protobuf:"varint,18,opt,name=is_public_proxy,json=isPublicProxy,proto3" json:"is_public_proxy,omitempty"`
+	IsResidentialProxy  bool                   `protobuf:"varint,19,opt,name=is_residential_proxy,json=isResidentialProxy,proto3" json:"is_residential_proxy,omitempty"`
+	IsTorExitNode       bool                   `protobuf:"varint,20,opt,name=is_tor_exit_node,json=isTorExitNode,proto3" json:"is_tor_exit_node,omitempty"`
+	DatabaseVersion     string                 `protobuf:"bytes,21,opt,name=database_version,json=databaseVersion,proto3" json:"database_version,omitempty"`
+	Source              string                 `protobuf:"bytes,22,opt,name=source,proto3" json:"source,omitempty"`                                    // composite source that answered, if several are configured
+	Override            *Override              `protobuf:"bytes,23,opt,name=override,proto3" json:"override,omitempty"`                                // set if an override rule answered instead of the database
+	Consensus           *Consensus             `protobuf:"bytes,24,opt,name=consensus,proto3" json:"consensus,omitempty"`                              // set in consensus mode
+	AddressClass        string                 `protobuf:"bytes,25,opt,name=address_class,json=addressClass,proto3" json:"address_class,omitempty"`    // special-purpose class (e.g. "private"), decided by its class policy
+	Translation         string                 `protobuf:"bytes,26,opt,name=translation,proto3" json:"translation,omitempty"`                          // "nat64", "6to4" or "teredo" if the embedded IPv4 address was looked up
+	EmbeddedIp          string                 `protobuf:"bytes,27,opt,name=embedded_ip,json=embeddedIp,proto3" json:"embedded_ip,omitempty"`          // IPv4 address extracted for translation
+	PolicyId            string                 `protobuf:"bytes,28,opt,name=policy_id,json=policyId,proto3" json:"policy_id,omitempty"`                // policy evaluated, if the request named one
+	PolicyVersion       string                 `protobuf:"bytes,29,opt,name=policy_version,json=policyVersion,proto3" json:"policy_version,omitempty"` // version of that policy
+	Reason              string                 `protobuf:"bytes,30,opt,name=reason,proto3" json:"reason,omitempty"`                                    // "allow_match", "deny_match" or "default"
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
 }
 
 func (x *CheckResponse) Reset() {
@@ -133,20 +296,612 @@ func (x *CheckResponse) GetError() string {
 	return ""
 }
 
+func (x *CheckResponse) GetContinent() string {
+	if x != nil {
+		return x.Continent
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetRegisteredCountry() string {
+	if x != nil {
+		return x.RegisteredCountry
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetRepresentedCountry() string {
+	if x != nil {
+		return x.RepresentedCountry
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetIsInEuropeanUnion() bool {
+	if x != nil {
+		return x.IsInEuropeanUnion
+	}
+	return false
+}
+
+func (x *CheckResponse) GetIsAnonymousProxy() bool {
+	if x != nil {
+		return x.IsAnonymousProxy
+	}
+	return false
+}
+
+func (x *CheckResponse) GetIsSatelliteProvider() bool {
+	if x != nil {
+		return x.IsSatelliteProvider
+	}
+	return false
+}
+
+func (x *CheckResponse) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetSubdivision() string {
+	if x != nil {
+		return x.Subdivision
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetAsn() uint32 {
+	if x != nil {
+		return x.Asn
+	}
+	return 0
+}
+
+func (x *CheckResponse) GetAsOrganization() string {
+	if x != nil {
+		return x.AsOrganization
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetIsAnonymous() bool {
+	if x != nil {
+		return x.IsAnonymous
+	}
+	return false
+}
+
+func (x *CheckResponse) GetIsVpn() bool {
+	if x != nil {
+		return x.IsVpn
+	}
+	return false
+}
+
+func (x *CheckResponse) GetIsHostingProvider() bool {
+	if x != nil {
+		return x.IsHostingProvider
+	}
+	return false
+}
+
+func (x *CheckResponse) GetIsPublicProxy() bool {
+	if x != nil {
+		return x.IsPublicProxy
+	}
+	return false
+}
+
+func (x *CheckResponse) GetIsResidentialProxy() bool {
+	if x != nil {
+		return x.IsResidentialProxy
+	}
+	return false
+}
+
+func (x *CheckResponse) GetIsTorExitNode() bool {
+	if x != nil {
+		return x.IsTorExitNode
+	}
+	return false
+}
+
+func (x *CheckResponse) GetDatabaseVersion() string {
+	if x != nil {
+		return x.DatabaseVersion
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetOverride() *Override {
+	if x != nil {
+		return x.Override
+	}
+	return nil
+}
+
+func (x *CheckResponse) GetConsensus() *Consensus {
+	if x != nil {
+		return x.Consensus
+	}
+	return nil
+}
+
+func (x *CheckResponse) GetAddressClass() string {
+	if x != nil {
+		return x.AddressClass
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetTranslation() string {
+	if x != nil {
+		return x.Translation
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetEmbeddedIp() string {
+	if x != nil {
+		return x.EmbeddedIp
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetPolicyId() string {
+	if x != nil {
+		return x.PolicyId
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetPolicyVersion() string {
+	if x != nil {
+		return x.PolicyVersion
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type Consensus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Agreement     float64                `protobuf:"fixed64,1,opt,name=agreement,proto3" json:"agreement,omitempty"`                                                                 // share of the configured sources that reported the most common country
+	Votes         map[string]string      `protobuf:"bytes,2,rep,name=votes,proto3" json:"votes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // source name -> reported country
+	Failed        []string               `protobuf:"bytes,3,rep,name=failed,proto3" json:"failed,omitempty"`                                                                         // sources whose lookup failed; they do not vote
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Consensus) Reset() {
+	*x = Consensus{}
+	mi := &file_pkg_geofence_v1_geofence_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Consensus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Consensus) ProtoMessage() {}
+
+func (x *Consensus) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_geofence_v1_geofence_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Consensus.ProtoReflect.Descriptor instead.
+func (*Consensus) Descriptor() ([]byte, []int) {
+	return file_pkg_geofence_v1_geofence_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Consensus) GetAgreement() float64 {
+	if x != nil {
+		return x.Agreement
+	}
+	return 0
+}
+
+func (x *Consensus) GetVotes() map[string]string {
+	if x != nil {
+		return x.Votes
+	}
+	return nil
+}
+
+func (x *Consensus) GetFailed() []string {
+	if x != nil {
+		return x.Failed
+	}
+	return nil
+}
+
+type Override struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Network       string                 `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	Reason        string                 `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	ExpiresAt     string                 `protobuf:"bytes,3,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"` // RFC 3339; empty if the override never expires
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Override) Reset() {
+	*x = Override{}
+	mi := &file_pkg_geofence_v1_geofence_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Override) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Override) ProtoMessage() {}
+
+func (x *Override) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_geofence_v1_geofence_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Override.ProtoReflect.Descriptor instead.
+func (*Override) Descriptor() ([]byte, []int) {
+	return file_pkg_geofence_v1_geofence_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Override) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *Override) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Override) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+type GetDatabaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDatabaseRequest) Reset() {
+	*x = GetDatabaseRequest{}
+	mi := &file_pkg_geofence_v1_geofence_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDatabaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDatabaseRequest) ProtoMessage() {}
+
+func (x *GetDatabaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_geofence_v1_geofence_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDatabaseRequest.ProtoReflect.Descriptor instead.
+func (*GetDatabaseRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_geofence_v1_geofence_proto_rawDescGZIP(), []int{4}
+}
+
+type GetDatabaseResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	DatabaseType    string                 `protobuf:"bytes,1,opt,name=database_type,json=databaseType,proto3" json:"database_type,omitempty"`
+	BuildEpoch      uint64                 `protobuf:"varint,2,opt,name=build_epoch,json=buildEpoch,proto3" json:"build_epoch,omitempty"`
+	IpVersion       uint32                 `protobuf:"varint,3,opt,name=ip_version,json=ipVersion,proto3" json:"ip_version,omitempty"`
+	NodeCount       uint64                 `protobuf:"varint,4,opt,name=node_count,json=nodeCount,proto3" json:"node_count,omitempty"`
+	Path            string                 `protobuf:"bytes,5,opt,name=path,proto3" json:"path,omitempty"`
+	FileHash        string                 `protobuf:"bytes,6,opt,name=file_hash,json=fileHash,proto3" json:"file_hash,omitempty"`
+	LoadedAt        string                 `protobuf:"bytes,7,opt,name=loaded_at,json=loadedAt,proto3" json:"loaded_at,omitempty"` // RFC 3339
+	LastReloadError string                 `protobuf:"bytes,8,opt,name=last_reload_error,json=lastReloadError,proto3" json:"last_reload_error,omitempty"`
+	Version         string                 `protobuf:"bytes,9,opt,name=version,proto3" json:"version,omitempty"`
+	Generation      uint64                 `protobuf:"varint,10,opt,name=generation,proto3" json:"generation,omitempty"`
+	Pinned          bool                   `protobuf:"varint,11,opt,name=pinned,proto3" json:"pinned,omitempty"`
+	Source          string                 `protobuf:"bytes,12,opt,name=source,proto3" json:"source,omitempty"`
+	Sources         []*GetDatabaseResponse `protobuf:"bytes,13,rep,name=sources,proto3" json:"sources,omitempty"`              // composite or consensus sources, in configuration order
+	Lookups         uint64                 `protobuf:"varint,14,opt,name=lookups,proto3" json:"lookups,omitempty"`             // consensus lookups answered
+	Disagreements   uint64                 `protobuf:"varint,15,opt,name=disagreements,proto3" json:"disagreements,omitempty"` // non-unanimous consensus lookups; per source, lookups it dissented from
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *GetDatabaseResponse) Reset() {
+	*x = GetDatabaseResponse{}
+	mi := &file_pkg_geofence_v1_geofence_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDatabaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDatabaseResponse) ProtoMessage() {}
+
+func (x *GetDatabaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_geofence_v1_geofence_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDatabaseResponse.ProtoReflect.Descriptor instead.
+func (*GetDatabaseResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_geofence_v1_geofence_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetDatabaseResponse) GetDatabaseType() string {
+	if x != nil {
+		return x.DatabaseType
+	}
+	return ""
+}
+
+func (x *GetDatabaseResponse) GetBuildEpoch() uint64 {
+	if x != nil {
+		return x.BuildEpoch
+	}
+	return 0
+}
+
+func (x *GetDatabaseResponse) GetIpVersion() uint32 {
+	if x != nil {
+		return x.IpVersion
+	}
+	return 0
+}
+
+func (x *GetDatabaseResponse) GetNodeCount() uint64 {
+	if x != nil {
+		return x.NodeCount
+	}
+	return 0
+}
+
+func (x *GetDatabaseResponse) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *GetDatabaseResponse) GetFileHash() string {
+	if x != nil {
+		return x.FileHash
+	}
+	return ""
+}
+
+func (x *GetDatabaseResponse) GetLoadedAt() string {
+	if x != nil {
+		return x.LoadedAt
+	}
+	return ""
+}
+
+func (x *GetDatabaseResponse) GetLastReloadError() string {
+	if x != nil {
+		return x.LastReloadError
+	}
+	return ""
+}
+
+func (x *GetDatabaseResponse) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *GetDatabaseResponse) GetGeneration() uint64 {
+	if x != nil {
+		return x.Generation
+	}
+	return 0
+}
+
+func (x *GetDatabaseResponse) GetPinned() bool {
+	if x != nil {
+		return x.Pinned
+	}
+	return false
+}
+
+func (x *GetDatabaseResponse) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *GetDatabaseResponse) GetSources() []*GetDatabaseResponse {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
+func (x *GetDatabaseResponse) GetLookups() uint64 {
+	if x != nil {
+		return x.Lookups
+	}
+	return 0
+}
+
+func (x *GetDatabaseResponse) GetDisagreements() uint64 {
+	if x != nil {
+		return x.Disagreements
+	}
+	return 0
+}
+
 var File_pkg_geofence_v1_geofence_proto protoreflect.FileDescriptor
 
 const file_pkg_geofence_v1_geofence_proto_rawDesc = "" +
 	"\n" +
-	"\x1epkg/geofence/v1/geofence.proto\x12\vgeofence.v1\"K\n" +
+	"\x1epkg/geofence/v1/geofence.proto\x12\vgeofence.v1\"\xeb\x06\n" +
 	"\fCheckRequest\x12\x0e\n" +
 	"\x02ip\x18\x01 \x01(\tR\x02ip\x12+\n" +
-	"\x11allowed_countries\x18\x02 \x03(\tR\x10allowedCountries\"Y\n" +
+	"\x11allowed_countries\x18\x02 \x03(\tR\x10allowedCountries\x121\n" +
+	"\x14allowed_subdivisions\x18\x03 \x03(\tR\x13allowedSubdivisions\x121\n" +
+	"\x14blocked_subdivisions\x18\x04 \x03(\tR\x13blockedSubdivisions\x12%\n" +
+	"\x0eallowed_cities\x18\x05 \x03(\tR\rallowedCities\x12%\n" +
+	"\x0eblocked_cities\x18\x06 \x03(\tR\rblockedCities\x12!\n" +
+	"\fallowed_asns\x18\a \x03(\rR\vallowedAsns\x12!\n" +
+	"\fblocked_asns\x18\b \x03(\rR\vblockedAsns\x12%\n" +
+	"\x0edeny_anonymous\x18\t \x01(\bR\rdenyAnonymous\x12\x19\n" +
+	"\bdeny_vpn\x18\n" +
+	" \x01(\bR\adenyVpn\x12+\n" +
+	"\x12deny_tor_exit_node\x18\v \x01(\bR\x0fdenyTorExitNode\x122\n" +
+	"\x15deny_hosting_provider\x18\f \x01(\bR\x13denyHostingProvider\x12*\n" +
+	"\x11deny_public_proxy\x18\r \x01(\bR\x0fdenyPublicProxy\x124\n" +
+	"\x16deny_residential_proxy\x18\x0e \x01(\bR\x14denyResidentialProxy\x12+\n" +
+	"\x11require_unanimous\x18\x0f \x01(\bR\x10requireUnanimous\x12\x1b\n" +
+	"\tpolicy_id\x18\x10 \x01(\tR\bpolicyId\x12+\n" +
+	"\x11blocked_countries\x18\x11 \x03(\tR\x10blockedCountries\x12\x1e\n" +
+	"\n" +
+	"expression\x18\x12 \x01(\tR\n" +
+	"expression\x12I\n" +
+	"\n" +
+	"attributes\x18\x13 \x03(\v2).geofence.v1.CheckRequest.AttributesEntryR\n" +
+	"attributes\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xd2\b\n" +
 	"\rCheckResponse\x12\x18\n" +
 	"\aallowed\x18\x01 \x01(\bR\aallowed\x12\x18\n" +
 	"\acountry\x18\x02 \x01(\tR\acountry\x12\x14\n" +
-	"\x05error\x18\x03 \x01(\tR\x05error2Q\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x1c\n" +
+	"\tcontinent\x18\x04 \x01(\tR\tcontinent\x12-\n" +
+	"\x12registered_country\x18\x05 \x01(\tR\x11registeredCountry\x12/\n" +
+	"\x13represented_country\x18\x06 \x01(\tR\x12representedCountry\x12/\n" +
+	"\x14is_in_european_union\x18\a \x01(\bR\x11isInEuropeanUnion\x12,\n" +
+	"\x12is_anonymous_proxy\x18\b \x01(\bR\x10isAnonymousProxy\x122\n" +
+	"\x15is_satellite_provider\x18\t \x01(\bR\x13isSatelliteProvider\x12\x18\n" +
+	"\anetwork\x18\n" +
+	" \x01(\tR\anetwork\x12 \n" +
+	"\vsubdivision\x18\v \x01(\tR\vsubdivision\x12\x12\n" +
+	"\x04city\x18\f \x01(\tR\x04city\x12\x10\n" +
+	"\x03asn\x18\r \x01(\rR\x03asn\x12'\n" +
+	"\x0fas_organization\x18\x0e \x01(\tR\x0easOrganization\x12!\n" +
+	"\fis_anonymous\x18\x0f \x01(\bR\visAnonymous\x12\x15\n" +
+	"\x06is_vpn\x18\x10 \x01(\bR\x05isVpn\x12.\n" +
+	"\x13is_hosting_provider\x18\x11 \x01(\bR\x11isHostingProvider\x12&\n" +
+	"\x0fis_public_proxy\x18\x12 \x01(\bR\risPublicProxy\x120\n" +
+	"\x14is_residential_proxy\x18\x13 \x01(\bR\x12isResidentialProxy\x12'\n" +
+	"\x10is_tor_exit_node\x18\x14 \x01(\bR\risTorExitNode\x12)\n" +
+	"\x10database_version\x18\x15 \x01(\tR\x0fdatabaseVersion\x12\x16\n" +
+	"\x06source\x18\x16 \x01(\tR\x06source\x121\n" +
+	"\boverride\x18\x17 \x01(\v2\x15.geofence.v1.OverrideR\boverride\x124\n" +
+	"\tconsensus\x18\x18 \x01(\v2\x16.geofence.v1.ConsensusR\tconsensus\x12#\n" +
+	"\raddress_class\x18\x19 \x01(\tR\faddressClass\x12 \n" +
+	"\vtranslation\x18\x1a \x01(\tR\vtranslation\x12\x1f\n" +
+	"\vembedded_ip\x18\x1b \x01(\tR\n" +
+	"embeddedIp\x12\x1b\n" +
+	"\tpolicy_id\x18\x1c \x01(\tR\bpolicyId\x12%\n" +
+	"\x0epolicy_version\x18\x1d \x01(\tR\rpolicyVersion\x12\x16\n" +
+	"\x06reason\x18\x1e \x01(\tR\x06reason\"\xb4\x01\n" +
+	"\tConsensus\x12\x1c\n" +
+	"\tagreement\x18\x01 \x01(\x01R\tagreement\x127\n" +
+	"\x05votes\x18\x02 \x03(\v2!.geofence.v1.Consensus.VotesEntryR\x05votes\x12\x16\n" +
+	"\x06failed\x18\x03 \x03(\tR\x06failed\x1a8\n" +
+	"\n" +
+	"VotesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"[\n" +
+	"\bOverride\x12\x18\n" +
+	"\anetwork\x18\x01 \x01(\tR\anetwork\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x03 \x01(\tR\texpiresAt\"\x14\n" +
+	"\x12GetDatabaseRequest\"\xf9\x03\n" +
+	"\x13GetDatabaseResponse\x12#\n" +
+	"\rdatabase_type\x18\x01 \x01(\tR\fdatabaseType\x12\x1f\n" +
+	"\vbuild_epoch\x18\x02 \x01(\x04R\n" +
+	"buildEpoch\x12\x1d\n" +
+	"\n" +
+	"ip_version\x18\x03 \x01(\rR\tipVersion\x12\x1d\n" +
+	"\n" +
+	"node_count\x18\x04 \x01(\x04R\tnodeCount\x12\x12\n" +
+	"\x04path\x18\x05 \x01(\tR\x04path\x12\x1b\n" +
+	"\tfile_hash\x18\x06 \x01(\tR\bfileHash\x12\x1b\n" +
+	"\tloaded_at\x18\a \x01(\tR\bloadedAt\x12*\n" +
+	"\x11last_reload_error\x18\b \x01(\tR\x0flastReloadError\x12\x18\n" +
+	"\aversion\x18\t \x01(\tR\aversion\x12\x1e\n" +
+	"\n" +
+	"generation\x18\n" +
+	" \x01(\x04R\n" +
+	"generation\x12\x16\n" +
+	"\x06pinned\x18\v \x01(\bR\x06pinned\x12\x16\n" +
+	"\x06source\x18\f \x01(\tR\x06source\x12:\n" +
+	"\asources\x18\r \x03(\v2 .geofence.v1.GetDatabaseResponseR\asources\x12\x18\n" +
+	"\alookups\x18\x0e \x01(\x04R\alookups\x12$\n" +
+	"\rdisagreements\x18\x0f \x01(\x04R\rdisagreements2\xa3\x01\n" +
 	"\x0fGeofenceService\x12>\n" +
-	"\x05Check\x12\x19.geofence.v1.CheckRequest\x1a\x1a.geofence.v1.CheckResponseB7Z5github.com/TomasB/geofence/pkg/geofence/v1;geofencev1b\x06proto3"
+	"\x05Check\x12\x19.geofence.v1.CheckRequest\x1a\x1a.geofence.v1.CheckResponse\x12P\n" +
+	"\vGetDatabase\x12\x1f.geofence.v1.GetDatabaseRequest\x1a .geofence.v1.GetDatabaseResponseB7Z5github.com/TomasB/geofence/pkg/geofence/v1;geofencev1b\x06proto3"
 
 var (
 	file_pkg_geofence_v1_geofence_proto_rawDescOnce sync.Once
@@ -160,19 +915,32 @@ func file_pkg_geofence_v1_geofence_proto_rawDescGZIP() []byte {
 	return file_pkg_geofence_v1_geofence_proto_rawDescData
 }
 
-var file_pkg_geofence_v1_geofence_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_pkg_geofence_v1_geofence_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_pkg_geofence_v1_geofence_proto_goTypes = []any{
-	(*CheckRequest)(nil),  // 0: geofence.v1.CheckRequest
-	(*CheckResponse)(nil), // 1: geofence.v1.CheckResponse
+	(*CheckRequest)(nil),        // 0: geofence.v1.CheckRequest
+	(*CheckResponse)(nil),       // 1: geofence.v1.CheckResponse
+	(*Consensus)(nil),           // 2: geofence.v1.Consensus
+	(*Override)(nil),            // 3: geofence.v1.Override
+	(*GetDatabaseRequest)(nil),  // 4: geofence.v1.GetDatabaseRequest
+	(*GetDatabaseResponse)(nil), // 5: geofence.v1.GetDatabaseResponse
+	nil,                         // 6: geofence.v1.CheckRequest.AttributesEntry
+	nil,                         // 7: geofence.v1.Consensus.VotesEntry
 }
 var file_pkg_geofence_v1_geofence_proto_depIdxs = []int32{
-	0, // 0: geofence.v1.GeofenceService.Check:input_type -> geofence.v1.CheckRequest
-	1, // 1: geofence.v1.GeofenceService.Check:output_type -> geofence.v1.CheckResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	6, // 0: geofence.v1.CheckRequest.attributes:type_name -> geofence.v1.CheckRequest.AttributesEntry
+	3, // 1: geofence.v1.CheckResponse.override:type_name -> geofence.v1.Override
+	2, // 2: geofence.v1.CheckResponse.consensus:type_name -> geofence.v1.Consensus
+	7, // 3: geofence.v1.Consensus.votes:type_name -> geofence.v1.Consensus.VotesEntry
+	5, // 4: geofence.v1.GetDatabaseResponse.sources:type_name -> geofence.v1.GetDatabaseResponse
+	0, // 5: geofence.v1.GeofenceService.Check:input_type -> geofence.v1.CheckRequest
+	4, // 6: geofence.v1.GeofenceService.GetDatabase:input_type -> geofence.v1.GetDatabaseRequest
+	1, // 7: geofence.v1.GeofenceService.Check:output_type -> geofence.v1.CheckResponse
+	5, // 8: geofence.v1.GeofenceService.GetDatabase:output_type -> geofence.v1.GetDatabaseResponse
+	7, // [7:9] is the sub-list for method output_type
+	5, // [5:7] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_pkg_geofence_v1_geofence_proto_init() }
@@ -186,7 +954,7 @@ func file_pkg_geofence_v1_geofence_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pkg_geofence_v1_geofence_proto_rawDesc), len(file_pkg_geofence_v1_geofence_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
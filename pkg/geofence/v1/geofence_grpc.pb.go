@@ -19,7 +19,8 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	GeofenceService_Check_FullMethodName = "/geofence.v1.GeofenceService/Check"
+	GeofenceService_Check_FullMethodName       = "/geofence.v1.GeofenceService/Check"
+	GeofenceService_GetDatabase_FullMethodName = "/geofence.v1.GeofenceService/GetDatabase"
 )
 
 // GeofenceServiceClient is the client API for GeofenceService service.
@@ -27,6 +28,7 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type GeofenceServiceClient interface {
 	Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+	GetDatabase(ctx context.Context, in *GetDatabaseRequest, opts ...grpc.CallOption) (*GetDatabaseResponse, error)
 }
 
 type geofenceServiceClient struct {
@@ -47,11 +49,22 @@ func (c *geofenceServiceClient) Check(ctx context.Context, in *CheckRequest, opt
 	return out, nil
 }
 
+func (c *geofenceServiceClient) GetDatabase(ctx context.Context, in *GetDatabaseRequest, opts ...grpc.CallOption) (*GetDatabaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetDatabaseResponse)
+	err := c.cc.Invoke(ctx, GeofenceService_GetDatabase_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GeofenceServiceServer is the server API for GeofenceService service.
 // All implementations must embed UnimplementedGeofenceServiceServer
 // for forward compatibility.
 type GeofenceServiceServer interface {
 	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+	GetDatabase(context.Context, *GetDatabaseRequest) (*GetDatabaseResponse, error)
 	mustEmbedUnimplementedGeofenceServiceServer()
 }
 
@@ -65,6 +78,9 @@ type UnimplementedGeofenceServiceServer struct{}
 func (UnimplementedGeofenceServiceServer) Check(context.Context, *CheckRequest) (*CheckResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Check not implemented")
 }
+func (UnimplementedGeofenceServiceServer) GetDatabase(context.Context, *GetDatabaseRequest) (*GetDatabaseResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetDatabase not implemented")
+}
 func (UnimplementedGeofenceServiceServer) mustEmbedUnimplementedGeofenceServiceServer() {}
 func (UnimplementedGeofenceServiceServer) testEmbeddedByValue()                         {}
 
@@ -104,6 +120,24 @@ func _GeofenceService_Check_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GeofenceService_GetDatabase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDatabaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeofenceServiceServer).GetDatabase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GeofenceService_GetDatabase_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeofenceServiceServer).GetDatabase(ctx, req.(*GetDatabaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // GeofenceService_ServiceDesc is the grpc.ServiceDesc for GeofenceService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,6 +149,10 @@ var GeofenceService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Check",
 			Handler:    _GeofenceService_Check_Handler,
 		},
+		{
+			MethodName: "GetDatabase",
+			Handler:    _GeofenceService_GetDatabase_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "pkg/geofence/v1/geofence.proto",